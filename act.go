@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+type Act struct {
+	// Publisher is the compressed public key of the publishing node, needed
+	// to read the content back.
+	Publisher string   `json:"publisher"`
+	Grantees  []string `json:"grantees"`
+}
+
+func (a *Act) validate() error {
+	keys := a.Grantees
+	if a.Publisher != "" {
+		keys = append([]string{a.Publisher}, keys...)
+	}
+	for _, k := range keys {
+		b, err := hex.DecodeString(k)
+		if err != nil || len(b) != 33 {
+			return fmt.Errorf("invalid public key %q", k)
+		}
+	}
+	return nil
+}
+
+type granteeResponse struct {
+	Ref        string `json:"ref"`
+	HistoryRef string `json:"historyref"`
+}
+
+// createGrantees stores the grantee list under the given history and returns
+// the resulting history address.
+func (c *Client) createGrantees(batchID, history string, grantees []string) (*granteeResponse, error) {
+	b, err := json.Marshal(struct {
+		Grantees []string `json:"grantees"`
+	}{grantees})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, c.apiURL+"/grantee", bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Swarm-Postage-Batch-Id", batchID)
+	req.Header.Add("Swarm-Act-History-Address", history)
+	req.Header.Add("Content-Type", "application/json")
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusCreated && res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d: %s", res.StatusCode, body)
+	}
+
+	var grantee granteeResponse
+	err = json.Unmarshal(body, &grantee)
+	if err != nil {
+		return nil, err
+	}
+	return &grantee, nil
+}
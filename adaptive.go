@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	defaultAdaptiveMax       = 64 << 20
+	defaultAdaptiveTolerance = 0.2
+	// adaptiveWindow is how many uploads at a size are averaged before
+	// the size changes again
+	adaptiveWindow = 3
+)
+
+// AdaptiveSize grows and shrinks the payloads to keep the upload latency
+// near Latency, so the batch polls between uploads stay regular while the
+// uploads take as much as the node ingests.
+type AdaptiveSize struct {
+	Latency duration `json:"latency"`
+	// Min and Max bound the payload size, a chunk and 64MiB by default.
+	Min int `json:"min"`
+	Max int `json:"max"`
+	// Tolerance is the deviation from Latency left alone, relative, 0.2
+	// by default.
+	Tolerance float64 `json:"tolerance"`
+}
+
+func (a *AdaptiveSize) validate(e Experiment) error {
+	switch {
+	case a.Latency <= 0:
+		return fmt.Errorf("missing latency")
+	case a.Min < 0 || a.Max < 0 || a.Tolerance < 0:
+		return fmt.Errorf("negative min, max or tolerance")
+	case a.Max > 0 && a.Max < a.Min:
+		return fmt.Errorf("max below min")
+	case len(e.Mix) > 0 || len(e.Sweep) > 0 || e.Repeat > 0 || e.Trace != nil || e.Source != nil || e.Workload == workloadPss:
+		return fmt.Errorf("needs payloads of the experiment's size, no mix, sweep, repeat, trace, source or pss")
+	}
+	return nil
+}
+
+// sizer picks the payload size from the latency of the uploads at the
+// current one. Latency grows about linearly with the size, so the next
+// size is the one the mean latency per byte puts at the target, at most
+// doubling or halving the size per step.
+type sizer struct {
+	target    time.Duration
+	tolerance float64
+	min, max  int
+	align     string
+	encrypt   bool
+
+	size    int
+	changed time.Time
+	uploads int
+	latency time.Duration
+	bytes   int
+}
+
+func newSizer(a *AdaptiveSize, exp Experiment) *sizer {
+	s := &sizer{
+		target:    time.Duration(a.Latency),
+		tolerance: a.Tolerance,
+		min:       a.Min,
+		max:       a.Max,
+		align:     exp.Align,
+		encrypt:   exp.Encrypt,
+		changed:   clock.Now(),
+	}
+	if s.min == 0 {
+		s.min = chunkSize
+	}
+	if s.max == 0 {
+		s.max = defaultAdaptiveMax
+	}
+	if s.tolerance == 0 {
+		s.tolerance = defaultAdaptiveTolerance
+	}
+	s.size = s.clamp(exp.Size)
+	return s
+}
+
+func (s *sizer) clamp(size int) int {
+	if size < s.min {
+		size = s.min
+	}
+	if size > s.max {
+		size = s.max
+	}
+	return alignSize(size, s.align, s.encrypt)
+}
+
+// observe records an upload and reports whether the size changed. Uploads
+// started before the last change were generated at the old size.
+func (s *sizer) observe(started time.Time, size int, latency time.Duration) bool {
+	if started.Before(s.changed) || size == 0 {
+		return false
+	}
+	s.uploads++
+	s.latency += latency
+	s.bytes += size
+	if s.uploads < adaptiveWindow {
+		return false
+	}
+	mean := s.latency / time.Duration(s.uploads)
+	perByte := float64(s.latency) / float64(s.bytes)
+	s.uploads, s.latency, s.bytes = 0, 0, 0
+	if d := float64(mean-s.target) / float64(s.target); d >= -s.tolerance && d <= s.tolerance {
+		return false
+	}
+	next := int(float64(s.target) / perByte)
+	if next > 2*s.size {
+		next = 2 * s.size
+	}
+	if next < s.size/2 {
+		next = s.size / 2
+	}
+	next = s.clamp(next)
+	if next == s.size {
+		return false
+	}
+	s.size = next
+	s.changed = clock.Now()
+	return true
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// defaultAlerts are the fill thresholds alerted on when the experiment
+// doesn't set any.
+var defaultAlerts = []float64{90}
+
+// Alert is a fill threshold the fullest bucket crossed. The fullest bucket
+// is what makes uploads fail, however empty the others are.
+type Alert struct {
+	Threshold float64   `json:"threshold"`
+	Time      time.Time `json:"time"`
+	Bytes     int       `json:"bytes"`
+	// Utilization is the fullest bucket's collision count.
+	Utilization int `json:"utilization"`
+	Capacity    int `json:"capacity"`
+}
+
+func validateAlerts(thresholds []float64) error {
+	for _, t := range thresholds {
+		if t <= 0 || t > 100 {
+			return fmt.Errorf("alert threshold %g outside 0-100%%", t)
+		}
+	}
+	return nil
+}
+
+// alerter raises each threshold once per batch.
+type alerter struct {
+	thresholds []float64
+	crossed    map[float64]bool
+}
+
+func newAlerter(thresholds []float64) *alerter {
+	if thresholds == nil {
+		thresholds = defaultAlerts
+	}
+	return &alerter{thresholds: thresholds, crossed: map[float64]bool{}}
+}
+
+// observe returns the thresholds the batch crossed since the last call.
+func (a *alerter) observe(f io.Writer, batch *Batch, bytes int) []Alert {
+	var alerts []Alert
+	capacity := batch.capacity()
+	fill := 100 * float64(batch.Utilization) / float64(capacity)
+	for _, t := range a.thresholds {
+		if a.crossed[t] || fill < t {
+			continue
+		}
+		a.crossed[t] = true
+		alert := Alert{Threshold: t, Time: clock.Now(), Bytes: bytes, Utilization: batch.Utilization, Capacity: capacity}
+		log(f, "alert fullestBucket=", batch.Utilization, " capacity=", capacity, " fill=", fmt.Sprintf("%.1f%%", fill), " threshold=", fmt.Sprintf("%g%%", t),
+			" totalUploaded=", prettyByteSize(bytes))
+		alerts = append(alerts, alert)
+	}
+	return alerts
+}
+
+// reset rearms the thresholds for a new batch.
+func (a *alerter) reset() {
+	a.crossed = map[float64]bool{}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sampleLine matches upload records of both the original format, which had
+// no separator before the utilization, and the current one with chunk counts.
+var sampleLine = regexp.MustCompile(`^totalUploaded=([0-9.]+)((?:[KMGTPEZY]i)?)B\s*(?:totalChunks=(\d+)\s*)?utilization=(\d+)`)
+
+var batchLine = regexp.MustCompile(`^batchID=\s*([0-9a-fA-F]+)`)
+
+// depthLine and diluteLine carry the capacity of the batch, at the start of
+// the run and after each dilution.
+var (
+	depthLine  = regexp.MustCompile(`^batch depth=(\d+) bucketDepth=(\d+)`)
+	diluteLine = regexp.MustCompile(`^dilute depth=\d+->\d+ capacity=\d+->(\d+)`)
+)
+
+type analysis struct {
+	file    string
+	batchID string
+	samples []Sample
+}
+
+// parseLog reconstructs the utilization series from an experiment log.
+func parseLog(r io.Reader) (*analysis, error) {
+	var a analysis
+	capacity := 0
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		ts, rest, ok := strings.Cut(sc.Text(), " ")
+		if !ok {
+			continue
+		}
+		if m := batchLine.FindStringSubmatch(rest); m != nil {
+			a.batchID = m[1]
+			continue
+		}
+		if m := depthLine.FindStringSubmatch(rest); m != nil {
+			depth, _ := strconv.Atoi(m[1])
+			bucketDepth, _ := strconv.Atoi(m[2])
+			if depth > 0 {
+				capacity = 1 << (depth - bucketDepth)
+			}
+			continue
+		}
+		if m := diluteLine.FindStringSubmatch(rest); m != nil {
+			capacity, _ = strconv.Atoi(m[1])
+			continue
+		}
+		m := sampleLine.FindStringSubmatch(rest)
+		if m == nil {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, ts)
+		if err != nil {
+			return nil, fmt.Errorf("parse time %q: %w", ts, err)
+		}
+		b, err := parseByteSize(m[1], m[2])
+		if err != nil {
+			return nil, err
+		}
+		s := Sample{Time: t, Bytes: b, Capacity: capacity}
+		if m[3] != "" {
+			s.Chunks, _ = strconv.Atoi(m[3])
+		}
+		s.Utilization, _ = strconv.Atoi(m[4])
+		a.samples = append(a.samples, s)
+	}
+	return &a, sc.Err()
+}
+
+// parseByteSize reverses prettyByteSize, within its precision.
+func parseByteSize(value, unit string) (int, error) {
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parse size %q: %w", value, err)
+	}
+	for _, u := range []string{"", "Ki", "Mi", "Gi", "Ti", "Pi", "Ei", "Zi", "Yi"} {
+		if u == unit {
+			return int(v), nil
+		}
+		v *= 1024
+	}
+	return 0, fmt.Errorf("unknown unit %q", unit)
+}
+
+func analyze(args []string) error {
+	fs := newFlagSet("analyze", "[flags] log[.gz]|series.ts[.gz]...")
+	csvPath := fs.String("csv", "", "write the reconstructed series of all logs to this CSV file")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("no logs given")
+	}
+
+	var all []*analysis
+	for _, name := range fs.Args() {
+		f, err := openInput(name)
+		if err != nil {
+			return err
+		}
+		var a *analysis
+		if strings.HasSuffix(strings.TrimSuffix(name, gzipSuffix), ".ts") {
+			a = &analysis{}
+			a.samples, err = readSeries(f)
+		} else {
+			a, err = parseLog(f)
+		}
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		a.file = name
+		all = append(all, a)
+		summarize(os.Stdout, a)
+	}
+
+	if *csvPath == "" {
+		return nil
+	}
+	f, err := os.Create(*csvPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return writeCSV(f, all)
+}
+
+func summarize(w io.Writer, a *analysis) {
+	if len(a.samples) == 0 {
+		fmt.Fprintf(w, "%s: batchID=%s no samples\n", a.file, a.batchID)
+		return
+	}
+	first, last := a.samples[0], a.samples[len(a.samples)-1]
+	full, ok := bytesToFull(a.samples)
+	fmt.Fprintf(w, "%s: batchID=%s samples=%d duration=%s totalUploaded=%s utilization=%d bytesToFull=%s\n",
+		a.file, a.batchID, len(a.samples), last.Time.Sub(first.Time), prettyByteSize(last.Bytes), last.Utilization, formatBytes(full, ok))
+
+	// bytes at which each utilization value was first seen
+	prev := -1
+	for _, s := range a.samples {
+		if s.Utilization != prev {
+			fmt.Fprintf(w, "  utilization=%d at totalUploaded=%s time=%s\n", s.Utilization, prettyByteSize(s.Bytes), s.Time.Format(time.RFC3339))
+			prev = s.Utilization
+		}
+	}
+}
+
+func writeCSV(w io.Writer, all []*analysis) error {
+	cw := csv.NewWriter(w)
+	err := cw.Write([]string{"file", "batchID", "time", "bytes", "chunks", "utilization"})
+	if err != nil {
+		return err
+	}
+	for _, a := range all {
+		for _, s := range a.samples {
+			err = cw.Write([]string{a.file, a.batchID, s.Time.Format(time.RFC3339), strconv.Itoa(s.Bytes), strconv.Itoa(s.Chunks), strconv.Itoa(s.Utilization)})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
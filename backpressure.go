@@ -0,0 +1,92 @@
+package main
+
+import "time"
+
+// Backpressure slows an experiment down while the node is slow: when an
+// upload takes longer than Latency the concurrency is halved, and at a
+// concurrency of one a growing pause is added before each upload. After
+// Recover fast uploads in a row the pause shrinks and then the concurrency
+// grows again, one step at a time.
+type Backpressure struct {
+	Latency duration `json:"latency"`
+	Recover int      `json:"recover"`
+}
+
+const (
+	defaultRecover = 5
+	minPause       = 100 * time.Millisecond
+	maxPause       = time.Minute
+)
+
+// throttle adapts the pipeline limits to the observed upload latency.
+type throttle struct {
+	latency time.Duration
+	recover int
+	max     int
+
+	limit   int
+	pause   time.Duration
+	fast    int
+	changed time.Time
+}
+
+func newThrottle(b *Backpressure, concurrency int) *throttle {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	t := &throttle{
+		latency: time.Duration(b.Latency),
+		recover: b.Recover,
+		max:     concurrency,
+		limit:   concurrency,
+	}
+	if t.recover <= 0 {
+		t.recover = defaultRecover
+	}
+	return t
+}
+
+// observe records an upload and reports whether the limits changed.
+// Uploads started before the last change don't count, they ran under the
+// old limits.
+func (t *throttle) observe(started time.Time, latency time.Duration) bool {
+	if started.Before(t.changed) {
+		return false
+	}
+	if latency > t.latency {
+		t.fast = 0
+		switch {
+		case t.limit > 1:
+			t.limit /= 2
+		case t.pause == 0:
+			t.pause = minPause
+		case t.pause < maxPause:
+			t.pause *= 2
+			if t.pause > maxPause {
+				t.pause = maxPause
+			}
+		default:
+			return false
+		}
+		t.changed = clock.Now()
+		return true
+	}
+	t.fast++
+	if t.fast < t.recover {
+		return false
+	}
+	t.fast = 0
+	switch {
+	case t.pause > 0:
+		t.pause /= 2
+		if t.pause < minPause {
+			t.pause = 0
+		}
+	case t.limit < t.max:
+		t.limit++
+	default:
+		return false
+	}
+	t.changed = clock.Now()
+	return true
+}
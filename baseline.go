@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"time"
+)
+
+// Golden is the summary of known-good runs that later runs are checked
+// against, written by the baseline command.
+type Golden struct {
+	Created time.Time `json:"created"`
+	// BeeVersion is the version of the node the runs were made on.
+	BeeVersion  string             `json:"beeVersion"`
+	Experiments []GoldenExperiment `json:"experiments"`
+}
+
+// GoldenExperiment is what one experiment of the golden runs got.
+type GoldenExperiment struct {
+	Name string `json:"name"`
+	// BytesToFull is 0 when the batch didn't fill up.
+	BytesToFull int `json:"bytesToFull"`
+	// UtilizationPerGiB is the utilization per GiB once Bytes were
+	// uploaded, the end of the run.
+	Bytes             int     `json:"bytes"`
+	UtilizationPerGiB float64 `json:"utilizationPerGiB"`
+}
+
+func goldenExperiment(r *Result) GoldenExperiment {
+	g := GoldenExperiment{Name: r.Experiment.Name}
+	g.BytesToFull, _ = r.bytesToFull()
+	if len(r.Samples) > 0 {
+		last := r.Samples[len(r.Samples)-1]
+		g.Bytes = last.Bytes
+		g.UtilizationPerGiB = perGiB(last.Utilization, last.Bytes)
+	}
+	return g
+}
+
+func cmdBaseline(args []string) error {
+	fs := newFlagSet("baseline", "[flags] result.json...")
+	out := fs.String("o", "baseline.json", "golden file to write")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return withExitCode(exitUsage, fmt.Errorf("need at least one result"))
+	}
+	g := Golden{Created: time.Now()}
+	for _, path := range fs.Args() {
+		r, err := loadResult(path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if r.StopReason == stopError {
+			return fmt.Errorf("%s: failed run, not a baseline", path)
+		}
+		if g.BeeVersion == "" && r.Node != nil {
+			g.BeeVersion = r.Node.Version
+		}
+		g.Experiments = append(g.Experiments, goldenExperiment(r))
+	}
+	b, err := json.MarshalIndent(g, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(*out, append(b, '\n'), 0666)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(console(), "wrote", *out, "experiments=", len(g.Experiments), "beeVersion=", g.BeeVersion)
+	return nil
+}
+
+func loadGolden(path string) (*Golden, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var g Golden
+	err = json.Unmarshal(b, &g)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return &g, nil
+}
+
+// checkBaseline compares the results with the golden runs of the same
+// experiments and fails with exitRegression when bytes to full or the
+// utilization per GiB moved by more than tolerance, relative.
+func checkBaseline(w io.Writer, g *Golden, tolerance float64, results []*Result) error {
+	golden := map[string]GoldenExperiment{}
+	for _, e := range g.Experiments {
+		golden[e.Name] = e
+	}
+	regressions, checked := 0, 0
+	check := func(exp, metric string, want, got float64, format func(float64) string) {
+		diff := relDiff(want, got)
+		status := "ok"
+		if math.IsNaN(diff) || math.Abs(diff) > tolerance {
+			status = "REGRESSION"
+			regressions++
+		}
+		log(w, "baseline experiment=", exp, " metric=", metric, " golden=", format(want), " got=", format(got), " diff=", fmt.Sprintf("%+.2f%%", diff*100), " ", status)
+	}
+	for _, r := range results {
+		want, ok := golden[r.Experiment.Name]
+		if !ok {
+			log(w, "baseline experiment=", r.Experiment.Name, " not in the baseline")
+			continue
+		}
+		if r.StopReason == stopError || r.StopReason == stopSkipped {
+			continue
+		}
+		checked++
+		got := goldenExperiment(r)
+		switch {
+		case want.BytesToFull > 0 && got.BytesToFull > 0:
+			check(r.Experiment.Name, "bytesToFull", float64(want.BytesToFull), float64(got.BytesToFull), func(v float64) string { return prettyByteSize(int(v)) })
+		case want.BytesToFull > 0 && r.StopReason == stopFull:
+			log(w, "baseline experiment=", r.Experiment.Name, " metric=bytesToFull golden=", prettyByteSize(want.BytesToFull), " got=- REGRESSION")
+			regressions++
+		}
+		// the utilization per GiB changes as the batch fills, compare at the
+		// bytes of the golden run when this one got as far
+		if u, ok := utilizationAt(r.Samples, want.Bytes); ok && want.Bytes > 0 {
+			got.UtilizationPerGiB = perGiB(u, want.Bytes)
+		}
+		check(r.Experiment.Name, "utilizationPerGiB", want.UtilizationPerGiB, got.UtilizationPerGiB, formatFloat)
+	}
+	log(w, "baseline beeVersion=", g.BeeVersion, " checked=", checked, " regressions=", regressions)
+	if regressions > 0 {
+		return withExitCode(exitRegression, fmt.Errorf("%d metrics deviate from the baseline by more than %s", regressions, formatFloat(tolerance*100)+"%"))
+	}
+	return nil
+}
+
+// checkGolden checks the results against the golden file into
+// baseline.log and the console.
+func checkGolden(g *Golden, tolerance float64, results []*Result) error {
+	f, err := os.Create(outPath(outName("baseline.log")))
+	if err != nil {
+		return fmt.Errorf("baseline log: %w", err)
+	}
+	defer f.Close()
+	return checkBaseline(io.MultiWriter(f, console()), g, tolerance, results)
+}
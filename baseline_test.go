@@ -0,0 +1,34 @@
+package main
+
+import (
+	"io"
+	"testing"
+)
+
+func TestCheckBaseline(t *testing.T) {
+	// slower fills the same batch with twice the bytes per chunk
+	slower := filledResult("a", 18, true)
+	for i := range slower.Samples {
+		slower.Samples[i].Bytes *= 2
+	}
+	tests := []struct {
+		name       string
+		result     *Result
+		regression bool
+	}{
+		{"same", filledResult("a", 18, true), false},
+		{"without capacities", filledResult("a", 18, false), false},
+		{"slower", slower, true},
+	}
+	golden := goldenExperiment(filledResult("a", 18, true))
+	if golden.BytesToFull != 4*chunkSize {
+		t.Fatalf("golden bytes to full %d, want the 4 chunks of a depth 18 batch", golden.BytesToFull)
+	}
+	g := &Golden{Experiments: []GoldenExperiment{golden}}
+	for _, tt := range tests {
+		err := checkBaseline(io.Discard, g, 0.05, []*Result{tt.result})
+		if got := exitCode(err) == exitRegression; got != tt.regression || !tt.regression && err != nil {
+			t.Errorf("%s: got %v, want a regression %v", tt.name, err, tt.regression)
+		}
+	}
+}
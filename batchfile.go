@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// readBatchIDs reads batch ids from path, or stdin for "-", one per line.
+// A line is either an id, given to the experiments in order, or an
+// experiment name and its id. Blank lines and # comments are skipped.
+func readBatchIDs(path string) ([][2]string, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	var ids [][2]string
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		var name, id string
+		switch len(fields) {
+		case 1:
+			id = fields[0]
+		case 2:
+			name, id = fields[0], fields[1]
+		default:
+			return nil, fmt.Errorf("line %d: want an id or a name and an id", n)
+		}
+		if !isBatchID(id) {
+			return nil, fmt.Errorf("line %d: %q is not 64 hex characters", n, id)
+		}
+		ids = append(ids, [2]string{name, id})
+	}
+	return ids, s.Err()
+}
+
+// withBatchIDs returns the config with the batch ids of the experiments
+// replaced by the ones read from path.
+func withBatchIDs(cfg Config, path string) (Config, error) {
+	ids, err := readBatchIDs(path)
+	if err != nil {
+		return Config{}, err
+	}
+	// don't change the experiments of defaultConfig
+	cfg.Experiments = append([]Experiment(nil), cfg.Experiments...)
+	next := 0
+	for _, id := range ids {
+		if id[0] != "" {
+			i := cfg.experiment(id[0])
+			if i < 0 {
+				return Config{}, fmt.Errorf("batch for unknown experiment %q", id[0])
+			}
+			cfg.Experiments[i].BatchID = id[1]
+			continue
+		}
+		if next == len(cfg.Experiments) {
+			return Config{}, fmt.Errorf("more batch ids than the %d experiments", len(cfg.Experiments))
+		}
+		cfg.Experiments[next].BatchID = id[1]
+		next++
+	}
+	if next > 0 && next < len(cfg.Experiments) {
+		return Config{}, fmt.Errorf("%d batch ids for %d experiments", next, len(cfg.Experiments))
+	}
+	return cfg, nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// Breaker keeps an experiment going through node failures. Failed uploads
+// are skipped, and after Failures of them in a row the breaker opens: the
+// uploads pause and the node's health is probed every Probe until it
+// recovers. With a Timeout the run gives up once the node stayed unhealthy
+// that long.
+type Breaker struct {
+	Failures int      `json:"failures"`
+	Probe    duration `json:"probe"`
+	Timeout  duration `json:"timeout"`
+}
+
+const (
+	defaultBreakerFailures = 3
+	defaultProbe           = 10 * time.Second
+)
+
+type breaker struct {
+	failures    int
+	probe       time.Duration
+	timeout     time.Duration
+	consecutive int
+}
+
+func newBreaker(b *Breaker) *breaker {
+	br := &breaker{
+		failures: b.Failures,
+		probe:    time.Duration(b.Probe),
+		timeout:  time.Duration(b.Timeout),
+	}
+	if br.failures <= 0 {
+		br.failures = defaultBreakerFailures
+	}
+	if br.probe <= 0 {
+		br.probe = defaultProbe
+	}
+	return br
+}
+
+// failure records a failed iteration and reports whether the breaker
+// opened.
+func (b *breaker) failure() bool {
+	b.consecutive++
+	return b.consecutive >= b.failures
+}
+
+func (b *breaker) success() {
+	b.consecutive = 0
+}
+
+// wait probes the node until it is healthy again. stopped is set when the
+// run was stopped meanwhile.
+func (b *breaker) wait(f io.Writer, c *Client, stop <-chan error) (stopped bool, err error) {
+	log(f, "breaker open failures=", b.consecutive, " probe=", b.probe)
+	opened := clock.Now()
+	for {
+		select {
+		case v := <-stop:
+			log(f, "stopping", v)
+			return true, nil
+		case <-clock.After(b.probe):
+		}
+		health, err := c.getHealth(c.debugURL)
+		if err == nil && health.Status == "ok" {
+			b.consecutive = 0
+			log(f, "breaker closed downtime=", since(opened).Round(time.Second))
+			return false, nil
+		}
+		if err == nil {
+			err = fmt.Errorf("status %q", health.Status)
+		}
+		log(f, "breaker probe: ", err)
+		systemd.alive()
+		if b.timeout > 0 && since(opened) >= b.timeout {
+			return false, fmt.Errorf("node unhealthy for %s: %w", b.timeout, err)
+		}
+	}
+}
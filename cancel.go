@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"time"
+)
+
+const (
+	defaultCancelAt = 0.5
+	// cancelSettle is how long the node gets to stamp what it received
+	// of a canceled upload before the buckets are counted.
+	cancelSettle = time.Second
+)
+
+// Cancel aborts a share of the uploads while their payload is being sent,
+// to measure what the partial uploads cost the batch.
+type Cancel struct {
+	// Percent of the uploads are canceled.
+	Percent float64 `json:"percent"`
+	// At is the fraction of the payload sent before the upload is
+	// canceled, 0.5 by default.
+	At float64 `json:"at"`
+}
+
+// CanceledUpload is one upload aborted mid-stream.
+type CanceledUpload struct {
+	Size int `json:"size"`
+	Sent int `json:"sent"`
+	// StampedChunks is how many chunks the batch buckets gained from the
+	// partial upload, ExpectedChunks what the full payload would take.
+	StampedChunks     int `json:"stampedChunks"`
+	ExpectedChunks    int `json:"expectedChunks"`
+	UtilizationBefore int `json:"utilizationBefore"`
+	UtilizationAfter  int `json:"utilizationAfter"`
+}
+
+// CancelReport sums up the canceled uploads of a run.
+type CancelReport struct {
+	Canceled      int              `json:"canceled"`
+	SentBytes     int              `json:"sentBytes"`
+	StampedChunks int              `json:"stampedChunks"`
+	Uploads       []CanceledUpload `json:"uploads"`
+}
+
+func (r *CancelReport) add(f io.Writer, u CanceledUpload) {
+	r.Canceled++
+	r.SentBytes += u.Sent
+	r.StampedChunks += u.StampedChunks
+	r.Uploads = append(r.Uploads, u)
+	log(f, "canceled upload size=", prettyByteSize(u.Size), " sent=", prettyByteSize(u.Sent), " stampedChunks=", u.StampedChunks,
+		" expectedChunks=", u.ExpectedChunks, " utilization=", u.UtilizationBefore, "->", u.UtilizationAfter)
+}
+
+func logCancel(f io.Writer, r *CancelReport) {
+	log(f, "cancel report canceled=", r.Canceled, " sent=", prettyByteSize(r.SentBytes), " stampedChunks=", r.StampedChunks,
+		" chunksPerSentChunk=", ratio(int64(r.StampedChunks), int64(r.SentBytes/chunkSize)))
+}
+
+func (c Cancel) due() bool {
+	return rand.Float64()*100 < c.Percent
+}
+
+type cancelKey struct{}
+
+// cancelPoint is where an upload in the context is canceled.
+type cancelPoint struct {
+	at     int
+	cancel context.CancelFunc
+}
+
+// withCancelAt returns a context whose upload body cancels it after n bytes.
+func withCancelAt(ctx context.Context, n int) context.Context {
+	ctx, cancel := context.WithCancel(ctx)
+	return context.WithValue(ctx, cancelKey{}, cancelPoint{at: n, cancel: cancel})
+}
+
+// uploadBody is the request body of payload, cut off where the context
+// says.
+func uploadBody(ctx context.Context, payload []byte) io.Reader {
+	p, ok := ctx.Value(cancelKey{}).(cancelPoint)
+	if !ok {
+		return bytes.NewReader(payload)
+	}
+	return &cancelingReader{r: bytes.NewReader(payload), left: p.at, cancel: p.cancel}
+}
+
+// cancelingReader cancels the upload once left bytes were read and fails
+// the rest of the body.
+type cancelingReader struct {
+	r      io.Reader
+	left   int
+	cancel context.CancelFunc
+}
+
+func (c *cancelingReader) Read(b []byte) (int, error) {
+	if c.left <= 0 {
+		c.cancel()
+		return 0, context.Canceled
+	}
+	if len(b) > c.left {
+		b = b[:c.left]
+	}
+	n, err := c.r.Read(b)
+	c.left -= n
+	return n, err
+}
+
+// stampedChunks counts the chunks stamped with the batch so far, the sum
+// of its bucket counters.
+func stampedChunks(c *Client, batchID string) (int, error) {
+	b, err := c.getBuckets(batchID)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, bucket := range b.Buckets {
+		n += bucket.Collisions
+	}
+	return n, nil
+}
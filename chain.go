@@ -0,0 +1,45 @@
+package main
+
+import (
+	"io"
+	"time"
+)
+
+// chainTracker follows the node's chain state for the block numbers of the
+// samples and logs price changes, to line up on-chain events with the
+// utilization. A fetched state is reused for a block time.
+type chainTracker struct {
+	c       *Client
+	state   *ChainState
+	fetched time.Time
+	failing bool
+}
+
+func newChainTracker(c *Client) *chainTracker {
+	return &chainTracker{c: c}
+}
+
+// block returns the current block number, 0 when the node doesn't tell.
+func (t *chainTracker) block(f io.Writer) uint64 {
+	if t.state != nil && since(t.fetched) < blockTime {
+		return t.state.Block
+	}
+	state, err := t.c.getChainState()
+	if err != nil {
+		// log once per outage
+		if !t.failing {
+			log(f, "chainstate: ", err)
+		}
+		t.failing = true
+		if t.state == nil {
+			return 0
+		}
+		return t.state.Block
+	}
+	t.failing = false
+	if t.state != nil && state.CurrentPrice != t.state.CurrentPrice {
+		log(f, "chain price changed block=", state.Block, " price=", t.state.CurrentPrice, "->", state.CurrentPrice)
+	}
+	t.state, t.fetched = state, clock.Now()
+	return state.Block
+}
@@ -0,0 +1,61 @@
+package main
+
+const (
+	chunkSize = 4096
+	refSize   = 32
+	spanSize  = 8
+	branches  = chunkSize / refSize
+)
+
+// estimateChunks returns the number of chunks a payload of the given size is
+// split into, counting the intermediate chunks of the trie. Encrypted
+// references carry a 32 byte key, so each intermediate chunk holds half as
+// many children.
+func estimateChunks(size int, encrypt bool) int {
+	b := branches
+	if encrypt {
+		b = branches / 2
+	}
+
+	n := (size + chunkSize - 1) / chunkSize
+	if n == 0 {
+		return 1
+	}
+	total := n
+	for n > 1 {
+		groups := (n + b - 1) / b
+		total += groups
+		// a single trailing reference is carried up a level, not wrapped
+		if n%b == 1 {
+			total--
+		}
+		n = groups
+	}
+	return total
+}
+
+const (
+	// alignChunk rounds payloads to whole data chunks.
+	alignChunk = "chunk"
+	// alignBranch rounds payloads to whole intermediate chunks, so neither
+	// the data chunks nor the first trie level are partly filled.
+	alignBranch = "branch"
+)
+
+// alignSize rounds size down to the alignment, keeping at least one unit.
+func alignSize(size int, align string, encrypt bool) int {
+	unit := 1
+	switch align {
+	case alignChunk:
+		unit = chunkSize
+	case alignBranch:
+		unit = chunkSize * branches
+		if encrypt {
+			unit /= 2
+		}
+	}
+	if size < unit {
+		return unit
+	}
+	return size - size%unit
+}
@@ -0,0 +1,51 @@
+package main
+
+import "testing"
+
+func TestEstimateChunks(t *testing.T) {
+	tests := []struct {
+		size    int
+		encrypt bool
+		want    int
+	}{
+		{0, false, 1},
+		{1, false, 1},
+		{chunkSize, false, 1},
+		{chunkSize + 1, false, 3},
+		{branches * chunkSize, false, branches + 1},
+		// the 129th data chunk is carried up to the root next to the
+		// first intermediate chunk
+		{branches*chunkSize + 1, false, branches + 1 + 1 + 1},
+		{branches * branches * chunkSize, false, branches*branches + branches + 1},
+		{chunkSize, true, 1},
+		{chunkSize + 1, true, 3},
+		{branches / 2 * chunkSize, true, branches/2 + 1},
+		{branches * chunkSize, true, branches + 2 + 1},
+	}
+	for _, tt := range tests {
+		if got := estimateChunks(tt.size, tt.encrypt); got != tt.want {
+			t.Errorf("estimateChunks(%d, %v) = %d, want %d", tt.size, tt.encrypt, got, tt.want)
+		}
+	}
+}
+
+func TestAlignSize(t *testing.T) {
+	tests := []struct {
+		size    int
+		align   string
+		encrypt bool
+		want    int
+	}{
+		{1000, "", false, 1000},
+		{1000, alignChunk, false, chunkSize},
+		{3*chunkSize + 100, alignChunk, false, 3 * chunkSize},
+		{100, alignBranch, false, branches * chunkSize},
+		{3*branches*chunkSize + 1, alignBranch, false, 3 * branches * chunkSize},
+		{3*branches*chunkSize + 1, alignBranch, true, 6 * branches / 2 * chunkSize},
+	}
+	for _, tt := range tests {
+		if got := alignSize(tt.size, tt.align, tt.encrypt); got != tt.want {
+			t.Errorf("alignSize(%d, %q, %v) = %d, want %d", tt.size, tt.align, tt.encrypt, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,539 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+var commands = []command{
+	{"run", "run the configured experiments", cmdRun},
+	{"buy", "buy a batch", cmdBuy},
+	{"topup", "top up a batch", cmdTopup},
+	{"dilute", "dilute a batch to a higher depth", cmdDilute},
+	{"status", "list the node's batches", cmdStatus},
+	{"watch", "poll batches without uploading", cmdWatch},
+	{"report", "write the comparison report of saved run results", cmdReport},
+	{"analyze", "reconstruct utilization series from experiment logs", analyze},
+	{"compare", "diff two saved runs against tolerances", diffRuns},
+	{"serve", "run the experiments and serve their status over HTTP", cmdServe},
+	{"presets", "list the built-in experiment presets or print one", cmdPresets},
+	{"script", "run a Starlark script against the node", cmdScript},
+	{"baseline", "write a golden baseline from saved run results", cmdBaseline},
+	{"plan", "recommend the batch depth and amount for a dataset", cmdPlan},
+	{"results", "query the runs of the results database", cmdResults},
+	{"dashboard", "write a Grafana dashboard of the Prometheus metrics", cmdDashboard},
+}
+
+// globalOptions are accepted before the command as well as after it.
+type globalOptions struct {
+	api      string
+	debugAPI string
+	// debugSet is whether -debug-api was given, bee 2.0 and later only
+	// serve the debug API on the API otherwise
+	debugSet bool
+	out      string
+	quiet    bool
+	verbose  bool
+	// gzip compresses the experiment logs, series and results
+	gzip bool
+	// resultsDB is the JSONL file every run appends its record to
+	resultsDB string
+}
+
+var global = globalOptions{
+	api:      "http://localhost:1635",
+	debugAPI: "http://localhost:1635",
+	out:      ".",
+}
+
+func (g *globalOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&g.api, "api", g.api, "Bee API URL used for uploads and tags")
+	fs.Func("debug-api", "Bee debug API `URL` used for stamps and chain state, the API URL on bee 2.0 and later unless given (default "+g.debugAPI+")", func(s string) error {
+		g.debugAPI, g.debugSet = s, true
+		return nil
+	})
+	fs.StringVar(&g.out, "out", g.out, "directory logs and results are written to")
+	fs.BoolVar(&g.quiet, "quiet", g.quiet, "only print the final summary and errors")
+	fs.BoolVar(&g.verbose, "verbose", g.verbose, "also print every experiment log record to stderr")
+	fs.BoolVar(&g.gzip, "gzip", g.gzip, "write experiment logs, series and results gzip compressed, as .log.gz, .ts.gz and .json.gz")
+	fs.StringVar(&g.resultsDB, "results-db", g.resultsDB, "append a record of every run to this JSONL results database, which plan learns from and results queries")
+}
+
+func (g *globalOptions) client() *Client {
+	c := newClient(g.api, g.debugAPI)
+	c.debugSet = g.debugSet
+	return c
+}
+
+func outPath(name string) string {
+	return filepath.Join(global.out, name)
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "usage: %s [global flags] <command> [flags]\n\ncommands:\n", filepath.Base(os.Args[0]))
+	for _, c := range commands {
+		fmt.Fprintf(out, "  %-9s %s\n", c.name, c.usage)
+	}
+	fmt.Fprintln(out, "\nglobal flags:")
+	flag.PrintDefaults()
+	fmt.Fprintln(out, "\nexit codes: 0 batch full, done or filled to -stop-at, 1 error, 2 usage, 3 config, 4 node unreachable, 5 batch expired, 6 byte limit reached, 7 baseline regression")
+}
+
+func main() {
+	global.register(flag.CommandLine)
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(exitUsage)
+	}
+
+	name := flag.Arg(0)
+	for _, c := range commands {
+		if c.name != name {
+			continue
+		}
+		err := os.MkdirAll(global.out, 0777)
+		if err == nil {
+			err = c.run(flag.Args()[1:])
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(exitCode(err))
+	}
+	fmt.Fprintf(flag.CommandLine.Output(), "unknown command %q\n", name)
+	usage()
+	os.Exit(exitUsage)
+}
+
+// newFlagSet returns the flag set of a command, including the global flags.
+func newFlagSet(name, args string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	global.register(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s %s\n", name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+type runOptions struct {
+	config   string
+	preset   string
+	batches  string
+	stopAt   percent
+	dev      bool
+	devImage string
+	nodes    string
+	nodesSRV string
+	nodesURL string
+	k8s      k8sDiscovery
+	// discoverEvery refreshes the node list while running
+	discoverEvery time.Duration
+	// checkBaseline is the golden file the results are checked against
+	checkBaseline     string
+	baselineTolerance float64
+	// timeScale runs the experiment clock faster than the wall clock
+	timeScale float64
+	backend   string
+	sim       simOptions
+	pprof     string
+	// metrics serves the Prometheus metrics of the experiments
+	metrics string
+}
+
+func (o *runOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.config, "config", "", "path to a JSON experiment config")
+	fs.StringVar(&o.preset, "preset", "", "run a built-in preset instead of a config, see the presets command")
+	fs.StringVar(&o.batches, "batch-file", "", "read the batch ids of the experiments from this file, - for stdin, one id or experiment name and id per line")
+	fs.Var(&o.stopAt, "stop-at", "end every experiment once the fullest bucket holds this share of the capacity, e.g. 50%")
+	fs.BoolVar(&o.dev, "dev", false, "start a Bee dev node in Docker, buy the batches on it and remove it afterwards")
+	fs.StringVar(&o.devImage, "dev-image", defaultDevImage, "Docker image used for -dev")
+	fs.StringVar(&o.nodes, "nodes", "", "path to a JSON node inventory to run the experiments on every node of")
+	fs.StringVar(&o.nodesSRV, "nodes-srv", "", "run on every node of these DNS SRV records, e.g. _bee._tcp.example.com")
+	fs.StringVar(&o.nodesURL, "nodes-url", "", "run on every node of the inventory served at this URL")
+	fs.DurationVar(&o.discoverEvery, "discover-every", 0, "rediscover the nodes at this interval, starting the experiments on new nodes and stopping them on gone ones")
+	fs.StringVar(&o.k8s.Selector, "k8s-selector", "", "run on every ready bee pod matching this label selector")
+	fs.StringVar(&o.k8s.Service, "k8s-service", "", "run on every ready pod behind this service")
+	fs.StringVar(&o.k8s.Namespace, "k8s-namespace", "", "namespace of the bee pods, defaults to the tool's own")
+	fs.IntVar(&o.k8s.APIPort, "k8s-api-port", 1633, "API port of the bee pods")
+	fs.IntVar(&o.k8s.DebugPort, "k8s-debug-port", 1635, "debug API port of the bee pods")
+	fs.StringVar(&o.checkBaseline, "check-baseline", "", "fail with exit code 7 when the results deviate from this golden file, see the baseline command")
+	fs.Float64Var(&o.baselineTolerance, "baseline-tolerance", 0.05, "allowed relative deviation from the baseline")
+	fs.Float64Var(&o.timeScale, "time-scale", 1, "run the experiment clock this many times faster than the wall clock, to simulate long runs against a fake node")
+	fs.StringVar(&o.backend, "backend", backendBee, "run against a bee node or sim, a node simulated in the process")
+	o.sim.register(fs)
+	fs.StringVar(&o.pprof, "pprof", "", "serve pprof profiles of the tool on this address, e.g. localhost:6060")
+	fs.StringVar(&o.metrics, "metrics-addr", "", "serve the Prometheus metrics of the experiments on this address, e.g. localhost:9090, see the dashboard command")
+}
+
+// discovery returns what finds the nodes to run on, nil to run on the
+// -api node.
+func (o runOptions) discovery() func() (Inventory, error) {
+	switch {
+	case o.nodes != "":
+		return func() (Inventory, error) {
+			return loadInventory(o.nodes)
+		}
+	case o.nodesSRV != "":
+		return func() (Inventory, error) {
+			return lookupSRVNodes(o.nodesSRV)
+		}
+	case o.nodesURL != "":
+		return func() (Inventory, error) {
+			return fetchNodes(o.nodesURL)
+		}
+	case o.k8s.Selector != "" || o.k8s.Service != "":
+		return func() (Inventory, error) {
+			return discoverNodes(o.k8s)
+		}
+	}
+	return nil
+}
+
+func cmdRun(args []string) error {
+	fs := newFlagSet("run", "[flags]")
+	var o runOptions
+	o.register(fs)
+	fs.Parse(args)
+	return runWith(o)
+}
+
+func runWith(o runOptions) error {
+	if o.pprof != "" {
+		startPprof(o.pprof)
+	}
+	if o.metrics != "" {
+		startMetrics(o.metrics)
+	}
+	if o.timeScale <= 0 {
+		return withExitCode(exitUsage, fmt.Errorf("-time-scale must be positive"))
+	}
+	if o.timeScale != 1 {
+		clock = newScaledClock(o.timeScale)
+	}
+	switch o.backend {
+	case backendBee:
+	case backendSim:
+		if o.dev || o.discovery() != nil {
+			return withExitCode(exitUsage, fmt.Errorf("-backend sim runs without nodes, drop -dev and the node lists"))
+		}
+		err := o.sim.validate()
+		if err != nil {
+			return withExitCode(exitUsage, err)
+		}
+		nodeTransport = newSimNode(o.sim)
+		global.api, global.debugAPI = simURL, simURL
+	default:
+		return withExitCode(exitUsage, fmt.Errorf("-backend: unknown backend %q", o.backend))
+	}
+	cfg, err := o.loadConfig()
+	if err != nil {
+		return err
+	}
+	if o.backend == backendSim {
+		err = simCheck(cfg.Experiments)
+		if err != nil {
+			return err
+		}
+	}
+	var golden *Golden
+	if o.checkBaseline != "" {
+		golden, err = loadGolden(o.checkBaseline)
+		if err != nil {
+			return withExitCode(exitConfig, fmt.Errorf("baseline: %w", err))
+		}
+	}
+
+	combined, err = openLog(outPath(outName("combined.log")))
+	if err != nil {
+		return fmt.Errorf("open combined log: %w", err)
+	}
+	defer func() {
+		combined.Close()
+		combined = nil
+	}()
+	tracer.start()
+	defer tracer.shutdown()
+
+	if discover := o.discovery(); discover != nil {
+		if o.discoverEvery > 0 {
+			return followCluster(discover, o.discoverEvery, cfg)
+		}
+		inv, err := discover()
+		if err != nil {
+			return fmt.Errorf("discover nodes: %w", err)
+		}
+		return runCluster(inv, cfg)
+	}
+
+	if o.dev {
+		node, err := startDevNode(o.devImage)
+		if err != nil {
+			return fmt.Errorf("start dev node: %w", err)
+		}
+		defer node.stop()
+		global.api, global.debugAPI = node.apiURL, node.debugURL
+		cfg.Experiments = append([]Experiment(nil), cfg.Experiments...)
+		for i, e := range cfg.Experiments {
+			if e.Docker != nil && e.Docker.Container == "" {
+				d := *e.Docker
+				d.Container = node.container
+				cfg.Experiments[i].Docker = &d
+			}
+		}
+	}
+
+	c := global.client()
+	err = prepareNode(c, cfg.Experiments)
+	if err != nil {
+		return err
+	}
+
+	if o.dev {
+		err = buyBatches(c, cfg.Experiments)
+	} else {
+		err = buyMissingBatches(c, cfg.Experiments)
+	}
+	if err != nil {
+		return err
+	}
+	err = checkBatches(c, cfg.Experiments)
+	if err != nil {
+		return err
+	}
+
+	results := runExperiments(c, cfg.Experiments)
+	err = writeComparison(cfg, results)
+	if err != nil {
+		return err
+	}
+	err = writeSummaries(os.Stdout, results)
+	if err != nil {
+		return err
+	}
+	err = printOutcomes(console(), results)
+	if golden == nil {
+		return err
+	}
+	regression := checkGolden(golden, o.baselineTolerance, results)
+	// a failed run outranks a regression, hitting the byte limit doesn't
+	if regression != nil && (err == nil || exitCode(err) == exitMaxBytes) {
+		return regression
+	}
+	return err
+}
+
+// loadConfig loads the config or preset of the options and applies the
+// batch file and -stop-at.
+func (o runOptions) loadConfig() (Config, error) {
+	cfg := defaultConfig
+	var err error
+	switch {
+	case o.config != "" && o.preset != "":
+		return cfg, withExitCode(exitUsage, fmt.Errorf("-config and -preset are exclusive"))
+	case o.config != "":
+		cfg, err = loadConfig(o.config)
+		if err != nil {
+			return cfg, withExitCode(exitConfig, fmt.Errorf("load config: %w", err))
+		}
+	case o.preset != "":
+		cfg, err = loadPreset(o.preset)
+		if err != nil {
+			return cfg, withExitCode(exitConfig, err)
+		}
+	}
+	if o.batches == "-" {
+		for _, e := range cfg.Experiments {
+			if e.Source != nil && e.Source.Stdin != nil {
+				return cfg, withExitCode(exitUsage, fmt.Errorf("-batch-file -: %s reads stdin", e.Name))
+			}
+		}
+	}
+	if o.batches != "" {
+		cfg, err = withBatchIDs(cfg, o.batches)
+		if err != nil {
+			return cfg, withExitCode(exitConfig, fmt.Errorf("batch file: %w", err))
+		}
+	}
+	if o.stopAt > 0 {
+		// don't change the experiments of defaultConfig
+		cfg.Experiments = append([]Experiment(nil), cfg.Experiments...)
+		for i := range cfg.Experiments {
+			if cfg.Experiments[i].Soak {
+				return cfg, withExitCode(exitUsage, fmt.Errorf("-stop-at: %s is a soak run", cfg.Experiments[i].Name))
+			}
+			cfg.Experiments[i].StopAt = o.stopAt
+		}
+	}
+	return cfg, nil
+}
+
+func cmdBuy(args []string) error {
+	fs := newFlagSet("buy", "[flags]")
+	spec := defaultBatchSpec
+	fs.StringVar(&spec.Amount, "amount", spec.Amount, "amount per chunk in PLUR")
+	fs.IntVar(&spec.Depth, "depth", spec.Depth, "batch depth")
+	fs.BoolVar(&spec.Immutable, "immutable", spec.Immutable, "buy an immutable batch")
+	fs.Parse(args)
+
+	id, err := global.client().buyStamp(spec.Amount, spec.Depth, spec.Immutable)
+	if err != nil {
+		return fmt.Errorf("buy stamp: %w", err)
+	}
+	fmt.Println(id)
+	return nil
+}
+
+func cmdTopup(args []string) error {
+	fs := newFlagSet("topup", "[flags] <batch id>")
+	amount := fs.String("amount", "", "amount per chunk to add in PLUR")
+	fs.Parse(args)
+	if fs.NArg() != 1 || *amount == "" {
+		fs.Usage()
+		return fmt.Errorf("need a batch id and amount")
+	}
+	err := global.client().topupStamp(fs.Arg(0), *amount)
+	if err != nil {
+		return fmt.Errorf("top up: %w", err)
+	}
+	return nil
+}
+
+func cmdDilute(args []string) error {
+	fs := newFlagSet("dilute", "[flags] <batch id>")
+	depth := fs.Int("depth", 0, "new batch depth")
+	fs.Parse(args)
+	if fs.NArg() != 1 || *depth == 0 {
+		fs.Usage()
+		return fmt.Errorf("need a batch id and depth")
+	}
+	err := global.client().diluteStamp(fs.Arg(0), *depth)
+	if err != nil {
+		return fmt.Errorf("dilute: %w", err)
+	}
+	return nil
+}
+
+func cmdStatus(args []string) error {
+	fs := newFlagSet("status", "[flags]")
+	fs.Parse(args)
+
+	stamps, err := global.client().getStamps()
+	if err != nil {
+		return fmt.Errorf("get stamps: %w", err)
+	}
+	sort.Slice(stamps, func(i, j int) bool { return stamps[i].BatchID < stamps[j].BatchID })
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "BATCH\tDEPTH\tBUCKET DEPTH\tUTILIZATION\tCAPACITY\tTTL\tUSABLE\tEXPIRED\tIMMUTABLE")
+	for _, b := range stamps {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d/%d\t%.1f%%\t%s\t%t\t%t\t%t\n",
+			b.BatchID, b.Depth, b.BucketDepth, b.Utilization, b.capacity(),
+			100*float64(b.Utilization)/float64(b.capacity()),
+			time.Duration(b.TTL)*time.Second, b.Usable, b.Expired, b.Immutable)
+	}
+	return tw.Flush()
+}
+
+func cmdReport(args []string) error {
+	fs := newFlagSet("report", "[flags] result.json...")
+	baseline := fs.String("baseline", "", "experiment the others are compared against, defaults to the first")
+	fs.Parse(args)
+	if fs.NArg() < 2 {
+		fs.Usage()
+		return fmt.Errorf("need at least two run results")
+	}
+
+	var cfg Config
+	var results []*Result
+	for _, path := range fs.Args() {
+		r, err := loadResult(path)
+		if err != nil {
+			return err
+		}
+		cfg.Experiments = append(cfg.Experiments, r.Experiment)
+		results = append(results, r)
+	}
+	cfg.Baseline = *baseline
+	if cfg.Baseline == "" {
+		cfg.Baseline = cfg.Experiments[0].Name
+	}
+	base := cfg.experiment(cfg.Baseline)
+	if base < 0 {
+		return fmt.Errorf("baseline %q is not among the results", cfg.Baseline)
+	}
+	for i, r := range results {
+		if i != base {
+			compare(os.Stdout, r.Experiment.Name, r.Samples, cfg.Baseline, results[base].Samples)
+		}
+	}
+	logEncryptionOverhead(os.Stdout, results)
+	for _, r := range results {
+		if r.Overflow != nil {
+			logOverflow(os.Stdout, r.Experiment.Name, r.Overflow)
+		}
+	}
+	for _, r := range results {
+		if len(r.Steps) > 0 {
+			err := writeSteps(os.Stdout, r.Experiment.Name, r.Steps)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func cmdServe(args []string) error {
+	fs := newFlagSet("serve", "[flags]")
+	addr := fs.String("addr", ":8080", "address the status and control API listens on")
+	var o runOptions
+	o.register(fs)
+	fs.Parse(args)
+
+	mux := http.NewServeMux()
+	mux.Handle("/experiments", board)
+	mux.HandleFunc("/experiments/", control)
+	mux.HandleFunc("/metrics", board.metrics)
+	srv := &http.Server{Handler: mux}
+	ln, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return err
+	}
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.Serve(ln)
+	}()
+	systemd.ready()
+	systemd.status("running experiments")
+	if o.config != "" {
+		go watchConfig(o)
+	}
+
+	err = runWith(o)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		systemd.status("experiments failed: " + err.Error())
+	} else {
+		systemd.status("experiments finished")
+	}
+	go systemd.keepalive()
+	// keep serving the final state until the daemon is stopped
+	return <-errc
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// Client talks to a single Bee node. Data-plane calls go to the API, stamp
+// and chain queries to the debug API, which some deployments expose on a
+// separate port.
+type Client struct {
+	apiURL   string
+	debugURL string
+	// debugSet keeps debugURL on nodes that serve the debug API on the API
+	debugSet bool
+	http     *http.Client
+	// version of the node, set by detectVersion
+	version version
+}
+
+func newClient(apiURL, debugURL string) *Client {
+	return &Client{
+		apiURL:   apiURL,
+		debugURL: debugURL,
+		http:     &http.Client{Transport: nodeTransport},
+	}
+}
+
+type Batch struct {
+	BatchID     string `json:"batchID"`
+	Utilization int    `json:"utilization"`
+	Expired     bool   `json:"expired"`
+	Usable      bool   `json:"usable"`
+	Depth       int    `json:"depth"`
+	BucketDepth int    `json:"bucketDepth"`
+	Immutable   bool   `json:"immutableFlag"`
+	Amount      string `json:"amount"`
+	// TTL is the batch's remaining time to live in seconds.
+	TTL int64 `json:"batchTTL"`
+}
+
+// capacity is the number of chunks a single bucket of the batch holds, the
+// utilization at which the batch is full.
+func (b *Batch) capacity() int {
+	return 1 << (b.Depth - b.BucketDepth)
+}
+
+// full reports whether the fullest bucket reached the capacity, assuming
+// the default depths when the node didn't report any.
+func (b *Batch) full() bool {
+	if b.Depth == 0 {
+		return b.Utilization >= fullUtilization
+	}
+	return b.Utilization >= b.capacity()
+}
+
+type Buckets struct {
+	Depth       int `json:"depth"`
+	BucketDepth int `json:"bucketDepth"`
+	Buckets     []struct {
+		BucketID   int `json:"bucketID"`
+		Collisions int `json:"collisions"`
+	} `json:"buckets"`
+}
+
+func (c *Client) getStamp(batchID string) (*Batch, error) {
+	req, err := http.NewRequest(http.MethodGet, c.debugURL+"/stamps/"+batchID, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.http.Do(req)
+	if err != nil {
+		fmt.Fprintln(console(), err)
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		fmt.Fprintln(console(), err)
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, &statusError{code: res.StatusCode, body: string(body)}
+	}
+
+	var batch Batch
+	err = json.Unmarshal(body, &batch)
+	if err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+func (c *Client) getBuckets(batchID string) (*Buckets, error) {
+	req, err := http.NewRequest(http.MethodGet, c.debugURL+"/stamps/"+batchID+"/buckets", nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, &statusError{code: res.StatusCode, body: string(body)}
+	}
+
+	var buckets Buckets
+	err = json.Unmarshal(body, &buckets)
+	if err != nil {
+		return nil, err
+	}
+	return &buckets, nil
+}
+
+// buyStamp buys a batch and returns its id. The node only answers once the
+// purchase transaction is mined; the batch becomes usable a few blocks later.
+func (c *Client) buyStamp(amount string, depth int, immutable bool) (string, error) {
+	req, err := http.NewRequest(http.MethodPost, c.debugURL+"/stamps/"+amount+"/"+strconv.Itoa(depth), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Add("Immutable", strconv.FormatBool(immutable))
+	res, err := c.http.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+	if res.StatusCode != http.StatusCreated && res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %d: %s", res.StatusCode, body)
+	}
+
+	var batch Batch
+	err = json.Unmarshal(body, &batch)
+	if err != nil {
+		return "", err
+	}
+	return batch.BatchID, nil
+}
+
+func (c *Client) topupStamp(batchID, amount string) error {
+	return c.patchStamp("/stamps/topup/" + batchID + "/" + amount)
+}
+
+func (c *Client) diluteStamp(batchID string, depth int) error {
+	return c.patchStamp("/stamps/dilute/" + batchID + "/" + strconv.Itoa(depth))
+}
+
+func (c *Client) patchStamp(path string) error {
+	req, err := http.NewRequest(http.MethodPatch, c.debugURL+path, nil)
+	if err != nil {
+		return err
+	}
+	res, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusAccepted && res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d: %s", res.StatusCode, body)
+	}
+	return nil
+}
+
+func (c *Client) getStamps() ([]Batch, error) {
+	req, err := http.NewRequest(http.MethodGet, c.debugURL+"/stamps", nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d: %s", res.StatusCode, body)
+	}
+
+	var stamps struct {
+		Stamps []Batch `json:"stamps"`
+	}
+	err = json.Unmarshal(body, &stamps)
+	if err != nil {
+		return nil, err
+	}
+	return stamps.Stamps, nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStampLookupsReportTheStatus(t *testing.T) {
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"code":404,"message":"issuer does not exist"}`))
+	}))
+	defer node.Close()
+	c := newClient(node.URL, node.URL)
+
+	_, err := c.getStamp("unknown")
+	if statusCode(err) != http.StatusNotFound {
+		t.Errorf("getStamp: got %v, want a 404 status error", err)
+	}
+	_, err = c.getBuckets("unknown")
+	if statusCode(err) != http.StatusNotFound {
+		t.Errorf("getBuckets: got %v, want a 404 status error", err)
+	}
+	err = checkBatches(c, []Experiment{{Name: "a", BatchID: "unknown"}})
+	if exitCode(err) != exitConfig {
+		t.Errorf("checkBatches: got %v, want a config error", err)
+	}
+}
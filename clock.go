@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Clock is the time the experiment logic runs on: sleeps, tickers,
+// timeouts and the timestamps of logs and samples. Talking to the node,
+// writing files and the tool's own housekeeping stay on the wall clock.
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+	After(d time.Duration) <-chan time.Time
+	NewTicker(d time.Duration) *Ticker
+	WithTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc)
+}
+
+var clock Clock = wallClock{}
+
+// Ticker is a time.Ticker whose ticks carry the time of the clock that made
+// it.
+type Ticker struct {
+	C    <-chan time.Time
+	stop func()
+}
+
+func (t *Ticker) Stop() {
+	t.stop()
+}
+
+func since(t time.Time) time.Duration {
+	return clock.Now().Sub(t)
+}
+
+func until(t time.Time) time.Duration {
+	return t.Sub(clock.Now())
+}
+
+type wallClock struct{}
+
+func (wallClock) Now() time.Time                         { return time.Now() }
+func (wallClock) Sleep(d time.Duration)                  { time.Sleep(d) }
+func (wallClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (wallClock) NewTicker(d time.Duration) *Ticker {
+	t := time.NewTicker(d)
+	return &Ticker{C: t.C, stop: t.Stop}
+}
+
+func (wallClock) WithTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, d)
+}
+
+// scaledClock runs scale times faster than the wall clock, so hours of
+// polling, stall detection and TTL handling pass in minutes against a fake
+// node. Durations read off it are simulated time.
+type scaledClock struct {
+	start time.Time
+	scale float64
+}
+
+func newScaledClock(scale float64) *scaledClock {
+	return &scaledClock{start: time.Now(), scale: scale}
+}
+
+func (c *scaledClock) Now() time.Time {
+	return c.start.Add(time.Duration(float64(time.Since(c.start)) * c.scale))
+}
+
+// wall is how long d takes on the wall clock.
+func (c *scaledClock) wall(d time.Duration) time.Duration {
+	w := time.Duration(float64(d) / c.scale)
+	if d > 0 && w <= 0 {
+		w = 1
+	}
+	return w
+}
+
+func (c *scaledClock) Sleep(d time.Duration) {
+	time.Sleep(c.wall(d))
+}
+
+func (c *scaledClock) After(d time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	time.AfterFunc(c.wall(d), func() {
+		ch <- c.Now()
+	})
+	return ch
+}
+
+// NewTicker ticks every d of simulated time. Like a time.Ticker it drops
+// the ticks a slow receiver misses.
+func (c *scaledClock) NewTicker(d time.Duration) *Ticker {
+	t := time.NewTicker(c.wall(d))
+	ch := make(chan time.Time, 1)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+			}
+			select {
+			case ch <- c.Now():
+			default:
+			}
+		}
+	}()
+	var once sync.Once
+	return &Ticker{C: ch, stop: func() {
+		once.Do(func() {
+			t.Stop()
+			close(done)
+		})
+	}}
+}
+
+func (c *scaledClock) WithTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, c.wall(d))
+}
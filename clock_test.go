@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock only moves when the test advances it, firing the timers and
+// tickers that came due.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	at    time.Time
+	every time.Duration
+	ch    chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+// useClock swaps the global clock for the duration of the test.
+func useClock(t *testing.T, c Clock) {
+	old := clock
+	clock = c
+	t.Cleanup(func() { clock = old })
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Sleep(d time.Duration) { <-c.After(d) }
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	return c.add(d, 0).ch
+}
+
+func (c *fakeClock) NewTicker(d time.Duration) *Ticker {
+	ft := c.add(d, d)
+	return &Ticker{C: ft.ch, stop: func() { c.remove(ft) }}
+}
+
+func (c *fakeClock) WithTimeout(ctx context.Context, _ time.Duration) (context.Context, context.CancelFunc) {
+	return context.WithCancel(ctx)
+}
+
+func (c *fakeClock) add(d, every time.Duration) *fakeTimer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ft := &fakeTimer{at: c.now.Add(d), every: every, ch: make(chan time.Time, 1)}
+	if d <= 0 {
+		ft.ch <- c.now
+		return ft
+	}
+	c.timers = append(c.timers, ft)
+	return ft
+}
+
+func (c *fakeClock) remove(ft *fakeTimer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, t := range c.timers {
+		if t == ft {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return
+		}
+	}
+}
+
+// waiting is how many timers and tickers are pending.
+func (c *fakeClock) waiting() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	pending := c.timers[:0]
+	for _, t := range c.timers {
+		if t.at.After(c.now) {
+			pending = append(pending, t)
+			continue
+		}
+		select {
+		case t.ch <- c.now:
+		default:
+		}
+		if t.every > 0 {
+			for !t.at.After(c.now) {
+				t.at = t.at.Add(t.every)
+			}
+			pending = append(pending, t)
+		}
+	}
+	c.timers = pending
+}
+
+// eventually fails the test unless cond holds within a second of wall
+// clock time.
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func newSimClient(t *testing.T, opts simOptions) (*Client, *simNode) {
+	s := newSimNode(opts)
+	old := nodeTransport
+	nodeTransport = s
+	t.Cleanup(func() { nodeTransport = old })
+	return newClient(simURL, simURL), s
+}
+
+func TestScaledClockTicksCarrySimulatedTime(t *testing.T) {
+	c := newScaledClock(3600)
+	start := c.Now()
+	at := <-c.After(time.Minute)
+	if d := at.Sub(start); d < time.Minute {
+		t.Errorf("After delivered %v into the run, want at least 1m of simulated time", d)
+	}
+	tk := c.NewTicker(time.Minute)
+	defer tk.Stop()
+	first := <-tk.C
+	second := <-tk.C
+	if d := second.Sub(first); d < 30*time.Second {
+		t.Errorf("ticks %v apart, want about 1m of simulated time", d)
+	}
+}
+
+func TestStampPollerPollsOnTheClock(t *testing.T) {
+	fc := newFakeClock()
+	useClock(t, fc)
+	c, sim := newSimClient(t, simOptions{depth: 20, bucketDepth: 16, buckets: simEven})
+	batch, err := c.getStamp("aa")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := newStampPoller(c, &Poll{Interval: duration(time.Minute)}, nil, batch)
+	defer p.stop()
+	eventually(t, "the poll ticker", func() bool { return fc.waiting() == 1 })
+
+	sim.mu.Lock()
+	sim.batch("aa").Utilization = 7
+	sim.mu.Unlock()
+	fc.advance(30 * time.Second)
+	time.Sleep(10 * time.Millisecond)
+	if got := p.latest().Utilization; got != 0 {
+		t.Fatalf("polled before the interval: utilization %d", got)
+	}
+	fc.advance(30 * time.Second)
+	eventually(t, "the interval poll", func() bool { return p.latest().Utilization == 7 })
+}
+
+func TestSimBatchExpiresWithTheClock(t *testing.T) {
+	fc := newFakeClock()
+	useClock(t, fc)
+	c, _ := newSimClient(t, simOptions{depth: 20, bucketDepth: 16, buckets: simEven, ttl: time.Hour})
+	start := fc.Now()
+	id, err := c.buyStamp("1000", 20, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		after   time.Duration
+		ttl     int64
+		expired bool
+	}{
+		{0, 3600, false},
+		{59 * time.Minute, 60, false},
+		{time.Minute, 0, true},
+		{time.Hour, 0, true},
+	}
+	for _, tt := range tests {
+		fc.advance(tt.after)
+		b, err := c.getStamp(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b.TTL != tt.ttl || b.Expired != tt.expired || b.Usable == tt.expired {
+			t.Errorf("at %v: ttl=%d expired=%v usable=%v, want ttl=%d expired=%v", fc.Now().Sub(start), b.TTL, b.Expired, b.Usable, tt.ttl, tt.expired)
+		}
+	}
+	req, _ := http.NewRequest(http.MethodPost, simURL+"/bytes", bytes.NewReader(make([]byte, chunkSize)))
+	req.Header.Set("Swarm-Postage-Batch-Id", id)
+	res, err := c.http.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("upload to an expired batch: status %d, want 400", res.StatusCode)
+	}
+}
+
+func TestPredictFullOnTheClock(t *testing.T) {
+	fc := newFakeClock()
+	useClock(t, fc)
+	// sample records the curve at the clock and moves it a minute on
+	var samples []Sample
+	sample := func(bytes, utilization int) {
+		samples = append(samples, Sample{Time: clock.Now(), Bytes: bytes, Utilization: utilization})
+		fc.advance(time.Minute)
+	}
+
+	if _, _, ok := predictFull(samples, 64); ok {
+		t.Error("predicted without samples")
+	}
+	sample(0, 0)
+	if _, _, ok := predictFull(samples, 64); ok {
+		t.Error("predicted from one sample")
+	}
+	for i := 1; i <= 8; i++ {
+		sample(i<<10, i)
+	}
+	bytesLeft, timeLeft, ok := predictFull(samples, 64)
+	if !ok || bytesLeft != 56<<10 || timeLeft != 56*time.Minute {
+		t.Errorf("got bytesLeft=%d timeLeft=%v ok=%v, want %d 56m0s true", bytesLeft, timeLeft, ok, 56<<10)
+	}
+
+	// the fit only covers the recent steps, the rate slowed to half
+	for i := 1; i <= 8; i++ {
+		sample(8<<10+i<<11, 8+i)
+	}
+	bytesLeft, timeLeft, ok = predictFull(samples, 64)
+	if !ok || bytesLeft != 48<<11 || timeLeft != 48*time.Minute {
+		t.Errorf("got bytesLeft=%d timeLeft=%v ok=%v, want %d 48m0s true", bytesLeft, timeLeft, ok, 48<<11)
+	}
+
+	flat := []Sample{{Time: fc.Now(), Bytes: 0, Utilization: 3}, {Time: fc.Now().Add(time.Minute), Bytes: 1 << 10, Utilization: 3}}
+	if _, _, ok := predictFull(flat, 64); ok {
+		t.Error("predicted from a flat curve")
+	}
+}
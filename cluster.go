@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// Inventory lists the nodes of a cluster to run the experiments on.
+type Inventory struct {
+	Nodes []Node `json:"nodes"`
+}
+
+type Node struct {
+	Name     string `json:"name"`
+	API      string `json:"api"`
+	DebugAPI string `json:"debugAPI"`
+	// Batches maps experiment names to the node's batch for it. Experiments
+	// without a batch here get one bought from their buy spec.
+	Batches map[string]string `json:"batches"`
+}
+
+func loadInventory(path string) (Inventory, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Inventory{}, err
+	}
+	return parseInventory(path, b)
+}
+
+// parseInventory reads an inventory and fills in the debug APIs.
+func parseInventory(source string, b []byte) (Inventory, error) {
+	var inv Inventory
+	err := json.Unmarshal(b, &inv)
+	if err != nil {
+		return Inventory{}, fmt.Errorf("parse %s: %w", source, err)
+	}
+	if len(inv.Nodes) == 0 {
+		return Inventory{}, fmt.Errorf("%s: no nodes", source)
+	}
+	for i := range inv.Nodes {
+		n := &inv.Nodes[i]
+		if n.Name == "" || n.API == "" {
+			return Inventory{}, fmt.Errorf("%s: node %d needs a name and api", source, i)
+		}
+		if n.DebugAPI == "" {
+			n.DebugAPI = n.API
+		}
+	}
+	return inv, nil
+}
+
+// nodeConfig returns the experiments as run on the node, named after it so
+// their logs don't collide.
+func nodeConfig(c *Client, node Node, cfg Config) (Config, error) {
+	nc := Config{Baseline: node.Name + "-" + cfg.Baseline}
+	for _, exp := range cfg.Experiments {
+		id, ok := node.Batches[exp.Name]
+		exp.Name = node.Name + "-" + exp.Name
+		switch {
+		case ok:
+			exp.BatchID = id
+		case exp.Buy != nil:
+			var err error
+			exp.BatchID, err = c.buyStamp(exp.Buy.Amount, exp.Buy.Depth, exp.Buy.Immutable)
+			if err != nil {
+				return Config{}, fmt.Errorf("%s: buy stamp: %w", exp.Name, err)
+			}
+			fmt.Fprintln(console(), exp.Name, "bought batch", exp.BatchID)
+		default:
+			return Config{}, fmt.Errorf("%s: no batch for the node and no buy spec", exp.Name)
+		}
+		nc.Experiments = append(nc.Experiments, exp)
+	}
+	return nc, nil
+}
+
+type nodeResult struct {
+	cfg     Config
+	results []*Result
+	err     error
+}
+
+// runCluster runs the experiments on every node of the inventory at once and
+// writes a report aggregating them per experiment.
+func runCluster(inv Inventory, cfg Config) error {
+	out := make([]nodeResult, len(inv.Nodes))
+	var wg sync.WaitGroup
+	wg.Add(len(inv.Nodes))
+	for i, node := range inv.Nodes {
+		i, node := i, node
+		go func() {
+			defer wg.Done()
+			out[i] = runNode(node, cfg, nil)
+		}()
+	}
+	wg.Wait()
+	return finishCluster(inv, cfg, out)
+}
+
+// runNode runs the experiments on one node, stopping them when quit is
+// closed.
+func runNode(node Node, cfg Config, quit <-chan struct{}) nodeResult {
+	c := newClient(node.API, node.DebugAPI)
+	err := prepareNode(c, cfg.Experiments)
+	if err != nil {
+		return nodeResult{err: fmt.Errorf("%s: %w", node.Name, err)}
+	}
+	nc, err := nodeConfig(c, node, cfg)
+	if err != nil {
+		return nodeResult{err: fmt.Errorf("%s: %w", node.Name, err)}
+	}
+	err = checkBatches(c, nc.Experiments)
+	if err != nil {
+		return nodeResult{err: fmt.Errorf("%s: %w", node.Name, err)}
+	}
+	r := nodeResult{cfg: nc}
+	r.results = runExperimentsUntil(c, nc.Experiments, quit)
+	r.err = writeComparison(nc, r.results)
+	return r
+}
+
+// finishCluster writes the cluster report and the summaries of the nodes'
+// runs.
+func finishCluster(inv Inventory, cfg Config, out []nodeResult) error {
+	var results []*Result
+	nodeErrs, unreachable := 0, 0
+	for _, r := range out {
+		if r.err != nil {
+			fmt.Fprintln(console(), r.err)
+			nodeErrs++
+			if exitCode(r.err) == exitUnreachable {
+				unreachable++
+			}
+		}
+		results = append(results, r.results...)
+	}
+
+	f, err := os.OpenFile(outPath("cluster.log"), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return fmt.Errorf("error opening file: %v", err)
+	}
+	defer f.Close()
+	clusterReport(f, inv, cfg, out)
+	err = writeSummaries(os.Stdout, results)
+	if err != nil {
+		return err
+	}
+	err = printOutcomes(console(), results)
+	if err != nil {
+		return err
+	}
+	if nodeErrs > 0 {
+		code := exitError
+		if unreachable == nodeErrs {
+			code = exitUnreachable
+		}
+		return withExitCode(code, fmt.Errorf("%d of %d nodes failed", nodeErrs, len(inv.Nodes)))
+	}
+	return nil
+}
+
+func clusterReport(f io.Writer, inv Inventory, cfg Config, out []nodeResult) {
+	log(f, "cluster nodes=", len(inv.Nodes))
+	for i, node := range inv.Nodes {
+		if out[i].err != nil {
+			log(f, "node=", node.Name, " error=", out[i].err)
+			continue
+		}
+		for j, exp := range cfg.Experiments {
+			r := out[i].results[j]
+			var last Sample
+			if len(r.Samples) > 0 {
+				last = r.Samples[len(r.Samples)-1]
+			}
+			full, okBytes := r.bytesToFull()
+			chunks, okChunks := r.chunksToFull()
+			log(f, "node=", node.Name, " experiment=", exp.Name, " totalUploaded=", prettyByteSize(last.Bytes), " utilization=", last.Utilization,
+				" failures=", r.Failures,
+				" bytesToFull=", formatBytes(full, okBytes), " chunksToFull=", formatInt(chunks, okChunks))
+		}
+	}
+
+	for j, exp := range cfg.Experiments {
+		n, sum, min, max := 0, 0, 0, 0
+		for i := range inv.Nodes {
+			if out[i].err != nil {
+				continue
+			}
+			full, ok := out[i].results[j].bytesToFull()
+			if !ok {
+				continue
+			}
+			if n == 0 || full < min {
+				min = full
+			}
+			if full > max {
+				max = full
+			}
+			sum += full
+			n++
+		}
+		if n == 0 {
+			log(f, "experiment=", exp.Name, " full=0")
+			continue
+		}
+		log(f, "experiment=", exp.Name, " full=", n, " meanBytesToFull=", prettyByteSize(sum/n), " minBytesToFull=", prettyByteSize(min), " maxBytesToFull=", prettyByteSize(max))
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestClusterReportBytesToFull(t *testing.T) {
+	inv := Inventory{Nodes: []Node{{Name: "bee-1"}, {Name: "bee-2"}}}
+	cfg := Config{Experiments: []Experiment{{Name: "a"}}}
+	out := []nodeResult{
+		{results: []*Result{filledResult("a", 18, true)}},
+		{results: []*Result{filledResult("a", 19, false)}},
+	}
+	var w strings.Builder
+	clusterReport(&w, inv, cfg, out)
+	for _, want := range []string{
+		"node=bee-1 experiment=a totalUploaded=16.0KiB utilization=4 failures=0 bytesToFull=16.0KiB chunksToFull=4",
+		"node=bee-2 experiment=a totalUploaded=32.0KiB utilization=8 failures=0 bytesToFull=32.0KiB chunksToFull=8",
+		"experiment=a full=2 meanBytesToFull=24.0KiB minBytesToFull=16.0KiB maxBytesToFull=32.0KiB",
+	} {
+		if !strings.Contains(w.String(), want) {
+			t.Errorf("report lacks %q:\n%s", want, w.String())
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"io"
+	"strings"
+)
+
+// combined is the log all experiments of a run write to as well, set while
+// runWith runs. It interleaves their records so what happens to one
+// experiment can be lined up with the others.
+var combined *logFile
+
+// taggedWriter writes the log records of one experiment to the combined log,
+// with the experiment name after the time. Each log record is a single
+// write.
+type taggedWriter struct {
+	name string
+	w    io.Writer
+}
+
+func (t taggedWriter) Write(b []byte) (int, error) {
+	ts, msg, ok := strings.Cut(string(b), " ")
+	if !ok {
+		msg, ts = ts, ""
+	}
+	_, err := io.WriteString(t.w, ts+" "+t.name+" "+msg)
+	return len(b), err
+}
+
+// logWriter returns the writer of an experiment's log records: its log file
+// and, during a run, the combined log.
+func logWriter(file io.Writer, name string) io.Writer {
+	if combined == nil {
+		return file
+	}
+	return io.MultiWriter(file, taggedWriter{name: name, w: combined})
+}
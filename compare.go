@@ -0,0 +1,141 @@
+package main
+
+import (
+	"io"
+	"strconv"
+	"time"
+)
+
+type Sample struct {
+	Time        time.Time `json:"time"`
+	Bytes       int       `json:"bytes"`
+	Chunks      int       `json:"chunks"`
+	Utilization int       `json:"utilization"`
+	// Capacity is the bucket capacity of the batch at the time of the
+	// sample, 0 when the node didn't report its depths.
+	Capacity int `json:"capacity,omitempty"`
+	// Latency is how long the upload that ended at Bytes took.
+	Latency time.Duration `json:"latency"`
+	// Metrics are the node metrics scraped along with the sample.
+	Metrics map[string]float64 `json:"metrics,omitempty"`
+	// DiskBytes is the node's disk usage, if tracked.
+	DiskBytes int64 `json:"diskBytes,omitempty"`
+	// Container is the latest resource usage of the node's container, if
+	// tracked.
+	Container *ContainerStats `json:"container,omitempty"`
+	// Queue is the number of generated payloads waiting for an upload
+	// worker.
+	Queue int `json:"queue"`
+	// Generation is the index of the batch in a soak run.
+	Generation int `json:"generation,omitempty"`
+	// Self are the tool's own runtime metrics at the time of the sample.
+	Self *SelfMetrics `json:"self,omitempty"`
+	// Block is the chain's block number at the time of the sample.
+	Block uint64 `json:"block,omitempty"`
+	// Timing is the breakdown of the upload that ended at Bytes.
+	Timing *Timing `json:"timing,omitempty"`
+}
+
+// utilizationAt returns the utilization observed after b bytes were uploaded.
+// ok is false when the run never got that far.
+func utilizationAt(samples []Sample, b int) (u int, ok bool) {
+	if len(samples) == 0 || samples[len(samples)-1].Bytes < b {
+		return 0, false
+	}
+	for _, s := range samples {
+		if s.Bytes > b {
+			break
+		}
+		u = s.Utilization
+	}
+	return u, true
+}
+
+func bytesToFull(samples []Sample) (int, bool) {
+	s, ok := fullSample(samples)
+	return s.Bytes, ok
+}
+
+func chunksToFull(samples []Sample) (int, bool) {
+	s, ok := fullSample(samples)
+	return s.Chunks, ok
+}
+
+// full reports whether the fullest bucket reached the capacity of the
+// sample, assuming the default depths when it has none, like Batch.full.
+func (s Sample) full() bool {
+	if s.Capacity == 0 {
+		return s.Utilization >= fullUtilization
+	}
+	return s.Utilization >= s.Capacity
+}
+
+func fullSample(samples []Sample) (Sample, bool) {
+	for _, s := range samples {
+		if s.full() {
+			return s, true
+		}
+	}
+	return Sample{}, false
+}
+
+func compare(f io.Writer, nameA string, a []Sample, nameB string, b []Sample) {
+	log(f, "comparing ", nameA, " against ", nameB)
+
+	// walk the union of both byte offsets so runs with different payload
+	// sizes still line up.
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		var at int
+		switch {
+		case j >= len(b) || (i < len(a) && a[i].Bytes < b[j].Bytes):
+			at = a[i].Bytes
+			i++
+		case i >= len(a) || b[j].Bytes < a[i].Bytes:
+			at = b[j].Bytes
+			j++
+		default:
+			at = a[i].Bytes
+			i++
+			j++
+		}
+
+		ua, okA := utilizationAt(a, at)
+		ub, okB := utilizationAt(b, at)
+		delta := "-"
+		if okA && okB {
+			delta = strconv.Itoa(ua - ub)
+		}
+		log(f, "totalUploaded=", prettyByteSize(at), " ", nameA, "=", formatInt(ua, okA), " ", nameB, "=", formatInt(ub, okB), " delta=", delta)
+	}
+
+	fullA, okA := bytesToFull(a)
+	fullB, okB := bytesToFull(b)
+	diff := "-"
+	if okA && okB {
+		diff = prettyByteSize(fullA - fullB)
+	}
+	log(f, "bytesToFull ", nameA, "=", formatBytes(fullA, okA), " ", nameB, "=", formatBytes(fullB, okB), " difference=", diff)
+
+	chunksA, okA := chunksToFull(a)
+	chunksB, okB := chunksToFull(b)
+	diff = "-"
+	if okA && okB {
+		diff = strconv.Itoa(chunksA - chunksB)
+	}
+	log(f, "chunksToFull ", nameA, "=", formatInt(chunksA, okA), " ", nameB, "=", formatInt(chunksB, okB), " difference=", diff)
+}
+
+func formatInt(v int, ok bool) string {
+	if !ok {
+		return "-"
+	}
+	return strconv.Itoa(v)
+}
+
+func formatBytes(b int, ok bool) string {
+	if !ok {
+		return "-"
+	}
+	return prettyByteSize(b)
+}
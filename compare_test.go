@@ -0,0 +1,25 @@
+package main
+
+import "testing"
+
+func TestFullSample(t *testing.T) {
+	tests := []struct {
+		name    string
+		samples []Sample
+		// bytes are the bytes to full, -1 for a run that didn't fill up
+		bytes int
+	}{
+		{"depth 20", []Sample{{Bytes: 1, Utilization: 15, Capacity: 16}, {Bytes: 2, Utilization: 16, Capacity: 16}}, 2},
+		{"depth 18", []Sample{{Bytes: 1, Utilization: 3, Capacity: 4}, {Bytes: 2, Utilization: 4, Capacity: 4}, {Bytes: 3, Utilization: 4, Capacity: 4}}, 2},
+		{"depth 22", []Sample{{Bytes: 1, Utilization: 16, Capacity: 64}, {Bytes: 2, Utilization: 63, Capacity: 64}}, -1},
+		// samples of results without the depths count against the default
+		{"no capacity", []Sample{{Bytes: 1, Utilization: 4}, {Bytes: 2, Utilization: 16}}, 2},
+		{"empty", nil, -1},
+	}
+	for _, tt := range tests {
+		got, ok := bytesToFull(tt.samples)
+		if want := tt.bytes >= 0; ok != want || ok && got != tt.bytes {
+			t.Errorf("%s: bytes to full %d, %v, want %d", tt.name, got, ok, tt.bytes)
+		}
+	}
+}
@@ -0,0 +1,539 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+type Config struct {
+	// Baseline names the experiment every other experiment is compared
+	// against. Defaults to the first experiment.
+	Baseline    string       `json:"baseline"`
+	Experiments []Experiment `json:"experiments"`
+}
+
+type Experiment struct {
+	Name     string `json:"name"`
+	BatchID  string `json:"batchID"`
+	Encrypt  bool   `json:"encrypt"`
+	Deferred bool   `json:"deferred"`
+	// MixEncrypt uploads both encrypted and plain to the one batch,
+	// "alternate" or "random" per upload, instead of following Encrypt.
+	MixEncrypt string `json:"mixEncrypt"`
+	// Workload is what gets uploaded each iteration: "bytes" (default),
+	// "file" for a single file through /bzz, "website", "pss" or "stream"
+	// for the chunks over the WebSocket chunk stream.
+	Workload string `json:"workload"`
+	// Size is the payload size of one iteration in bytes.
+	Size int `json:"size"`
+	// RedundancyLevel is the erasure coding level, 0 (none) to 4 (paranoid).
+	RedundancyLevel int `json:"redundancyLevel"`
+	// Metadata sets the content types, file names and index documents of
+	// the /bzz workloads.
+	Metadata *Metadata `json:"metadata"`
+	// Act uploads the content access controlled when set.
+	Act *Act `json:"act"`
+	// Headers are added to every upload request, overriding the ones set by
+	// the tool.
+	Headers map[string]string `json:"headers"`
+	Pss     *Pss              `json:"pss"`
+	// OwnerKey is the hex encoded private key of the batch owner. When set,
+	// chunks are stamped client-side instead of by the node.
+	OwnerKey string `json:"ownerKey"`
+	// Buy describes the batch bought for the experiment when the tool buys
+	// batches itself, as in -dev mode.
+	Buy *BatchSpec `json:"buy"`
+	// NodeMetrics names Prometheus metrics of the node, e.g.
+	// bee_pusher_total_to_push, scraped with every sample.
+	NodeMetrics []string `json:"nodeMetrics"`
+	// Docker samples the CPU, memory and IO of the node's container with
+	// the samples.
+	Docker *DockerStats `json:"docker"`
+	// DiskUsage is the node's data directory, when the tool runs on the
+	// node's host, or "status" to estimate it from the node's reserve size.
+	DiskUsage string `json:"diskUsage"`
+	// Poll sets how often the batch is polled, by default after every
+	// upload.
+	Poll *Poll `json:"poll"`
+	// Concurrency is the number of parallel uploads, 1 by default.
+	Concurrency int `json:"concurrency"`
+	// InFlight pipelines the uploads: the workers hand every upload off
+	// and take the next payload, while at most InFlight uploads are in
+	// flight however many workers there are. 0 runs one upload per worker.
+	InFlight int `json:"inFlight"`
+	// Rate limits the uploads to this many per second, 0 doesn't.
+	Rate float64 `json:"rate"`
+	// Queue is how many payloads are generated ahead of the uploads,
+	// Concurrency by default.
+	Queue int `json:"queue"`
+	// Backpressure reduces the concurrency and rate while uploads are
+	// slow, so the run measures what the node sustains.
+	Backpressure *Backpressure `json:"backpressure"`
+	// AdaptiveSize changes the payload size to keep the upload latency
+	// near a target.
+	AdaptiveSize *AdaptiveSize `json:"adaptiveSize"`
+	// Breaker skips failed uploads and pauses the run while the node is
+	// down, instead of ending it on the first error.
+	Breaker *Breaker `json:"breaker"`
+	// Retry retries failed uploads, batch polls and tag requests and
+	// decides what happens once an operation gives up.
+	Retry *Retry `json:"retry"`
+	// Transport sets the connection limits of the experiment's own HTTP
+	// client.
+	Transport *Transport `json:"transport"`
+	// OnError is "abort" (default) to end the run on the first error or
+	// "continue" to count the failure, skip the payload and go on.
+	OnError string `json:"onError"`
+	// Repeat uploads one payload this many times instead of fresh random
+	// data, to check that re-uploading content doesn't use the batch again.
+	Repeat int `json:"repeat"`
+	// Mix draws the size of every upload from a weighted set of sizes,
+	// replacing Size.
+	Mix []MixEntry `json:"mix"`
+	// Trace replays the uploads of a recorded trace, the run ends with
+	// the trace.
+	Trace *Trace `json:"trace"`
+	// Source uploads existing data, such as the objects of an S3 bucket,
+	// instead of generated payloads. The run ends with the source.
+	Source *Source `json:"source"`
+	// Impair adds client side latency and a bandwidth limit to uploads.
+	Impair *Impairment `json:"impair"`
+	// Ramp starts with fewer workers and raises the concurrency over
+	// time.
+	Ramp *Ramp `json:"ramp"`
+	// Soak keeps the run going forever, buying a new batch with the Buy
+	// spec whenever the current one fills up or expires.
+	Soak bool `json:"soak"`
+	// Heartbeat logs a liveness record at this interval, also while an
+	// upload is slow and nothing else gets logged.
+	Heartbeat duration `json:"heartbeat"`
+	// Stall cancels uploads when none finished for a while.
+	Stall *Stall `json:"stall"`
+	// TolerateRestarts waits for the node to come back when it refuses
+	// connections and then continues, instead of ending the run.
+	TolerateRestarts bool `json:"tolerateRestarts"`
+	// MaxBytes ends the run once this many bytes were uploaded.
+	MaxBytes int `json:"maxBytes"`
+	// StopAt ends the run once the fullest bucket holds this share of the
+	// capacity, e.g. "50%", leaving a partially filled batch.
+	StopAt percent `json:"stopAt"`
+	// Random is the payload generator, "crypto" (default) for crypto/rand
+	// or "fast" for a seeded math/rand generator that is not
+	// cryptographically secure but much cheaper for big payloads.
+	Random string `json:"random"`
+	// Align rounds the payload sizes down to whole data chunks, "chunk", or
+	// to whole intermediate chunks, "branch", so every upload fills its
+	// chunks exactly.
+	Align string `json:"align"`
+	// Sweep cycles the uploads through these payload sizes, replacing
+	// Size, and reports what each size consumed.
+	Sweep []int `json:"sweep"`
+	// Heatmap snapshots the bucket fill levels at this interval into
+	// <name>-heatmap.html.
+	Heatmap duration `json:"heatmap"`
+	// Alerts are fill percentages of the fullest bucket, logged as alerts
+	// when crossed. Defaults to 90, an empty list disables the alerts.
+	Alerts []float64 `json:"alerts"`
+	// Overflow keeps uploading this many times once an immutable batch is
+	// full and records how the node answers.
+	Overflow int `json:"overflow"`
+	// Overwrite keeps uploading once a mutable batch is full and checks
+	// which earlier uploads can no longer be retrieved.
+	Overwrite *Overwrite `json:"overwrite"`
+	// Dilute raises the batch depth while the run goes on, once the
+	// fullest bucket nears the capacity.
+	Dilute *AutoDilute `json:"dilute"`
+	// Reader retrieves recent uploads through a second node during the
+	// run.
+	Reader *Reader `json:"reader"`
+	// Presence checks that the node still holds the root chunks of
+	// sampled uploads.
+	Presence *Presence `json:"presence"`
+	// Cancel aborts a share of the uploads mid-stream to measure what
+	// partial uploads cost.
+	Cancel *Cancel `json:"cancel"`
+	// Eviction uploads past the point the node's reserve nears its
+	// capacity and tracks what the node evicts.
+	Eviction *Eviction `json:"eviction"`
+	// Hooks are commands run before every upload, at milestones and once
+	// the run ended.
+	Hooks *Hooks `json:"hooks"`
+	// DependsOn holds the experiment back until the experiments it depends
+	// on finished, and skips it when they didn't end as required.
+	DependsOn []Dependency `json:"dependsOn"`
+}
+
+type BatchSpec struct {
+	Amount    string `json:"amount"`
+	Depth     int    `json:"depth"`
+	Immutable bool   `json:"immutable"`
+}
+
+var defaultBatchSpec = BatchSpec{
+	Amount:    "10000000000",
+	Depth:     20,
+	Immutable: true,
+}
+
+const (
+	onErrorAbort    = "abort"
+	onErrorContinue = "continue"
+)
+
+const (
+	randomCrypto = "crypto"
+	randomFast   = "fast"
+)
+
+const maxRedundancyLevel = 4
+
+const defaultSize = 5 * 1024 * 1024
+
+var defaultConfig = Config{
+	Baseline: "non-encrypted",
+	Experiments: []Experiment{
+		{
+			Name:        "encrypted",
+			BatchID:     "33061094e7281dbc29baf3b825d219d39c6999c8a11572863656225ad9bd287e",
+			Encrypt:     true,
+			Workload:    workloadBytes,
+			Size:        defaultSize,
+			Concurrency: 1,
+		},
+		{
+			Name:        "non-encrypted",
+			BatchID:     "b7f8691f430db68104e5c92b8aaf2041bd99749fc1aeba44db77ab0a014b614b",
+			Workload:    workloadBytes,
+			Size:        defaultSize,
+			Concurrency: 1,
+		},
+	},
+}
+
+func loadConfig(path string) (Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+	return parseConfig(path, b)
+}
+
+// parseConfig decodes, defaults and validates a config, path names it in
+// the errors. All problems are reported at once, with the fields they are
+// about.
+func parseConfig(path string, b []byte) (Config, error) {
+	var cfg Config
+	err := json.Unmarshal(b, &cfg)
+	if err != nil {
+		return Config{}, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if len(cfg.Experiments) == 0 {
+		return Config{}, fmt.Errorf("%s: no experiments", path)
+	}
+	var p problems
+	names := map[string]bool{}
+	// the experiment reading stdin, only one can
+	stdin := ""
+	for i := range cfg.Experiments {
+		e := &cfg.Experiments[i]
+		at := func(field string) string {
+			return fmt.Sprintf("experiments[%d].%s", i, field)
+		}
+		if e.Workload == "" {
+			e.Workload = workloadBytes
+		}
+		if e.Size == 0 {
+			e.Size = defaultSize
+			if e.Workload == workloadPss {
+				e.Size = pssMaxPayload
+			}
+		}
+		if e.Name == "" {
+			p.add(at("name"), "missing")
+		} else if names[e.Name] {
+			p.add(at("name"), "%q is used by another experiment", e.Name)
+		}
+		names[e.Name] = true
+		if e.BatchID != "" && !isBatchID(e.BatchID) {
+			p.add(at("batchID"), "%q is not 64 hex characters", e.BatchID)
+		}
+		if e.RedundancyLevel < 0 || e.RedundancyLevel > maxRedundancyLevel {
+			p.add(at("redundancyLevel"), "%d out of range 0-%d", e.RedundancyLevel, maxRedundancyLevel)
+		}
+		_, err = newUploader(nil, *e)
+		if err != nil {
+			p.add(at("workload"), "%v", err)
+		}
+		if e.Size < 0 || (e.Workload == workloadPss && e.Size > pssMaxPayload) {
+			p.add(at("size"), "invalid size %d", e.Size)
+		}
+		if e.Concurrency == 0 {
+			e.Concurrency = 1
+		}
+		if e.Concurrency < 0 {
+			p.add(at("concurrency"), "negative")
+		}
+		if e.InFlight < 0 {
+			p.add(at("inFlight"), "negative")
+		}
+		if e.Queue < 0 {
+			p.add(at("queue"), "negative")
+		}
+		if e.Rate < 0 {
+			p.add(at("rate"), "negative")
+		}
+		if e.Retry != nil {
+			err = e.Retry.validate()
+			if err != nil {
+				p.add(at("retry"), "%v", err)
+			}
+		}
+		if e.Transport != nil && (e.Transport.MaxConnsPerHost < 0 || e.Transport.MaxIdleConnsPerHost < 0 || e.Transport.IdleConnTimeout < 0) {
+			p.add(at("transport"), "negative limit")
+		}
+		if (e.Concurrency > 1 || e.InFlight > 1) && (e.Act != nil || e.OwnerKey != "") {
+			// ACT uploads share one history and the local stamper keeps
+			// one set of bucket counters
+			p.add(at("concurrency"), "act and local stamping need a concurrency of 1")
+		}
+		err = validateMix(e.Mix, e.Workload)
+		if err != nil {
+			p.add(at("mix"), "%v", err)
+		}
+		if len(e.Sweep) > 0 {
+			if len(e.Mix) > 0 || e.Repeat > 0 || e.Trace != nil {
+				p.add(at("sweep"), "can't be combined with a mix, repeat or trace")
+			}
+			err = validateSweep(e.Sweep, e.Workload)
+			if err != nil {
+				p.add(at("sweep"), "%v", err)
+			}
+		}
+		if e.Trace != nil {
+			if len(e.Mix) > 0 || e.Repeat > 0 {
+				p.add(at("trace"), "can't be combined with a mix or repeat")
+			}
+			_, _, err = loadTrace(e.Trace.File)
+			if err != nil {
+				p.add(at("trace.file"), "%v", err)
+			}
+		}
+		switch e.MixEncrypt {
+		case "":
+		case mixEncryptAlternate, mixEncryptRandom:
+			if e.Encrypt || (e.Workload != workloadBytes && e.Workload != workloadFile) || e.Trace != nil || e.Source != nil || e.OwnerKey != "" {
+				p.add(at("mixEncrypt"), "needs a bytes or file workload without encrypt, trace, source or owner key")
+			}
+		default:
+			p.add(at("mixEncrypt"), "unknown mode %q, want %q or %q", e.MixEncrypt, mixEncryptAlternate, mixEncryptRandom)
+		}
+		if e.Metadata != nil && e.Workload != workloadFile && e.Workload != workloadWebsite {
+			p.add(at("metadata"), "needs the file or website workload")
+		}
+		if e.Source != nil {
+			if e.Workload != workloadBytes || len(e.Mix) > 0 || len(e.Sweep) > 0 || e.Repeat > 0 || e.Trace != nil || e.Soak {
+				p.add(at("source"), "needs a bytes workload without mix, sweep, repeat, trace or soak")
+			}
+			err = e.Source.validate()
+			if err != nil {
+				p.add(at("source"), "%v", err)
+			}
+			if e.Source.Stdin != nil {
+				if stdin != "" {
+					p.add(at("source.stdin"), "%s already reads stdin", stdin)
+				}
+				stdin = e.Name
+			}
+		}
+		if e.Soak && (e.Repeat > 0 || e.Trace != nil || e.Overflow > 0) {
+			p.add(at("soak"), "soak runs can't repeat, replay a trace or capture the overflow")
+		}
+		if e.Overflow < 0 {
+			p.add(at("overflow"), "negative")
+		}
+		if e.Dilute != nil && (e.Dilute.Threshold < 0 || e.Dilute.Threshold > 100) {
+			p.add(at("dilute.threshold"), "%v out of range 0-100", e.Dilute.Threshold)
+		}
+		if e.Dilute != nil && (e.Dilute.Steps < 0 || e.Dilute.Timeout < 0) {
+			p.add(at("dilute"), "negative steps or timeout")
+		}
+		if e.Overwrite != nil {
+			if e.Soak || e.Repeat > 0 || e.Workload != workloadBytes {
+				p.add(at("overwrite"), "needs a bytes workload without soak or repeat")
+			}
+			if e.Overwrite.Uploads < 0 || e.Overwrite.Check < 0 || e.Overwrite.Timeout < 0 {
+				p.add(at("overwrite"), "negative uploads, check or timeout")
+			}
+		}
+		if e.Ramp != nil {
+			if e.Backpressure != nil {
+				p.add(at("ramp"), "can't be combined with backpressure")
+			}
+			if e.Ramp.Every <= 0 {
+				p.add(at("ramp.every"), "missing interval")
+			}
+		}
+		err = validateAlerts(e.Alerts)
+		if err != nil {
+			p.add(at("alerts"), "%v", err)
+		}
+		if e.Stall != nil {
+			err = validateStall(e.Stall)
+			if err != nil {
+				p.add(at("stall"), "%v", err)
+			}
+		}
+		if e.MaxBytes < 0 {
+			p.add(at("maxBytes"), "negative")
+		}
+		if e.Heartbeat < 0 {
+			p.add(at("heartbeat"), "negative")
+		}
+		if e.Heatmap < 0 {
+			p.add(at("heatmap"), "negative")
+		}
+		if e.Impair != nil && (e.Impair.Latency < 0 || e.Impair.Bandwidth < 0) {
+			p.add(at("impair"), "negative latency or bandwidth")
+		}
+		if e.Repeat < 0 {
+			p.add(at("repeat"), "negative")
+		}
+		switch e.Align {
+		case "":
+		case alignChunk, alignBranch:
+			if e.Workload != workloadBytes {
+				p.add(at("align"), "only bytes payloads can be aligned")
+			}
+			e.Size = alignSize(e.Size, e.Align, e.Encrypt)
+			for j := range e.Mix {
+				e.Mix[j].Size = alignSize(e.Mix[j].Size, e.Align, e.Encrypt)
+			}
+			for j := range e.Sweep {
+				e.Sweep[j] = alignSize(e.Sweep[j], e.Align, e.Encrypt)
+			}
+		default:
+			p.add(at("align"), "unknown alignment %q, want %q or %q", e.Align, alignChunk, alignBranch)
+		}
+		switch e.Random {
+		case "":
+			e.Random = randomCrypto
+		case randomCrypto, randomFast:
+		default:
+			p.add(at("random"), "unknown generator %q, want %q or %q", e.Random, randomCrypto, randomFast)
+		}
+		switch e.OnError {
+		case "":
+			e.OnError = onErrorAbort
+		case onErrorAbort, onErrorContinue:
+		default:
+			p.add(at("onError"), "unknown policy %q, want %q or %q", e.OnError, onErrorAbort, onErrorContinue)
+		}
+		if e.Backpressure != nil && e.Backpressure.Latency <= 0 {
+			p.add(at("backpressure.latency"), "missing")
+		}
+		if e.AdaptiveSize != nil {
+			err = e.AdaptiveSize.validate(*e)
+			if err != nil {
+				p.add(at("adaptiveSize"), "%v", err)
+			}
+		}
+		if e.Poll != nil && (e.Poll.Uploads < 0 || e.Poll.Interval < 0) {
+			p.add(at("poll"), "negative cadence")
+		}
+		if e.StopAt > 0 && e.Soak {
+			p.add(at("stopAt"), "can't be combined with soak")
+		}
+		if e.Cancel != nil {
+			if e.Workload != workloadBytes || e.Concurrency != 1 || e.OwnerKey != "" {
+				// with one upload at a time the bucket counters tell
+				// what the canceled upload stamped
+				p.add(at("cancel"), "needs a bytes workload, node stamping and a concurrency of 1")
+			}
+			if e.Cancel.Percent < 0 || e.Cancel.Percent > 100 {
+				p.add(at("cancel.percent"), "%v out of range 0-100", e.Cancel.Percent)
+			}
+			if e.Cancel.At < 0 || e.Cancel.At >= 1 {
+				p.add(at("cancel.at"), "%v out of range 0-1", e.Cancel.At)
+			}
+		}
+		if e.Eviction != nil {
+			if e.Soak || e.Repeat > 0 {
+				p.add(at("eviction"), "can't be combined with soak or repeat")
+			}
+			if e.Eviction.Capacity < 0 || e.Eviction.Uploads < 0 || e.Eviction.Every < 0 || e.Eviction.Check < 0 || e.Eviction.Timeout < 0 {
+				p.add(at("eviction"), "negative capacity, uploads, every, check or timeout")
+			}
+		}
+		if e.Docker != nil && e.Docker.Interval < 0 {
+			p.add(at("docker.interval"), "negative")
+		}
+		if e.Hooks != nil && e.Hooks.Timeout < 0 {
+			p.add(at("hooks.timeout"), "negative")
+		}
+		if e.Presence != nil && e.Presence.Every < 0 {
+			p.add(at("presence.every"), "negative")
+		}
+		if e.Reader != nil {
+			if e.Reader.API == "" {
+				p.add(at("reader.api"), "missing")
+			}
+			if e.Reader.Every < 0 || e.Reader.Recent < 0 || e.Reader.Timeout < 0 {
+				p.add(at("reader"), "negative every, recent or timeout")
+			}
+		}
+		if e.Act != nil {
+			err = e.Act.validate()
+			if err != nil {
+				p.add(at("act"), "%v", err)
+			}
+		}
+	}
+	validateDependencies(cfg.Experiments, &p)
+	if cfg.Baseline == "" {
+		cfg.Baseline = cfg.Experiments[0].Name
+	}
+	if cfg.experiment(cfg.Baseline) < 0 {
+		p.add("baseline", "%q is not an experiment", cfg.Baseline)
+	}
+	err = p.err(path)
+	if err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// problems collects the validation errors of a config.
+type problems []string
+
+func (p *problems) add(field, format string, args ...any) {
+	*p = append(*p, field+": "+fmt.Sprintf(format, args...))
+}
+
+func (p problems) err(path string) error {
+	switch len(p) {
+	case 0:
+		return nil
+	case 1:
+		return fmt.Errorf("%s: %s", path, p[0])
+	}
+	return fmt.Errorf("%s: %d problems:\n  %s", path, len(p), strings.Join(p, "\n  "))
+}
+
+// isBatchID reports whether id looks like a batch id, 32 hex encoded bytes.
+func isBatchID(id string) bool {
+	b, err := hex.DecodeString(id)
+	return err == nil && len(b) == 32
+}
+
+// experiment returns the index of the named experiment, or -1.
+func (c Config) experiment(name string) int {
+	for i, e := range c.Experiments {
+		if e.Name == name {
+			return i
+		}
+	}
+	return -1
+}
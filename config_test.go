@@ -0,0 +1,75 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const testBatchID = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+
+func TestParseConfigProblems(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		// problems are the lines the error must carry, none for a valid
+		// config
+		problems []string
+	}{
+		{"valid", `{"experiments":[{"name":"a","batchID":"` + testBatchID + `","concurrency":4}]}`, nil},
+		{"no experiments", `{"experiments":[]}`, []string{"test.json: no experiments"}},
+		{"syntax", `{"experiments":[`, []string{"parse test.json"}},
+		{"missing name", `{"experiments":[{"batchID":"` + testBatchID + `"}]}`, []string{"experiments[0].name: missing"}},
+		{"duplicate name", `{"experiments":[{"name":"a"},{"name":"a"}]}`, []string{`experiments[1].name: "a" is used by another experiment`}},
+		{"batch id", `{"experiments":[{"name":"a","batchID":"abc"}]}`, []string{`experiments[0].batchID: "abc" is not 64 hex characters`}},
+		{"redundancy", `{"experiments":[{"name":"a","redundancyLevel":5}]}`, []string{"experiments[0].redundancyLevel: 5 out of range 0-4"}},
+		{"negatives", `{"experiments":[{"name":"a","size":-1,"concurrency":-1,"rate":-1}]}`, []string{
+			"experiments[0].size: invalid size -1",
+			"experiments[0].concurrency: negative",
+			"experiments[0].rate: negative",
+		}},
+		{"local stamping concurrency", `{"experiments":[{"name":"a","batchID":"` + testBatchID + `","ownerKey":"` + testBatchID + `","concurrency":2}]}`, []string{"experiments[0].concurrency: act and local stamping need a concurrency of 1"}},
+		{"align", `{"experiments":[{"name":"a","align":"page"}]}`, []string{`experiments[0].align: unknown alignment "page"`}},
+		{"align workload", `{"experiments":[{"name":"a","workload":"file","align":"chunk"}]}`, []string{"experiments[0].align: only bytes payloads can be aligned"}},
+		{"soak stopAt", `{"experiments":[{"name":"a","soak":true,"stopAt":50}]}`, []string{"experiments[0].stopAt: can't be combined with soak"}},
+		{"second experiment", `{"experiments":[{"name":"a"},{"name":"b","queue":-1}]}`, []string{"experiments[1].queue: negative"}},
+		{"baseline", `{"baseline":"c","experiments":[{"name":"a"}]}`, []string{`baseline: "c" is not an experiment`}},
+	}
+	for _, tt := range tests {
+		_, err := parseConfig("test.json", []byte(tt.config))
+		if len(tt.problems) == 0 {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("%s: no error, want %q", tt.name, tt.problems)
+			continue
+		}
+		for _, want := range tt.problems {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("%s: got %q, want it to report %q", tt.name, err, want)
+			}
+		}
+		if n := len(tt.problems); n > 1 && !strings.Contains(err.Error(), "problems:") {
+			t.Errorf("%s: got %q, want the %d problems listed together", tt.name, err, n)
+		}
+	}
+}
+
+func TestParseConfigDefaults(t *testing.T) {
+	cfg, err := parseConfig("test.json", []byte(`{"experiments":[{"name":"a","align":"chunk","size":10000},{"name":"b","workload":"bytes"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b := cfg.Experiments[0], cfg.Experiments[1]
+	if a.Workload != workloadBytes || a.Concurrency != 1 || a.Size != 2*chunkSize {
+		t.Errorf("a: workload=%q concurrency=%d size=%d", a.Workload, a.Concurrency, a.Size)
+	}
+	if b.Size != defaultSize {
+		t.Errorf("b: size %d, want the default %d", b.Size, defaultSize)
+	}
+	if cfg.Baseline != "a" {
+		t.Errorf("baseline %q, want the first experiment", cfg.Baseline)
+	}
+}
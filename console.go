@@ -0,0 +1,139 @@
+package main
+
+import (
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// console is where progress meant for people goes, stdout is kept for the
+// machine readable summary.
+func console() io.Writer {
+	if global.quiet {
+		return io.Discard
+	}
+	return os.Stderr
+}
+
+// colorConsole reports whether the console is an interactive terminal that
+// should get colors. NO_COLOR and TERM=dumb turn them off.
+func colorConsole() bool {
+	if global.quiet || os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	fi, err := os.Stderr.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+const (
+	colorReset  = "\033[0m"
+	colorRed    = "\033[31m"
+	colorGreen  = "\033[32m"
+	colorYellow = "\033[33m"
+	colorBold   = "\033[1m"
+	// colorPlain is as long as the other colors, for table cells that
+	// have to line up with colored ones
+	colorPlain = "\033[00m"
+)
+
+func colorize(s, color string) string {
+	if color == "" {
+		return s
+	}
+	return color + s + colorReset
+}
+
+// consoleWriter echoes the log records of one experiment to the console,
+// prefixed with the experiment name. Each log record is a single write. On
+// a terminal the time is shortened to the local clock and milestones,
+// warnings and errors are colored; the log files stay plain.
+type consoleWriter struct {
+	prefix      string
+	w           io.Writer
+	color       bool
+	utilization int
+}
+
+func newConsoleWriter(name string) *consoleWriter {
+	return &consoleWriter{prefix: name + " ", w: console(), color: colorConsole()}
+}
+
+var utilizationField = regexp.MustCompile(`\butilization=(\d+)`)
+
+// warnings and errors among the log records, by their first word
+var (
+	consoleWarnings = []string{"skipping", "utilization mismatch", "backpressure", "breaker", "stall", "retrying", "reconnect", "node unreachable", "restart", "duplicate", "repeat reference changed", "get stamp", "scrape metrics", "disk usage", "write series", "alert", "overflow", "chain", "retrieval failed", "missing root chunk", "presence check", "canceled upload"}
+	consoleErrors   = []string{"summary stopReason=error", "error", "stopping"}
+	consoleGood     = []string{"batch full", "summary", "soak generation"}
+)
+
+func (c *consoleWriter) Write(b []byte) (int, error) {
+	line := strings.TrimSuffix(string(b), "\n")
+	if c.color {
+		line = c.humanize(line)
+	}
+	_, err := io.WriteString(c.w, c.prefix+line+"\n")
+	return len(b), err
+}
+
+func (c *consoleWriter) humanize(line string) string {
+	ts, msg, ok := strings.Cut(line, " ")
+	if !ok {
+		return line
+	}
+	if t, err := time.Parse(time.RFC3339, ts); err == nil {
+		ts = t.Local().Format("15:04:05")
+	}
+	return ts + " " + colorize(msg, c.milestone(msg))
+}
+
+// milestone returns the color of a log message, if any.
+func (c *consoleWriter) milestone(msg string) string {
+	for _, p := range consoleErrors {
+		if strings.HasPrefix(msg, p) {
+			return colorRed
+		}
+	}
+	for _, p := range consoleWarnings {
+		if strings.HasPrefix(msg, p) {
+			return colorYellow
+		}
+	}
+	for _, p := range consoleGood {
+		if strings.HasPrefix(msg, p) {
+			return colorGreen
+		}
+	}
+	if strings.HasPrefix(msg, "totalUploaded=") {
+		if m := utilizationField.FindStringSubmatch(msg); m != nil {
+			u, _ := strconv.Atoi(m[1])
+			jumped := u > c.utilization
+			c.utilization = u
+			if jumped {
+				return colorBold
+			}
+		}
+	}
+	return ""
+}
+
+// stopReasonColor colors a stop reason of the outcome table. All cells of
+// the column, the header included, get an escape sequence of the same
+// length so the table stays aligned.
+func stopReasonColor(reason string, color bool) string {
+	if !color {
+		return reason
+	}
+	switch reason {
+	case stopFull, stopDone, stopTarget:
+		return colorize(reason, colorGreen)
+	case stopError:
+		return colorize(reason, colorRed)
+	case stopExpired, stopStopped, stopMaxBytes, stopSkipped:
+		return colorize(reason, colorYellow)
+	}
+	return colorize(reason, colorPlain)
+}
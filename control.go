@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// controlPatch is the body of PATCH /experiments/{name}, which steers a
+// running experiment of serve. Fields left out keep their value, the run
+// applies the rest as it would a reloaded config.
+type controlPatch struct {
+	Concurrency *int `json:"concurrency"`
+	// Rate is in uploads per second, 0 lifts the limit.
+	Rate *float64 `json:"rate"`
+	Size *int     `json:"size"`
+}
+
+func (p controlPatch) validate(exp Experiment) error {
+	switch {
+	case p.Concurrency == nil && p.Rate == nil && p.Size == nil:
+		return fmt.Errorf("nothing to change, patch concurrency, rate or size")
+	case p.Concurrency != nil && *p.Concurrency < 1:
+		return fmt.Errorf("concurrency %d: need at least 1", *p.Concurrency)
+	case p.Rate != nil && *p.Rate < 0:
+		return fmt.Errorf("rate: negative")
+	case p.Size != nil && (*p.Size <= 0 || (exp.Workload == workloadPss && *p.Size > pssMaxPayload)):
+		return fmt.Errorf("invalid size %d", *p.Size)
+	}
+	return nil
+}
+
+func (p controlPatch) apply(exp Experiment) Experiment {
+	if p.Concurrency != nil {
+		exp.Concurrency = *p.Concurrency
+	}
+	if p.Rate != nil {
+		exp.Rate = *p.Rate
+	}
+	if p.Size != nil {
+		exp.Size = *p.Size
+	}
+	return exp
+}
+
+// controlSettings is the answer to a patch, the settings the experiment
+// is asked to run with. What it applied ends up in its log.
+type controlSettings struct {
+	Name        string  `json:"name"`
+	Concurrency int     `json:"concurrency"`
+	Rate        float64 `json:"rate"`
+	Size        int     `json:"size"`
+}
+
+// control serves PATCH /experiments/{name}.
+func control(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/experiments/")
+	if r.Method != http.MethodPatch {
+		w.Header().Set("Allow", http.MethodPatch)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var p controlPatch
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&p)
+	if err != nil {
+		http.Error(w, "parse patch: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	reloads.mu.Lock()
+	exp, ok := reloads.running[name]
+	reloads.mu.Unlock()
+	if !ok {
+		http.Error(w, fmt.Sprintf("experiment %q is not running", name), http.StatusNotFound)
+		return
+	}
+	err = p.validate(exp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	exp, ok = reloads.patch(name, p)
+	if !ok {
+		http.Error(w, fmt.Sprintf("experiment %q is not running", name), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(controlSettings{Name: exp.Name, Concurrency: exp.Concurrency, Rate: exp.Rate, Size: exp.Size})
+}
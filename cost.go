@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"time"
+)
+
+const (
+	plurPerBZZ = 1e16
+	blockTime  = 5 * time.Second
+)
+
+type ChainState struct {
+	Block        uint64 `json:"block"`
+	TotalAmount  string `json:"totalAmount"`
+	CurrentPrice string `json:"currentPrice"`
+}
+
+func (c *Client) getChainState() (*ChainState, error) {
+	req, err := http.NewRequest(http.MethodGet, c.debugURL+"/chainstate", nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, &statusError{code: res.StatusCode, body: string(body)}
+	}
+
+	var state ChainState
+	err = json.Unmarshal(body, &state)
+	if err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// cost is what is left of a batch, not what was paid for it: the node only
+// reports the balance.
+type cost struct {
+	RemainingBZZ   float64
+	RemainingPerGB float64
+	TTL            time.Duration
+	PerGBMonth     float64
+}
+
+// batchCost prices the bytes stored on a batch. The node reports the batch
+// amount normalised against the chain's total amount, so the balance left per
+// chunk is the difference of the two; spread over all 2^depth chunks that is
+// what the batch is still worth. Over the TTL that balance works out to the
+// price of a GB-month.
+func batchCost(batch *Batch, state *ChainState, stored int) (*cost, error) {
+	amount, ok := new(big.Int).SetString(batch.Amount, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid batch amount %q", batch.Amount)
+	}
+	total, ok := new(big.Int).SetString(state.TotalAmount, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid total amount %q", state.TotalAmount)
+	}
+	price, ok := new(big.Int).SetString(state.CurrentPrice, 10)
+	if !ok || price.Sign() <= 0 {
+		return nil, fmt.Errorf("invalid price %q", state.CurrentPrice)
+	}
+	if stored <= 0 {
+		return nil, fmt.Errorf("nothing stored")
+	}
+
+	balance := new(big.Int).Sub(amount, total)
+	if balance.Sign() < 0 {
+		balance.SetInt64(0)
+	}
+	plur := new(big.Int).Lsh(balance, uint(batch.Depth))
+	bzz, _ := new(big.Float).Quo(new(big.Float).SetInt(plur), big.NewFloat(plurPerBZZ)).Float64()
+
+	blocks := new(big.Int).Quo(balance, price)
+	c := &cost{
+		RemainingBZZ:   bzz,
+		RemainingPerGB: bzz / (float64(stored) / 1e9),
+		TTL:            time.Duration(blocks.Int64()) * blockTime,
+	}
+	if months := c.TTL.Hours() / (24 * 30); months > 0 {
+		c.PerGBMonth = c.RemainingPerGB / months
+	}
+	return c, nil
+}
+
+func logCost(f io.Writer, c *Client, batch *Batch, stored int) {
+	state, err := c.getChainState()
+	if err != nil {
+		log(f, "cost unavailable: get chainstate: ", err)
+		return
+	}
+	bc, err := batchCost(batch, state, stored)
+	if err != nil {
+		log(f, "cost unavailable: ", err)
+		return
+	}
+	log(f, "cost depth=", batch.Depth, " remaining=", fmt.Sprintf("%.4f", bc.RemainingBZZ), "BZZ stored=", prettyByteSize(stored),
+		" remainingPerGB=", fmt.Sprintf("%.6f", bc.RemainingPerGB), "BZZ price=", state.CurrentPrice, " ttl=", bc.TTL, " perGBMonth=", fmt.Sprintf("%.6f", bc.PerGBMonth), "BZZ")
+}
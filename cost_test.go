@@ -0,0 +1,46 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestGetChainStateReportsTheStatus(t *testing.T) {
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"code":500,"message":"chain state unavailable"}`))
+	}))
+	defer node.Close()
+	_, err := newClient(node.URL, node.URL).getChainState()
+	if statusCode(err) != http.StatusInternalServerError {
+		t.Errorf("got %v, want a 500 status error", err)
+	}
+}
+
+func TestBatchCost(t *testing.T) {
+	tests := []struct {
+		name          string
+		amount, total string
+		// remaining is the balance of the batch in BZZ, ttl how long it
+		// lasts at a price of 1000 PLUR per chunk and block
+		remaining float64
+		ttl       time.Duration
+	}{
+		{"bought", "1000000000", "0", 1.6777216, 1e6 * blockTime},
+		{"half spent", "1000000000", "500000000", 0.8388608, 5e5 * blockTime},
+		{"expired", "1000000000", "2000000000", 0, 0},
+	}
+	for _, tt := range tests {
+		batch := &Batch{Depth: 24, Amount: tt.amount}
+		c, err := batchCost(batch, &ChainState{TotalAmount: tt.total, CurrentPrice: "1000"}, 1e9)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(c.RemainingBZZ-tt.remaining) > 1e-9 || math.Abs(c.RemainingPerGB-tt.remaining) > 1e-9 || c.TTL != tt.ttl {
+			t.Errorf("%s: remaining %v BZZ, %v per GB and ttl %v, want %v and %v", tt.name, c.RemainingBZZ, c.RemainingPerGB, c.TTL, tt.remaining, tt.ttl)
+		}
+	}
+}
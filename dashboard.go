@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// the dashboard filters every panel by these variables, the labels of the
+// experiment metrics
+const dashboardSelector = `{experiment=~"$experiment",node=~"$node",batch=~"$batch",encrypted=~"$encrypted",deferred=~"$deferred"}`
+
+type grafanaDashboard struct {
+	UID           string   `json:"uid"`
+	Title         string   `json:"title"`
+	Tags          []string `json:"tags"`
+	SchemaVersion int      `json:"schemaVersion"`
+	Refresh       string   `json:"refresh"`
+	Time          struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+	} `json:"time"`
+	Templating struct {
+		List []grafanaVariable `json:"list"`
+	} `json:"templating"`
+	Panels []grafanaPanel `json:"panels"`
+}
+
+type grafanaVariable struct {
+	Name       string         `json:"name"`
+	Label      string         `json:"label,omitempty"`
+	Type       string         `json:"type"`
+	Query      string         `json:"query"`
+	Datasource *grafanaSource `json:"datasource,omitempty"`
+	Multi      bool           `json:"multi"`
+	IncludeAll bool           `json:"includeAll"`
+	AllValue   string         `json:"allValue,omitempty"`
+	Refresh    int            `json:"refresh,omitempty"`
+}
+
+type grafanaSource struct {
+	Type string `json:"type"`
+	UID  string `json:"uid"`
+}
+
+type grafanaPanel struct {
+	ID         int             `json:"id"`
+	Type       string          `json:"type"`
+	Title      string          `json:"title"`
+	GridPos    grafanaGrid     `json:"gridPos"`
+	Datasource grafanaSource   `json:"datasource"`
+	Targets    []grafanaTarget `json:"targets"`
+	// FieldConfig sets the unit of the values.
+	FieldConfig struct {
+		Defaults struct {
+			Unit string `json:"unit,omitempty"`
+		} `json:"defaults"`
+	} `json:"fieldConfig"`
+}
+
+type grafanaGrid struct {
+	H int `json:"h"`
+	W int `json:"w"`
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+type grafanaTarget struct {
+	RefID        string `json:"refId"`
+	Expr         string `json:"expr"`
+	LegendFormat string `json:"legendFormat"`
+}
+
+// grafanaDashboardOf lays out the panels of the experiment metrics two per
+// row.
+func grafanaDashboardOf(title string) grafanaDashboard {
+	d := grafanaDashboard{UID: "batchexp", Title: title, Tags: []string{"swarm", "postage"}, SchemaVersion: 39, Refresh: "30s"}
+	d.Time.From, d.Time.To = "now-6h", "now"
+	source := &grafanaSource{Type: "prometheus", UID: "${datasource}"}
+	d.Templating.List = []grafanaVariable{{Name: "datasource", Label: "Data source", Type: "datasource", Query: "prometheus"}}
+	for _, label := range []string{"experiment", "node", "batch", "encrypted", "deferred"} {
+		d.Templating.List = append(d.Templating.List, grafanaVariable{
+			Name: label, Type: "query", Query: fmt.Sprintf("label_values(batchexp_uploads_total, %s)", label),
+			Datasource: source, Multi: true, IncludeAll: true, AllValue: ".*", Refresh: 2,
+		})
+	}
+	panels := []struct {
+		kind, title, unit string
+		exprs             []string
+	}{
+		{"timeseries", "Batch fill", "percentunit", []string{"batchexp_bucket_utilization" + dashboardSelector + " / batchexp_bucket_capacity" + dashboardSelector}},
+		{"timeseries", "Fullest bucket", "short", []string{"batchexp_bucket_utilization" + dashboardSelector}},
+		{"timeseries", "Upload throughput", "Bps", []string{"rate(batchexp_uploaded_bytes_total" + dashboardSelector + "[$__rate_interval])"}},
+		{"timeseries", "Chunks per second", "short", []string{"rate(batchexp_uploaded_chunks_total" + dashboardSelector + "[$__rate_interval])"}},
+		{"timeseries", "Uploads and failures per second", "reqps", []string{
+			"rate(batchexp_uploads_total" + dashboardSelector + "[$__rate_interval])",
+			"rate(batchexp_upload_failures_total" + dashboardSelector + "[$__rate_interval])",
+		}},
+		{"stat", "Running experiments", "short", []string{"sum(batchexp_running" + dashboardSelector + ")"}},
+	}
+	for i, p := range panels {
+		panel := grafanaPanel{
+			ID:         i + 1,
+			Type:       p.kind,
+			Title:      p.title,
+			GridPos:    grafanaGrid{H: 8, W: 12, X: 12 * (i % 2), Y: 8 * (i / 2)},
+			Datasource: *source,
+		}
+		panel.FieldConfig.Defaults.Unit = p.unit
+		for j, expr := range p.exprs {
+			legend := "{{experiment}}"
+			if len(p.exprs) > 1 {
+				legend += []string{" uploads", " failures"}[j]
+			}
+			if p.kind == "stat" {
+				legend = ""
+			}
+			panel.Targets = append(panel.Targets, grafanaTarget{RefID: string(rune('A' + j)), Expr: expr, LegendFormat: legend})
+		}
+		d.Panels = append(d.Panels, panel)
+	}
+	return d
+}
+
+func cmdDashboard(args []string) error {
+	fs := newFlagSet("dashboard", "[flags]")
+	out := fs.String("o", "batchexp-dashboard.json", "dashboard file to write")
+	title := fs.String("title", "Batch utilization experiments", "title of the dashboard")
+	provisioning := fs.String("provisioning", "", "also write a Grafana provisioning file loading the dashboard's directory, e.g. /etc/grafana/provisioning/dashboards/batchexp.yaml")
+	fs.Parse(args)
+
+	b, err := json.MarshalIndent(grafanaDashboardOf(*title), "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(*out, append(b, '\n'), 0666)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(console(), "wrote", *out)
+	if *provisioning == "" {
+		return nil
+	}
+	dir, err := filepath.Abs(filepath.Dir(*out))
+	if err != nil {
+		return err
+	}
+	provider := fmt.Sprintf("apiVersion: 1\nproviders:\n  - name: batch-utilization-exp\n    type: file\n    allowUiUpdates: true\n    options:\n      path: %q\n", dir)
+	err = os.WriteFile(*provisioning, []byte(provider), 0666)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(console(), "wrote", *provisioning)
+	return nil
+}
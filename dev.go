@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Bee 2.0 removed dev mode, so the image is pinned to the last 1.x release.
+const defaultDevImage = "ethersphere/bee:1.18.2"
+
+const devStartTimeout = time.Minute
+
+type devNode struct {
+	container string
+	apiURL    string
+	debugURL  string
+}
+
+// startDevNode runs a Bee dev node in a Docker container and waits until it
+// answers health checks.
+func startDevNode(image string) (*devNode, error) {
+	cmd := exec.Command("docker", "run", "-d", "--rm",
+		"-p", "127.0.0.1:1633:1633", "-p", "127.0.0.1:1635:1635",
+		image, "dev",
+		"--api-addr=:1633", "--debug-api-enable", "--debug-api-addr=:1635")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("docker run: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	node := &devNode{
+		container: strings.TrimSpace(string(out)),
+		apiURL:    "http://localhost:1633",
+		debugURL:  "http://localhost:1635",
+	}
+
+	deadline := time.Now().Add(devStartTimeout)
+	for {
+		res, err := http.Get(node.debugURL + "/health")
+		if err == nil {
+			res.Body.Close()
+			if res.StatusCode == http.StatusOK {
+				return node, nil
+			}
+		}
+		if time.Now().After(deadline) {
+			node.stop()
+			return nil, fmt.Errorf("node not healthy after %s", devStartTimeout)
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+func (n *devNode) stop() {
+	err := exec.Command("docker", "rm", "-f", n.container).Run()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "remove dev node:", err)
+	}
+}
+
+// buyBatches buys a fresh batch for every experiment, replacing the
+// configured batch ids.
+func buyBatches(c *Client, exps []Experiment) error {
+	for i := range exps {
+		spec := defaultBatchSpec
+		if exps[i].Buy != nil {
+			spec = *exps[i].Buy
+		}
+		id, err := c.buyStamp(spec.Amount, spec.Depth, spec.Immutable)
+		if err != nil {
+			return fmt.Errorf("%s: buy stamp: %w", exps[i].Name, err)
+		}
+		fmt.Fprintln(console(), exps[i].Name, "bought batch", id, "depth", spec.Depth, "amount", spec.Amount)
+		exps[i].BatchID = id
+	}
+	return nil
+}
+
+// buyMissingBatches buys a batch with the Buy spec for every experiment
+// without a batch id, as the presets have.
+func buyMissingBatches(c *Client, exps []Experiment) error {
+	for i := range exps {
+		if exps[i].BatchID != "" {
+			continue
+		}
+		if exps[i].Buy == nil {
+			return withExitCode(exitConfig, fmt.Errorf("%s: no batch id and no buy spec", exps[i].Name))
+		}
+		err := buyBatches(c, exps[i:i+1])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"time"
+)
+
+type tolerances struct {
+	bytesToFull float64
+	throughput  float64
+	latency     float64
+	errorRate   float64
+}
+
+// diffRuns compares two run results, b being the candidate checked against
+// a, and fails if any metric differs by more than its tolerance.
+func diffRuns(args []string) error {
+	fs := newFlagSet("compare", "[flags] run-a.json run-b.json")
+	var tol tolerances
+	fs.Float64Var(&tol.bytesToFull, "bytes-tolerance", 0.05, "allowed relative difference in bytes to full")
+	fs.Float64Var(&tol.throughput, "throughput-tolerance", 0.2, "allowed relative difference in throughput")
+	fs.Float64Var(&tol.latency, "latency-tolerance", 0.2, "allowed relative difference in latency percentiles")
+	fs.Float64Var(&tol.errorRate, "error-tolerance", 0.01, "allowed absolute difference in error rate")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return fmt.Errorf("need two run files")
+	}
+
+	a, err := loadResult(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	b, err := loadResult(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	failed := diffResults(os.Stdout, a, b, tol)
+	if failed > 0 {
+		return fmt.Errorf("%d metrics outside tolerance", failed)
+	}
+	return nil
+}
+
+// diffResults prints the differences between the runs and returns how many
+// are outside tolerance.
+func diffResults(w io.Writer, a, b *Result, tol tolerances) int {
+	failed := 0
+	check := func(name string, va, vb, diff, tolerance float64, format func(float64) string) {
+		status := "ok"
+		if math.IsNaN(diff) || math.Abs(diff) > tolerance {
+			status = "FAIL"
+			failed++
+		}
+		fmt.Fprintf(w, "%-14s a=%-12s b=%-12s diff=%+.2f%% %s\n", name, format(va), format(vb), diff*100, status)
+	}
+	bytesFormat := func(v float64) string { return prettyByteSize(int(v)) }
+	durationFormat := func(v float64) string { return time.Duration(v).Round(time.Millisecond).String() }
+
+	fmt.Fprintf(w, "a=%s (%s) b=%s (%s)\n", a.Experiment.Name, a.StopReason, b.Experiment.Name, b.StopReason)
+
+	fullA, okA := a.bytesToFull()
+	fullB, okB := b.bytesToFull()
+	if okA && okB {
+		check("bytesToFull", float64(fullA), float64(fullB), relDiff(float64(fullA), float64(fullB)), tol.bytesToFull, bytesFormat)
+	} else if okA != okB {
+		fmt.Fprintf(w, "%-14s a=%-12s b=%-12s FAIL\n", "bytesToFull", formatBytes(fullA, okA), formatBytes(fullB, okB))
+		failed++
+	}
+
+	ta, tb := a.throughput(), b.throughput()
+	check("throughput", ta, tb, relDiff(ta, tb), tol.throughput, func(v float64) string { return prettyByteSize(int(v)) + "/s" })
+
+	for _, p := range []float64{50, 90, 99} {
+		la, lb := float64(a.latencyPercentile(p)), float64(b.latencyPercentile(p))
+		check(fmt.Sprintf("latency p%.0f", p), la, lb, relDiff(la, lb), tol.latency, durationFormat)
+	}
+
+	ea, eb := a.errorRate(), b.errorRate()
+	check("errorRate", ea, eb, eb-ea, tol.errorRate, func(v float64) string { return fmt.Sprintf("%.4f", v) })
+	return failed
+}
+
+func relDiff(a, b float64) float64 {
+	if a == 0 {
+		if b == 0 {
+			return 0
+		}
+		return math.Inf(1)
+	}
+	return (b - a) / a
+}
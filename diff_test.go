@@ -0,0 +1,46 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// filledResult is a run that filled a batch of depth, one chunk per upload.
+// recorded is whether its samples carry the capacity, results written
+// before they did only have the batch.
+func filledResult(name string, depth int, recorded bool) *Result {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	batch := &Batch{BatchID: testBatchID, Depth: depth, BucketDepth: 16, Immutable: true}
+	r := &Result{Experiment: Experiment{Name: name}, Batch: batch, StopReason: stopFull, Start: start}
+	for i := 1; i <= batch.capacity(); i++ {
+		s := Sample{Time: start.Add(time.Duration(i) * time.Second), Bytes: i * chunkSize, Chunks: i, Utilization: i, Latency: time.Second}
+		if recorded {
+			s.Capacity = batch.capacity()
+		}
+		r.Samples = append(r.Samples, s)
+	}
+	r.Uploads, r.End = len(r.Samples), r.Samples[len(r.Samples)-1].Time
+	return r
+}
+
+func TestDiffResultsBytesToFull(t *testing.T) {
+	tol := tolerances{bytesToFull: 0.05, throughput: 0.2, latency: 0.2, errorRate: 0.01}
+	tests := []struct {
+		name   string
+		a, b   *Result
+		failed int
+		want   string
+	}{
+		{"depth 18", filledResult("a", 18, true), filledResult("b", 18, true), 0, "a=16.0KiB"},
+		{"depth 18 without capacities", filledResult("a", 18, true), filledResult("b", 18, false), 0, "b=16.0KiB"},
+		{"depth 22", filledResult("a", 22, true), filledResult("b", 22, true), 0, "a=256.0KiB"},
+		{"deeper candidate", filledResult("a", 18, true), filledResult("b", 19, true), 1, "b=32.0KiB"},
+	}
+	for _, tt := range tests {
+		var w strings.Builder
+		if failed := diffResults(&w, tt.a, tt.b, tol); failed != tt.failed || !strings.Contains(w.String(), tt.want) {
+			t.Errorf("%s: %d failed, want %d with %q in\n%s", tt.name, failed, tt.failed, tt.want, w.String())
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	defaultDiluteThreshold = 90
+	defaultDiluteTimeout   = 10 * time.Minute
+)
+
+// AutoDilute raises the batch depth by one whenever the fullest bucket
+// crosses Threshold percent of the capacity, up to Steps times.
+type AutoDilute struct {
+	Threshold float64 `json:"threshold"`
+	Steps     int     `json:"steps"`
+	// Timeout bounds the wait for the node to report the new depth.
+	Timeout duration `json:"timeout"`
+}
+
+// Dilution is one automatic dilution of a run.
+type Dilution struct {
+	Time              time.Time     `json:"time"`
+	Bytes             int           `json:"bytes"`
+	FromDepth         int           `json:"fromDepth"`
+	ToDepth           int           `json:"toDepth"`
+	CapacityBefore    int           `json:"capacityBefore"`
+	CapacityAfter     int           `json:"capacityAfter"`
+	UtilizationBefore int           `json:"utilizationBefore"`
+	UtilizationAfter  int           `json:"utilizationAfter"`
+	Took              time.Duration `json:"took"`
+}
+
+type diluter struct {
+	cfg  AutoDilute
+	done int
+}
+
+func newDiluter(cfg AutoDilute) *diluter {
+	if cfg.Threshold <= 0 {
+		cfg.Threshold = defaultDiluteThreshold
+	}
+	if cfg.Steps <= 0 {
+		cfg.Steps = 1
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = duration(defaultDiluteTimeout)
+	}
+	return &diluter{cfg: cfg}
+}
+
+func (d *diluter) due(batch *Batch) bool {
+	return d.done < d.cfg.Steps && 100*float64(batch.Utilization) >= d.cfg.Threshold*float64(batch.capacity())
+}
+
+// dilute raises the depth of the batch and waits until the node reports the
+// new depth.
+func (d *diluter) dilute(f io.Writer, c *Client, batch *Batch, bytes int) (*Batch, *Dilution, error) {
+	start := clock.Now()
+	want := batch.Depth + 1
+	log(f, "diluting depth=", batch.Depth, " to=", want, " utilization=", batch.Utilization, " capacity=", batch.capacity())
+	err := c.diluteStamp(batch.BatchID, want)
+	if err != nil {
+		return nil, nil, fmt.Errorf("dilute: %w", err)
+	}
+	d.done++
+	for {
+		after, err := c.getStamp(batch.BatchID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("get stamp: %w", err)
+		}
+		if after.Depth >= want {
+			dl := &Dilution{
+				Time:              clock.Now(),
+				Bytes:             bytes,
+				FromDepth:         batch.Depth,
+				ToDepth:           after.Depth,
+				CapacityBefore:    batch.capacity(),
+				CapacityAfter:     after.capacity(),
+				UtilizationBefore: batch.Utilization,
+				UtilizationAfter:  after.Utilization,
+				Took:              since(start),
+			}
+			log(f, "dilute depth=", dl.FromDepth, "->", dl.ToDepth, " capacity=", dl.CapacityBefore, "->", dl.CapacityAfter,
+				" utilization=", dl.UtilizationBefore, "->", dl.UtilizationAfter, " took=", dl.Took.Round(time.Second))
+			return after, dl, nil
+		}
+		if since(start) >= time.Duration(d.cfg.Timeout) {
+			return nil, nil, fmt.Errorf("dilute: node still reports depth %d after %s", after.Depth, time.Duration(d.cfg.Timeout))
+		}
+		log(f, "waiting for dilution depth=", after.Depth)
+		systemd.alive()
+		clock.Sleep(5 * time.Second)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// lookupSRVNodes resolves the SRV records of name, e.g.
+// _bee._tcp.example.com, to an inventory of http nodes. Bee 2 serves the
+// debug endpoints on the API port, so both use the record's port.
+func lookupSRVNodes(name string) (Inventory, error) {
+	_, addrs, err := net.LookupSRV("", "", name)
+	if err != nil {
+		return Inventory{}, err
+	}
+	var inv Inventory
+	for _, a := range addrs {
+		host := strings.TrimSuffix(a.Target, ".")
+		port := strconv.Itoa(int(a.Port))
+		api := "http://" + net.JoinHostPort(host, port)
+		inv.Nodes = append(inv.Nodes, Node{Name: host + "-" + port, API: api, DebugAPI: api})
+	}
+	if len(inv.Nodes) == 0 {
+		return Inventory{}, fmt.Errorf("no SRV records for %s", name)
+	}
+	return inv, nil
+}
+
+// fetchNodes reads an inventory, as the -nodes file holds, from a
+// discovery URL.
+func fetchNodes(url string) (Inventory, error) {
+	res, err := http.Get(url)
+	if err != nil {
+		return Inventory{}, err
+	}
+	defer res.Body.Close()
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		return Inventory{}, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return Inventory{}, fmt.Errorf("%s: unexpected status %d", url, res.StatusCode)
+	}
+	return parseInventory(url, b)
+}
+
+// followCluster runs the experiments on the discovered nodes and keeps
+// discovering every interval: nodes that join get the experiments started,
+// nodes that are gone get theirs stopped. A node runs the experiments once,
+// the run ends when no node is running any more.
+func followCluster(discover func() (Inventory, error), every time.Duration, cfg Config) error {
+	inv, err := discover()
+	if err != nil {
+		return fmt.Errorf("discover nodes: %w", err)
+	}
+	type finished struct {
+		i   int
+		res nodeResult
+	}
+	var all Inventory
+	var out []nodeResult
+	done := make(chan finished)
+	// quit channels of the running nodes, by name
+	running := map[string]chan struct{}{}
+	ran := map[string]bool{}
+	start := func(node Node) {
+		i := len(all.Nodes)
+		all.Nodes = append(all.Nodes, node)
+		out = append(out, nodeResult{})
+		quit := make(chan struct{})
+		running[node.Name] = quit
+		ran[node.Name] = true
+		go func() {
+			done <- finished{i, runNode(node, cfg, quit)}
+		}()
+	}
+	for _, node := range inv.Nodes {
+		start(node)
+	}
+
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for len(running) > 0 {
+		select {
+		case d := <-done:
+			out[d.i] = d.res
+			delete(running, all.Nodes[d.i].Name)
+		case <-t.C:
+			inv, err := discover()
+			if err != nil {
+				fmt.Fprintln(console(), "discover nodes:", err)
+				continue
+			}
+			seen := map[string]bool{}
+			for _, node := range inv.Nodes {
+				seen[node.Name] = true
+				if !ran[node.Name] {
+					fmt.Fprintln(console(), "node joined", node.Name)
+					start(node)
+				}
+			}
+			for name, quit := range running {
+				if !seen[name] && quit != nil {
+					fmt.Fprintln(console(), "node left", name)
+					close(quit)
+					// stopping, keep it running until its results are in
+					running[name] = nil
+				}
+			}
+		}
+	}
+	return finishCluster(all, cfg, out)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"io/fs"
+	"path/filepath"
+)
+
+// diskUsageStatus makes the disk usage come from the node's reserve size
+// instead of a local data directory.
+const diskUsageStatus = "status"
+
+// stored chunk size: span, payload and the stamp kept alongside it
+const storedChunkSize = spanSize + chunkSize + stampSize
+
+// diskUsage returns the bytes the node uses on disk, either by walking its
+// data directory when the tool runs on the same host, or estimated from the
+// reserve size for remote nodes.
+func (c *Client) diskUsage(source string) (int64, error) {
+	if source == diskUsageStatus {
+		var status struct {
+			ReserveSize int64 `json:"reserveSize"`
+		}
+		err := c.getJSON(c.debugURL+"/status", &status)
+		if err != nil {
+			return 0, err
+		}
+		return status.ReserveSize * storedChunkSize, nil
+	}
+
+	var size int64
+	err := filepath.WalkDir(source, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				// files come and go while the node compacts
+				return nil
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
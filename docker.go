@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultDockerSocket   = "/var/run/docker.sock"
+	defaultDockerInterval = 5 * time.Second
+)
+
+// DockerStats samples the resource usage of the node's container through
+// the Docker API while the run goes on.
+type DockerStats struct {
+	// Container is the container name or id, the dev node's with -dev.
+	Container string `json:"container"`
+	// Socket is the Docker API socket, /var/run/docker.sock by default.
+	Socket string `json:"socket"`
+	// Interval is the time between samples, 5s by default.
+	Interval duration `json:"interval"`
+}
+
+// ContainerStats is the container's resource usage at a sample. The byte
+// counters are totals since the container started.
+type ContainerStats struct {
+	// CPUPercent is the usage since the previous sample, 100 per core and
+	// 0 for the first sample.
+	CPUPercent  float64 `json:"cpuPercent"`
+	MemoryBytes int64   `json:"memoryBytes"`
+	MemoryLimit int64   `json:"memoryLimit"`
+	BlockRead   int64   `json:"blockRead"`
+	BlockWrite  int64   `json:"blockWrite"`
+	NetRx       int64   `json:"netRx"`
+	NetTx       int64   `json:"netTx"`
+}
+
+// dockerStatsResponse is the part of the stats endpoint's answer used.
+type dockerStatsResponse struct {
+	CPUStats struct {
+		CPUUsage struct {
+			TotalUsage uint64 `json:"total_usage"`
+		} `json:"cpu_usage"`
+		SystemUsage uint64 `json:"system_cpu_usage"`
+		OnlineCPUs  int    `json:"online_cpus"`
+	} `json:"cpu_stats"`
+	MemoryStats struct {
+		Usage int64            `json:"usage"`
+		Limit int64            `json:"limit"`
+		Stats map[string]int64 `json:"stats"`
+	} `json:"memory_stats"`
+	BlkioStats struct {
+		IOServiceBytesRecursive []struct {
+			Op    string `json:"op"`
+			Value int64  `json:"value"`
+		} `json:"io_service_bytes_recursive"`
+	} `json:"blkio_stats"`
+	Networks map[string]struct {
+		RxBytes int64 `json:"rx_bytes"`
+		TxBytes int64 `json:"tx_bytes"`
+	} `json:"networks"`
+}
+
+// dockerSampler polls the container's stats in the background, the run
+// loop takes the latest with every sample.
+type dockerSampler struct {
+	cfg  DockerStats
+	http *http.Client
+	f    io.Writer
+	done chan struct{}
+	wg   sync.WaitGroup
+
+	// previous CPU counters, one-shot stats carry none to compare with
+	prevTotal, prevSystem uint64
+
+	mu     sync.Mutex
+	latest *ContainerStats
+}
+
+func newDockerSampler(f io.Writer, cfg DockerStats) *dockerSampler {
+	if cfg.Socket == "" {
+		cfg.Socket = defaultDockerSocket
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = duration(defaultDockerInterval)
+	}
+	socket := cfg.Socket
+	s := &dockerSampler{
+		cfg: cfg,
+		f:   f,
+		http: &http.Client{
+			Timeout: time.Duration(cfg.Interval),
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", socket)
+				},
+			},
+		},
+		done: make(chan struct{}),
+	}
+	s.wg.Add(1)
+	go s.loop()
+	return s
+}
+
+func (s *dockerSampler) loop() {
+	defer s.wg.Done()
+	t := time.NewTicker(time.Duration(s.cfg.Interval))
+	defer t.Stop()
+	logged := false
+	for {
+		stats, err := s.sample()
+		switch {
+		case err != nil && !logged:
+			// once, the socket won't appear during the run
+			log(s.f, "docker stats: ", err)
+			logged = true
+		case err == nil:
+			s.mu.Lock()
+			s.latest = stats
+			s.mu.Unlock()
+		}
+		select {
+		case <-t.C:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *dockerSampler) sample() (*ContainerStats, error) {
+	res, err := s.http.Get("http://docker/containers/" + url.PathEscape(s.cfg.Container) + "/stats?stream=false&one-shot=true")
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d: %s", res.StatusCode, strings.TrimSpace(string(body)))
+	}
+	var r dockerStatsResponse
+	err = json.Unmarshal(body, &r)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &ContainerStats{MemoryBytes: r.MemoryStats.Usage, MemoryLimit: r.MemoryStats.Limit}
+	// page cache doesn't count, as in docker stats; cgroup v1 and v2 name
+	// it differently
+	if v, ok := r.MemoryStats.Stats["total_inactive_file"]; ok && v < stats.MemoryBytes {
+		stats.MemoryBytes -= v
+	} else if v, ok := r.MemoryStats.Stats["inactive_file"]; ok && v < stats.MemoryBytes {
+		stats.MemoryBytes -= v
+	}
+	total, system := r.CPUStats.CPUUsage.TotalUsage, r.CPUStats.SystemUsage
+	if s.prevSystem > 0 && system > s.prevSystem && total >= s.prevTotal {
+		cpus := r.CPUStats.OnlineCPUs
+		if cpus == 0 {
+			cpus = 1
+		}
+		stats.CPUPercent = float64(total-s.prevTotal) / float64(system-s.prevSystem) * float64(cpus) * 100
+	}
+	s.prevTotal, s.prevSystem = total, system
+	for _, b := range r.BlkioStats.IOServiceBytesRecursive {
+		switch strings.ToLower(b.Op) {
+		case "read":
+			stats.BlockRead += b.Value
+		case "write":
+			stats.BlockWrite += b.Value
+		}
+	}
+	for _, n := range r.Networks {
+		stats.NetRx += n.RxBytes
+		stats.NetTx += n.TxBytes
+	}
+	return stats, nil
+}
+
+// stats returns the latest sample, nil before the first one.
+func (s *dockerSampler) stats() *ContainerStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.latest
+}
+
+func (s *dockerSampler) stop() {
+	close(s.done)
+	s.wg.Wait()
+}
@@ -0,0 +1,61 @@
+package main
+
+import "time"
+
+// etaSteps is how many of the most recent utilization steps the prediction is
+// fitted over. Buckets fill unevenly near the end, so older steps would drag
+// the estimate towards the early, faster rate.
+const etaSteps = 4
+
+// predictFull fits a line through the recent utilization curve and returns
+// the bytes and time left until the batch is full at capacity.
+func predictFull(samples []Sample, capacity int) (bytesLeft int, timeLeft time.Duration, ok bool) {
+	if len(samples) < 2 {
+		return 0, 0, false
+	}
+	last := samples[len(samples)-1]
+	start := 0
+	for i := len(samples) - 1; i >= 0; i-- {
+		if samples[i].Utilization < last.Utilization-etaSteps {
+			break
+		}
+		start = i
+	}
+	window := samples[start:]
+	if len(window) < 2 {
+		return 0, 0, false
+	}
+
+	var sumX, sumY, sumXY, sumXX float64
+	for _, s := range window {
+		x, y := float64(s.Bytes), float64(s.Utilization)
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+	n := float64(len(window))
+	denom := n*sumXX - sumX*sumX
+	if denom == 0 {
+		return 0, 0, false
+	}
+	slope := (n*sumXY - sumX*sumY) / denom
+	if slope <= 0 {
+		return 0, 0, false
+	}
+	intercept := (sumY - slope*sumX) / n
+
+	bytesLeft = int((float64(capacity)-intercept)/slope) - last.Bytes
+	if bytesLeft < 0 {
+		bytesLeft = 0
+	}
+
+	first := window[0]
+	elapsed := last.Time.Sub(first.Time)
+	if elapsed <= 0 {
+		return bytesLeft, 0, false
+	}
+	rate := float64(last.Bytes-first.Bytes) / elapsed.Seconds()
+	timeLeft = time.Duration(float64(bytesLeft) / rate * float64(time.Second))
+	return bytesLeft, timeLeft, true
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+const (
+	// defaultReserveCapacity is the reserve size of a bee node in chunks.
+	defaultReserveCapacity = 1 << 22
+	defaultEvictionAt      = 90
+	defaultEvictionEvery   = 10
+	defaultEvictionCheck   = 5
+	// evictionOldest caps the earliest references kept for the retrieval
+	// checks.
+	evictionOldest = 1000
+)
+
+// Eviction uploads until the node's reserve nears its capacity and keeps
+// going, sampling the reserve state and retrieving the earliest uploads, to
+// see how eviction interacts with the batch.
+type Eviction struct {
+	// Capacity is the reserve capacity in chunks, bee's 2^22 by default.
+	Capacity int64 `json:"capacity"`
+	// At is the share of the capacity the eviction phase starts at, 90% by
+	// default.
+	At percent `json:"at"`
+	// Uploads is the number of uploads of the eviction phase, after which
+	// the run ends.
+	Uploads int `json:"uploads"`
+	// Every is the number of uploads between samples, 10 by default.
+	Every int `json:"every"`
+	// Check is how many of the earliest references each sample of the
+	// eviction phase retrieves, 5 by default.
+	Check int `json:"check"`
+	// Metrics are eviction related node metrics scraped with every sample.
+	Metrics []string `json:"metrics"`
+	// Timeout bounds each retrieval, 30s by default.
+	Timeout duration `json:"timeout"`
+}
+
+// ReserveState is the node's view of its reserve.
+type ReserveState struct {
+	Radius        int   `json:"radius"`
+	StorageRadius int   `json:"storageRadius"`
+	Commitment    int64 `json:"commitment"`
+}
+
+func (c *Client) getReserveState() (*ReserveState, error) {
+	var state ReserveState
+	err := c.getJSON(c.debugURL+"/reservestate", &state)
+	if err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+func (c *Client) reserveSize() (int64, error) {
+	var status struct {
+		ReserveSize int64 `json:"reserveSize"`
+	}
+	err := c.getJSON(c.debugURL+"/status", &status)
+	return status.ReserveSize, err
+}
+
+// EvictionSample is the reserve as it was after Bytes were uploaded.
+type EvictionSample struct {
+	Time          time.Time          `json:"time"`
+	Bytes         int                `json:"bytes"`
+	Utilization   int                `json:"utilization"`
+	ReserveSize   int64              `json:"reserveSize"`
+	Radius        int                `json:"radius"`
+	StorageRadius int                `json:"storageRadius"`
+	Metrics       map[string]float64 `json:"metrics,omitempty"`
+	// Checked and Retrieved count the earliest uploads retrieved in the
+	// eviction phase.
+	Checked   int `json:"checked"`
+	Retrieved int `json:"retrieved"`
+}
+
+// EvictionReport is how the reserve and the earliest uploads fared.
+type EvictionReport struct {
+	// StartedAt is the bytes uploaded when the eviction phase began.
+	StartedAt int              `json:"startedAt"`
+	Samples   []EvictionSample `json:"samples"`
+}
+
+type evictionStudy struct {
+	cfg     Eviction
+	oldest  []writtenRef
+	uploads int
+	started bool
+	past    int
+	report  EvictionReport
+}
+
+func newEvictionStudy(cfg Eviction) *evictionStudy {
+	if cfg.Capacity <= 0 {
+		cfg.Capacity = defaultReserveCapacity
+	}
+	if cfg.At <= 0 {
+		cfg.At = defaultEvictionAt
+	}
+	if cfg.Every <= 0 {
+		cfg.Every = defaultEvictionEvery
+	}
+	if cfg.Check <= 0 {
+		cfg.Check = defaultEvictionCheck
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = duration(defaultRetrievalTimeout)
+	}
+	return &evictionStudy{cfg: cfg}
+}
+
+// uploaded samples the reserve when one is due and reports whether the
+// eviction phase is over.
+func (e *evictionStudy) uploaded(f io.Writer, c *Client, ref string, bytes int, batch *Batch) bool {
+	if len(e.oldest) < evictionOldest {
+		e.oldest = append(e.oldest, writtenRef{ref: ref, bytes: bytes})
+	}
+	e.uploads++
+	if e.started {
+		e.past++
+	}
+	if e.uploads%e.cfg.Every != 0 && e.past < e.cfg.Uploads {
+		return false
+	}
+	s := EvictionSample{Time: clock.Now(), Bytes: bytes, Utilization: batch.Utilization}
+	size, err := c.reserveSize()
+	if err != nil {
+		log(f, "reserve size: ", err)
+		return false
+	}
+	s.ReserveSize = size
+	state, err := c.getReserveState()
+	if err != nil {
+		log(f, "reserve state: ", err)
+	} else {
+		s.Radius, s.StorageRadius = state.Radius, state.StorageRadius
+	}
+	if len(e.cfg.Metrics) > 0 {
+		s.Metrics, err = c.scrapeMetrics(e.cfg.Metrics)
+		if err != nil {
+			log(f, "scrape metrics: ", err)
+		}
+	}
+	if !e.started && 100*float64(size) >= float64(e.cfg.At)*float64(e.cfg.Capacity) {
+		e.started = true
+		e.report.StartedAt = bytes
+		log(f, "eviction phase reserveSize=", size, " capacity=", e.cfg.Capacity, " uploads=", e.cfg.Uploads)
+	}
+	if e.started {
+		for _, w := range spread(e.oldest, e.cfg.Check) {
+			ctx, cancel := clock.WithTimeout(context.Background(), time.Duration(e.cfg.Timeout))
+			err := c.retrieve(ctx, w.ref)
+			cancel()
+			s.Checked++
+			if err == nil {
+				s.Retrieved++
+			}
+		}
+	}
+	e.report.Samples = append(e.report.Samples, s)
+	log(f, "reserve reserveSize=", s.ReserveSize, " fill=", ratio(s.ReserveSize, e.cfg.Capacity), " radius=", s.Radius, " storageRadius=", s.StorageRadius,
+		" utilization=", s.Utilization, " oldestRetrieved=", s.Retrieved, "/", s.Checked, metricsField(e.cfg.Metrics, s.Metrics))
+	return e.started && e.past >= e.cfg.Uploads
+}
+
+func metricsField(names []string, values map[string]float64) string {
+	if len(names) == 0 {
+		return ""
+	}
+	return " " + formatMetrics(names, values)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Exit codes, so wrapper scripts can branch on the outcome of a run. A batch
+// filling up is the expected end of an experiment and exits 0.
+const (
+	exitOK          = 0
+	exitError       = 1
+	exitUsage       = 2
+	exitConfig      = 3
+	exitUnreachable = 4
+	exitExpired     = 5
+	exitMaxBytes    = 6
+	exitRegression  = 7
+)
+
+// exitErr carries the exit code for an error returned by a command.
+type exitErr struct {
+	code int
+	err  error
+}
+
+func (e *exitErr) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitErr) Unwrap() error {
+	return e.err
+}
+
+func withExitCode(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &exitErr{code: code, err: err}
+}
+
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	var e *exitErr
+	if errors.As(err, &e) {
+		return e.code
+	}
+	return exitError
+}
+
+// outcomeCode picks the exit code of finished runs: failures first, then
+// expired batches and runs that hit their byte limit.
+func outcomeCode(results []*Result) (int, error) {
+	var failed, unreachable, expired, maxBytes int
+	for _, r := range results {
+		switch r.StopReason {
+		case stopError:
+			failed++
+			if isConnError(r.err) {
+				unreachable++
+			}
+		case stopExpired:
+			expired++
+		case stopMaxBytes:
+			maxBytes++
+		}
+	}
+	switch {
+	case failed > 0 && failed == unreachable:
+		return exitUnreachable, fmt.Errorf("%d of %d experiments lost the node", failed, len(results))
+	case failed > 0:
+		return exitError, fmt.Errorf("%d of %d experiments failed", failed, len(results))
+	case expired > 0:
+		return exitExpired, fmt.Errorf("%d of %d batches expired", expired, len(results))
+	case maxBytes > 0:
+		return exitMaxBytes, fmt.Errorf("%d of %d experiments reached their byte limit", maxBytes, len(results))
+	}
+	return exitOK, nil
+}
@@ -1,3 +1,11 @@
 module example
 
 go 1.18
+
+require (
+	github.com/decred/dcrd/dcrec/secp256k1/v4 v4.2.0
+	go.starlark.net v0.0.0-20231013162135-47c85baa7a64
+	golang.org/x/crypto v0.14.0
+)
+
+require golang.org/x/sys v0.13.0 // indirect
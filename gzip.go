@@ -0,0 +1,63 @@
+package main
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"strings"
+)
+
+const gzipSuffix = ".gz"
+
+// outName is the name of an output file, with the gzip suffix when the
+// outputs are compressed.
+func outName(name string) string {
+	if global.gzip {
+		return name + gzipSuffix
+	}
+	return name
+}
+
+func isGzip(path string) bool {
+	return strings.HasSuffix(path, gzipSuffix)
+}
+
+// openInput opens a log, series or result file, decompressing it when its
+// name ends in .gz.
+func openInput(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if !isGzip(path) {
+		return f, nil
+	}
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &gzipInput{zr: zr, f: f}, nil
+}
+
+// gzipInput reads a gzip file the way the writers left it. A run that was
+// killed leaves a stream without a trailer after the last flush, which reads
+// as a regular end of file.
+type gzipInput struct {
+	zr *gzip.Reader
+	f  *os.File
+}
+
+func (g *gzipInput) Read(p []byte) (int, error) {
+	n, err := g.zr.Read(p)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (g *gzipInput) Close() error {
+	g.zr.Close()
+	return g.f.Close()
+}
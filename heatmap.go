@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+	"time"
+)
+
+// maxHeatmapFrames bounds the snapshots kept in the heatmap page, older
+// frames are thinned out beyond that.
+const maxHeatmapFrames = 100
+
+// heatmapWidth is the width the bucket grid is scaled up to.
+const heatmapWidth = 512
+
+// heatmap renders snapshots of the bucket fill levels of a batch as a grid
+// of colored cells, one per bucket, into an HTML page of all snapshots.
+type heatmap struct {
+	path   string
+	name   string
+	frames []heatmapFrame
+}
+
+type heatmapFrame struct {
+	Time     time.Time
+	Max      int
+	Capacity int
+	Full     int
+	PNG      template.URL
+}
+
+func newHeatmap(path, name string) *heatmap {
+	return &heatmap{path: path, name: name}
+}
+
+// snapshot fetches the buckets, adds them as a frame and rewrites the page.
+func (h *heatmap) snapshot(c *Client, batchID string) error {
+	b, err := c.getBuckets(batchID)
+	if err != nil {
+		return fmt.Errorf("get buckets: %w", err)
+	}
+	capacity := 1 << (b.Depth - b.BucketDepth)
+	counts := make([]int, 1<<b.BucketDepth)
+	frame := heatmapFrame{Time: clock.Now(), Capacity: capacity}
+	for _, bucket := range b.Buckets {
+		if bucket.BucketID >= len(counts) {
+			continue
+		}
+		counts[bucket.BucketID] = bucket.Collisions
+		if bucket.Collisions > frame.Max {
+			frame.Max = bucket.Collisions
+		}
+		if bucket.Collisions >= capacity {
+			frame.Full++
+		}
+	}
+	img, err := renderBuckets(counts, capacity)
+	if err != nil {
+		return err
+	}
+	frame.PNG = template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(img))
+	h.frames = append(h.frames, frame)
+	if len(h.frames) > maxHeatmapFrames {
+		// keep the first and every other frame after it
+		kept := h.frames[:1]
+		for i := 2; i < len(h.frames)-1; i += 2 {
+			kept = append(kept, h.frames[i])
+		}
+		h.frames = append(kept, h.frames[len(h.frames)-1])
+	}
+	return h.write()
+}
+
+// record takes a snapshot, logging instead of failing the run.
+func (h *heatmap) record(f io.Writer, c *Client, batchID string) {
+	err := h.snapshot(c, batchID)
+	if err != nil {
+		log(f, "heatmap: ", err)
+	}
+}
+
+// renderBuckets draws the buckets row by row into a square-ish grid.
+func renderBuckets(counts []int, capacity int) ([]byte, error) {
+	side := 1
+	for side*side < len(counts) {
+		side *= 2
+	}
+	rows := (len(counts) + side - 1) / side
+	scale := heatmapWidth / side
+	if scale < 1 {
+		scale = 1
+	}
+	img := image.NewRGBA(image.Rect(0, 0, side*scale, rows*scale))
+	for i, n := range counts {
+		x, y := i%side*scale, i/side*scale
+		col := fillColor(float64(n) / float64(capacity))
+		for dy := 0; dy < scale; dy++ {
+			for dx := 0; dx < scale; dx++ {
+				img.Set(x+dx, y+dy, col)
+			}
+		}
+	}
+	var buf bytes.Buffer
+	err := png.Encode(&buf, img)
+	return buf.Bytes(), err
+}
+
+// fillColor goes from dark blue for empty buckets over yellow to red for
+// full ones.
+func fillColor(fill float64) color.RGBA {
+	if fill > 1 {
+		fill = 1
+	}
+	if fill < 0.5 {
+		t := fill * 2
+		return color.RGBA{R: uint8(255 * t), G: uint8(40 + 215*t), B: uint8(120 * (1 - t)), A: 255}
+	}
+	t := (fill - 0.5) * 2
+	return color.RGBA{R: 255, G: uint8(255 * (1 - t)), A: 255}
+}
+
+var heatmapPage = template.Must(template.New("heatmap").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Name}} bucket heatmap</title>
+<style>
+body { font-family: sans-serif; background: #111; color: #ddd; }
+figure { display: inline-block; margin: 8px; }
+img { image-rendering: pixelated; }
+</style>
+</head>
+<body>
+<h1>{{.Name}} bucket fill</h1>
+<p>One cell per bucket, dark blue is empty, yellow half full and red full.</p>
+{{range .Frames}}<figure>
+<img src="{{.PNG}}" alt="buckets at {{.Time.Format "2006-01-02T15:04:05Z07:00"}}">
+<figcaption>{{.Time.Format "2006-01-02T15:04:05Z07:00"}} fullest={{.Max}}/{{.Capacity}} full={{.Full}}</figcaption>
+</figure>
+{{end}}</body>
+</html>
+`))
+
+func (h *heatmap) write() error {
+	f, err := os.Create(h.path)
+	if err != nil {
+		return err
+	}
+	err = heatmapPage.Execute(f, struct {
+		Name   string
+		Frames []heatmapFrame
+	}{h.name, h.frames})
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const defaultHookTimeout = 30 * time.Second
+
+// Hooks are commands run on events of an experiment, each getting the
+// event as JSON on stdin. A command is the program and its arguments.
+type Hooks struct {
+	// BeforeUpload runs before every upload, the upload fails when it
+	// exits non-zero.
+	BeforeUpload []string `json:"beforeUpload"`
+	// Milestone runs whenever the fullest bucket crosses an alert
+	// threshold.
+	Milestone []string `json:"milestone"`
+	// Done runs once the run ended, with its summary.
+	Done []string `json:"done"`
+	// Timeout bounds every command, 30s by default.
+	Timeout duration `json:"timeout"`
+}
+
+// hookEvent is what a hook command reads on stdin.
+type hookEvent struct {
+	Event      string    `json:"event"`
+	Experiment string    `json:"experiment"`
+	BatchID    string    `json:"batchID"`
+	Time       time.Time `json:"time"`
+	// Size is the payload size of the upload about to start.
+	Size int `json:"size,omitempty"`
+	// Alert is the threshold crossed at a milestone.
+	Alert *Alert `json:"alert,omitempty"`
+	// Summary is the outcome of the run when done.
+	Summary *summary `json:"summary,omitempty"`
+}
+
+// run runs cmd with the event on stdin and returns its error, including
+// what it wrote to stderr. No command does nothing.
+func (h *Hooks) run(cmd []string, e hookEvent) error {
+	if len(cmd) == 0 {
+		return nil
+	}
+	e.Time = clock.Now()
+	in, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	timeout := time.Duration(h.Timeout)
+	if timeout <= 0 {
+		timeout = defaultHookTimeout
+	}
+	ctx, cancel := clock.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	c := exec.CommandContext(ctx, cmd[0], cmd[1:]...)
+	c.Stdin = bytes.NewReader(in)
+	var stderr bytes.Buffer
+	c.Stderr = &stderr
+	err = c.Run()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%s hook: %w: %s", e.Event, err, msg)
+		}
+		return fmt.Errorf("%s hook: %w", e.Event, err)
+	}
+	return nil
+}
+
+// notify runs a hook whose failure doesn't affect the run, only logs it.
+func (h *Hooks) notify(f io.Writer, cmd []string, e hookEvent) {
+	if h == nil {
+		return
+	}
+	err := h.run(cmd, e)
+	if err != nil {
+		log(f, err)
+	}
+}
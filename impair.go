@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Impairment slows the uploads down on the client side, to study slow
+// uploaders. Latency delays the first byte of every upload and Bandwidth
+// caps the upload rate in bytes per second.
+type Impairment struct {
+	Latency   duration `json:"latency"`
+	Bandwidth int      `json:"bandwidth"`
+}
+
+// impair wraps the body of an upload request with the impairment, keeping
+// the content length so the upload isn't sent chunked.
+func impair(req *http.Request, im *Impairment) {
+	if im == nil || req.Body == nil {
+		return
+	}
+	req.Body = &slowReader{ctx: req.Context(), r: req.Body, latency: time.Duration(im.Latency), rate: im.Bandwidth}
+	req.GetBody = nil
+}
+
+type slowReader struct {
+	// ctx is the context of the upload, a canceled one ends the waits
+	ctx     context.Context
+	r       io.ReadCloser
+	latency time.Duration
+	rate    int
+	start   time.Time
+	n       int
+}
+
+func (s *slowReader) Read(p []byte) (int, error) {
+	if s.start.IsZero() {
+		err := s.wait(s.latency)
+		if err != nil {
+			return 0, err
+		}
+		s.start = clock.Now()
+	}
+	if s.rate <= 0 {
+		return s.r.Read(p)
+	}
+	// read at most a tenth of a second worth of data at a time so the
+	// rate stays smooth
+	if max := s.rate / 10; max > 0 && len(p) > max {
+		p = p[:max]
+	}
+	n, err := s.r.Read(p)
+	s.n += n
+	due := s.start.Add(time.Duration(float64(s.n) / float64(s.rate) * float64(time.Second)))
+	if werr := s.wait(until(due)); werr != nil {
+		return n, werr
+	}
+	return n, err
+}
+
+// wait sleeps for d or until the upload is canceled.
+func (s *slowReader) wait(d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	select {
+	case <-clock.After(d):
+		return nil
+	case <-s.ctx.Done():
+		return s.ctx.Err()
+	}
+}
+
+func (s *slowReader) Close() error {
+	return s.r.Close()
+}
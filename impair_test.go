@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestSlowReaderCancel(t *testing.T) {
+	tests := []struct {
+		name string
+		im   Impairment
+		// read is what the first read gets before the reader waits
+		read int
+	}{
+		{"latency", Impairment{Latency: duration(time.Hour)}, 0},
+		{"bandwidth", Impairment{Bandwidth: 100}, 10},
+	}
+	for _, tt := range tests {
+		fc := newFakeClock()
+		useClock(t, fc)
+		ctx, cancel := context.WithCancel(context.Background())
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://bee/bytes", bytes.NewReader(make([]byte, 1000)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		impair(req, &tt.im)
+		type read struct {
+			n   int
+			err error
+		}
+		done := make(chan read, 1)
+		go func() {
+			n, err := req.Body.Read(make([]byte, 1000))
+			done <- read{n, err}
+		}()
+		// the reader waits on a clock that never moves until canceled
+		eventually(t, tt.name+" wait", func() bool { return fc.waiting() == 1 })
+		cancel()
+		select {
+		case r := <-done:
+			if r.n != tt.read || !errors.Is(r.err, context.Canceled) {
+				t.Errorf("%s: read %d, %v, want %d and the cancellation", tt.name, r.n, r.err, tt.read)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s: the canceled upload still waits", tt.name)
+		}
+	}
+}
+
+func TestSlowReaderRate(t *testing.T) {
+	fc := newFakeClock()
+	useClock(t, fc)
+	req, err := http.NewRequest(http.MethodPost, "http://bee/bytes", bytes.NewReader(make([]byte, 1000)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	impair(req, &Impairment{Latency: duration(time.Second), Bandwidth: 500})
+	done := make(chan []byte, 1)
+	go func() {
+		b, _ := io.ReadAll(req.Body)
+		done <- b
+	}()
+	// one second of latency and two of reading at 500 bytes a second
+	for i := 0; i < 30; i++ {
+		eventually(t, "the next wait", func() bool { return fc.waiting() == 1 })
+		fc.advance(100 * time.Millisecond)
+	}
+	select {
+	case b := <-done:
+		if len(b) != 1000 {
+			t.Errorf("read %d bytes, want 1000", len(b))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the upload still reads after three seconds")
+	}
+}
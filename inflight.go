@@ -0,0 +1,132 @@
+package main
+
+import (
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// minLevelUploads is how many uploads a level needs to be the best one,
+// fewer don't give a throughput worth comparing.
+const minLevelUploads = 3
+
+// InFlightLevel is how the node took the uploads while this many were in
+// flight.
+type InFlightLevel struct {
+	InFlight int           `json:"inFlight"`
+	Time     time.Duration `json:"time"`
+	Uploads  int           `json:"uploads"`
+	Bytes    int           `json:"bytes"`
+	// Throughput is in bytes per second.
+	Throughput float64 `json:"throughput"`
+}
+
+// InFlightReport is the throughput of the node at every level of uploads
+// in flight the run went through, Best is the level that got the most.
+type InFlightReport struct {
+	Best   int             `json:"best"`
+	Levels []InFlightLevel `json:"levels"`
+}
+
+// levelStats accumulate the time spent at the levels of uploads in flight
+// and the uploads finished at them, guarded by the pipeline's mu. An
+// upload counts for the mean level over its lifetime, and the throughput
+// of a level is by Little's law the level times the bytes an upload moves
+// per second of its time.
+type levelStats struct {
+	changed time.Time
+	// area is the integral of the level over time, in level seconds
+	area   float64
+	levels map[int]*levelStat
+}
+
+type levelStat struct {
+	InFlightLevel
+	// busy is the time the uploads of the level took
+	busy time.Duration
+}
+
+func (s *levelStats) level(n int) *levelStat {
+	if s.levels == nil {
+		s.levels = map[int]*levelStat{}
+	}
+	l, ok := s.levels[n]
+	if !ok {
+		l = &levelStat{InFlightLevel: InFlightLevel{InFlight: n}}
+		s.levels[n] = l
+	}
+	return l
+}
+
+// tick accounts the time since the last change to the level that held
+// meanwhile and returns the clock and area now. The caller holds mu.
+func (s *levelStats) tick(active int) (time.Time, float64) {
+	now := clock.Now()
+	if !s.changed.IsZero() {
+		d := now.Sub(s.changed)
+		s.level(active).Time += d
+		s.area += float64(active) * d.Seconds()
+	}
+	s.changed = now
+	return now, s.area
+}
+
+// finished counts an upload of bytes that started at start and area.
+// The caller holds mu.
+func (s *levelStats) finished(active int, start time.Time, area float64, bytes int) {
+	now, end := s.tick(active)
+	d := now.Sub(start)
+	n := active
+	if d > 0 {
+		n = int(math.Round((end - area) / d.Seconds()))
+	}
+	l := s.level(n)
+	l.Uploads++
+	l.Bytes += bytes
+	l.busy += d
+}
+
+// report is nil unless uploads finished at two levels or more.
+func (s *levelStats) report() *InFlightReport {
+	r := &InFlightReport{}
+	for _, l := range s.levels {
+		if l.Uploads == 0 || l.busy <= 0 || l.InFlight == 0 {
+			continue
+		}
+		l.Throughput = float64(l.InFlight) * float64(l.Bytes) / l.busy.Seconds()
+		r.Levels = append(r.Levels, l.InFlightLevel)
+	}
+	if len(r.Levels) < 2 {
+		return nil
+	}
+	sort.Slice(r.Levels, func(i, j int) bool { return r.Levels[i].InFlight < r.Levels[j].InFlight })
+	var best float64
+	for _, l := range r.Levels {
+		if l.Uploads >= minLevelUploads && l.Throughput > best {
+			r.Best, best = l.InFlight, l.Throughput
+		}
+	}
+	return r
+}
+
+func logInFlight(f io.Writer, r *InFlightReport) {
+	for _, l := range r.Levels {
+		log(f, "inFlight level=", l.InFlight, " uploads=", l.Uploads, " time=", l.Time.Round(time.Millisecond), " throughput=", prettyByteSize(int(l.Throughput)), "/s")
+	}
+	best := "-"
+	if r.Best > 0 {
+		best = strconv.Itoa(r.Best)
+	}
+	log(f, "inFlight best=", best)
+}
+
+// uploadSlots is how many uploads the experiment runs at once, the level
+// ramps and backpressure adjust.
+func (e Experiment) uploadSlots() int {
+	if e.InFlight > 0 {
+		return e.InFlight
+	}
+	return e.Concurrency
+}
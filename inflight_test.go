@@ -0,0 +1,125 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// stepClock is the wall clock with a time that only moves when the test
+// steps it.
+type stepClock struct {
+	wallClock
+	now time.Time
+}
+
+func (c *stepClock) Now() time.Time { return c.now }
+
+// useStepClock swaps the global clock for a step clock for the duration of
+// the test.
+func useStepClock(t *testing.T) *stepClock {
+	c := &stepClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	old := clock
+	clock = c
+	t.Cleanup(func() { clock = old })
+	return c
+}
+
+// levelPhase runs rounds of level uploads at once, each taking took and
+// moving bytes.
+type levelPhase struct {
+	level, rounds int
+	took          time.Duration
+	bytes         int
+}
+
+// runLevels drives levelStats the way the pipeline does: a tick before
+// every change of the level and one when the upload starts.
+func runLevels(sc *stepClock, phases []levelPhase) *levelStats {
+	s := &levelStats{}
+	active := 0
+	for _, ph := range phases {
+		for r := 0; r < ph.rounds; r++ {
+			starts := make([]time.Time, ph.level)
+			areas := make([]float64, ph.level)
+			for i := 0; i < ph.level; i++ {
+				s.tick(active)
+				active++
+				starts[i], areas[i] = s.tick(active)
+			}
+			sc.now = sc.now.Add(ph.took)
+			for i := 0; i < ph.level; i++ {
+				s.finished(active, starts[i], areas[i], ph.bytes)
+				s.tick(active)
+				active--
+			}
+		}
+	}
+	s.tick(active)
+	return s
+}
+
+func TestLevelStatsReport(t *testing.T) {
+	tests := []struct {
+		name   string
+		phases []levelPhase
+		// best is the best level, -1 for no report
+		best int
+		// throughput of every level in the report, bytes per second
+		throughput map[int]float64
+	}{
+		{"one level", []levelPhase{{1, 3, time.Second, 100}}, -1, nil},
+		{"scales", []levelPhase{{1, 3, time.Second, 100}, {2, 3, time.Second, 100}}, 2, map[int]float64{1: 100, 2: 200}},
+		{"saturated", []levelPhase{{1, 3, time.Second, 100}, {2, 3, 3 * time.Second, 100}, {4, 1, 6 * time.Second, 100}},
+			1, map[int]float64{1: 100, 2: 200 / 3.0, 4: 400 / 6.0}},
+		{"too few uploads", []levelPhase{{1, 3, time.Second, 100}, {2, 1, time.Second, 100}}, 1, map[int]float64{1: 100, 2: 200}},
+		{"none good enough", []levelPhase{{1, 2, time.Second, 100}, {2, 1, time.Second, 100}}, 0, map[int]float64{1: 100, 2: 200}},
+	}
+	for _, tt := range tests {
+		r := runLevels(useStepClock(t), tt.phases).report()
+		if tt.best < 0 {
+			if r != nil {
+				t.Errorf("%s: got a report of %d levels, want none", tt.name, len(r.Levels))
+			}
+			continue
+		}
+		if r == nil {
+			t.Errorf("%s: no report", tt.name)
+			continue
+		}
+		if r.Best != tt.best {
+			t.Errorf("%s: best level %d, want %d", tt.name, r.Best, tt.best)
+		}
+		if len(r.Levels) != len(tt.throughput) {
+			t.Errorf("%s: %d levels, want %d", tt.name, len(r.Levels), len(tt.throughput))
+		}
+		for i, l := range r.Levels {
+			if i > 0 && l.InFlight <= r.Levels[i-1].InFlight {
+				t.Errorf("%s: levels out of order", tt.name)
+			}
+			if want := tt.throughput[l.InFlight]; math.Abs(l.Throughput-want) > 1e-6 {
+				t.Errorf("%s: level %d throughput %.2f, want %.2f", tt.name, l.InFlight, l.Throughput, want)
+			}
+		}
+	}
+}
+
+func TestLevelStatsTime(t *testing.T) {
+	s := runLevels(useStepClock(t), []levelPhase{{1, 2, time.Second, 10}, {3, 2, 5 * time.Second, 10}})
+	for level, want := range map[int]time.Duration{1: 2 * time.Second, 3: 10 * time.Second} {
+		l := s.levels[level]
+		if l == nil {
+			t.Errorf("level %d: missing", level)
+			continue
+		}
+		if l.Time != want {
+			t.Errorf("level %d: time %v, want %v", level, l.Time, want)
+		}
+		if l.Uploads != 2*level {
+			t.Errorf("level %d: %d uploads, want %d", level, l.Uploads, 2*level)
+		}
+	}
+	if s.area != 2+3*10 {
+		t.Errorf("area %v level seconds, want 32", s.area)
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// batchAnnotation prefixes pod annotations naming the pod's batch for an
+// experiment, e.g. batch-utilization-exp/encrypted: <batch id>.
+const batchAnnotation = "batch-utilization-exp/"
+
+type k8sDiscovery struct {
+	Namespace string
+	// Selector is a label selector for the bee pods. Service is used to
+	// derive one when empty.
+	Selector  string
+	Service   string
+	APIPort   int
+	DebugPort int
+}
+
+type k8sClient struct {
+	host  string
+	token string
+	http  *http.Client
+}
+
+// newK8sClient authenticates with the pod's service account, which only
+// works when running inside the cluster.
+func newK8sClient() (*k8sClient, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("not running inside a kubernetes cluster")
+	}
+	token, err := os.ReadFile(serviceAccountDir + "/token")
+	if err != nil {
+		return nil, err
+	}
+	ca, err := os.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("invalid service account ca")
+	}
+	return &k8sClient{
+		host:  "https://" + net.JoinHostPort(host, port),
+		token: strings.TrimSpace(string(token)),
+		http: &http.Client{
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+		},
+	}, nil
+}
+
+func (k *k8sClient) get(path string, v any) error {
+	req, err := http.NewRequest(http.MethodGet, k.host+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Authorization", "Bearer "+k.token)
+	res, err := k.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d: %s", res.StatusCode, body)
+	}
+	return json.Unmarshal(body, v)
+}
+
+type k8sCondition struct {
+	Type   string `json:"type"`
+	Status string `json:"status"`
+}
+
+type k8sPodList struct {
+	Items []struct {
+		Metadata struct {
+			Name        string            `json:"name"`
+			Annotations map[string]string `json:"annotations"`
+		} `json:"metadata"`
+		Status struct {
+			Phase      string         `json:"phase"`
+			PodIP      string         `json:"podIP"`
+			Conditions []k8sCondition `json:"conditions"`
+		} `json:"status"`
+	} `json:"items"`
+}
+
+// discoverNodes lists the ready bee pods matching the selector and returns
+// them as an inventory addressed by pod IP.
+func discoverNodes(d k8sDiscovery) (Inventory, error) {
+	k, err := newK8sClient()
+	if err != nil {
+		return Inventory{}, err
+	}
+	if d.Namespace == "" {
+		ns, err := os.ReadFile(serviceAccountDir + "/namespace")
+		if err != nil {
+			return Inventory{}, err
+		}
+		d.Namespace = strings.TrimSpace(string(ns))
+	}
+
+	selector := d.Selector
+	if selector == "" {
+		if d.Service == "" {
+			return Inventory{}, fmt.Errorf("need a label selector or service")
+		}
+		var svc struct {
+			Spec struct {
+				Selector map[string]string `json:"selector"`
+			} `json:"spec"`
+		}
+		err = k.get("/api/v1/namespaces/"+url.PathEscape(d.Namespace)+"/services/"+url.PathEscape(d.Service), &svc)
+		if err != nil {
+			return Inventory{}, fmt.Errorf("get service %s: %w", d.Service, err)
+		}
+		var labels []string
+		for k, v := range svc.Spec.Selector {
+			labels = append(labels, k+"="+v)
+		}
+		sort.Strings(labels)
+		selector = strings.Join(labels, ",")
+	}
+
+	var pods k8sPodList
+	err = k.get("/api/v1/namespaces/"+url.PathEscape(d.Namespace)+"/pods?labelSelector="+url.QueryEscape(selector), &pods)
+	if err != nil {
+		return Inventory{}, fmt.Errorf("list pods: %w", err)
+	}
+
+	var inv Inventory
+	for _, p := range pods.Items {
+		if p.Status.Phase != "Running" || p.Status.PodIP == "" || !podReady(p.Status.Conditions) {
+			continue
+		}
+		node := Node{
+			Name:     p.Metadata.Name,
+			API:      "http://" + net.JoinHostPort(p.Status.PodIP, strconv.Itoa(d.APIPort)),
+			DebugAPI: "http://" + net.JoinHostPort(p.Status.PodIP, strconv.Itoa(d.DebugPort)),
+			Batches:  map[string]string{},
+		}
+		for k, v := range p.Metadata.Annotations {
+			if strings.HasPrefix(k, batchAnnotation) {
+				node.Batches[strings.TrimPrefix(k, batchAnnotation)] = v
+			}
+		}
+		inv.Nodes = append(inv.Nodes, node)
+	}
+	if len(inv.Nodes) == 0 {
+		return Inventory{}, fmt.Errorf("no ready pods in %s matching %q", d.Namespace, selector)
+	}
+	return inv, nil
+}
+
+func podReady(conditions []k8sCondition) bool {
+	for _, c := range conditions {
+		if c.Type == "Ready" {
+			return c.Status == "True"
+		}
+	}
+	return false
+}
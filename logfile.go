@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// logFlushInterval bounds how long a log record stays in the buffer, so
+// tailing the log still follows the run.
+const logFlushInterval = time.Second
+
+// logFile is an append-only log file whose writes are buffered and flushed
+// periodically and on Close, instead of a write syscall per record. It is
+// safe for concurrent use by the pipeline's workers. Paths ending in .gz are
+// compressed, every flush ends a deflate block so a killed run leaves a
+// readable log.
+type logFile struct {
+	mu   sync.Mutex
+	file *os.File
+	gz   *gzip.Writer
+	buf  *bufio.Writer
+	// dirty is set by writes since the last flush
+	dirty bool
+	done  chan struct{}
+	wg    sync.WaitGroup
+}
+
+func openLog(path string) (*logFile, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, err
+	}
+	l := &logFile{
+		file: file,
+		done: make(chan struct{}),
+	}
+	var w io.Writer = file
+	if isGzip(path) {
+		l.gz = gzip.NewWriter(file)
+		w = l.gz
+	}
+	l.buf = bufio.NewWriterSize(w, 64*1024)
+	l.wg.Add(1)
+	go l.flushLoop()
+	return l, nil
+}
+
+func (l *logFile) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.dirty = true
+	return l.buf.Write(p)
+}
+
+func (l *logFile) Flush() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.dirty {
+		return nil
+	}
+	l.dirty = false
+	err := l.buf.Flush()
+	if err != nil || l.gz == nil {
+		return err
+	}
+	return l.gz.Flush()
+}
+
+func (l *logFile) flushLoop() {
+	defer l.wg.Done()
+	t := time.NewTicker(logFlushInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			_ = l.Flush()
+		case <-l.done:
+			return
+		}
+	}
+}
+
+// Close flushes the buffered records and closes the file.
+func (l *logFile) Close() error {
+	close(l.done)
+	l.wg.Wait()
+	err := l.Flush()
+	if err == nil && l.gz != nil {
+		err = l.gz.Close()
+	}
+	cerr := l.file.Close()
+	if err != nil {
+		return err
+	}
+	return cerr
+}
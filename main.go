@@ -1,32 +1,41 @@
 package main
 
 import (
-	"bytes"
 	"crypto/rand"
-	"encoding/json"
+	"encoding/binary"
 	"fmt"
 	"io"
 	"math"
-	"net/http"
+	mrand "math/rand"
 	"os"
 	"strconv"
 	"sync"
 	"time"
 )
 
-const baseURL = "http://localhost:1635"
+const fullUtilization = 16
 
-type Batch struct {
-	BatchID     string `json:"batchID"`
-	Utilization int    `json:"utilization"`
-	Expired     bool   `json:"expired"`
-	Usable      bool   `json:"usable"`
-}
-
-func generateFile(size int) ([]byte, error) {
+// generateFile returns size random bytes. The fast generator is not
+// cryptographically secure, only unique enough that payloads don't repeat,
+// and saves the crypto/rand CPU cost of big payloads.
+func generateFile(size int, random string) ([]byte, error) {
 	b := make([]byte, size)
-	_, err := rand.Read(b)
-	return b, err
+	if random != randomFast {
+		_, err := rand.Read(b)
+		return b, err
+	}
+	var seed [8]byte
+	_, err := rand.Read(seed[:])
+	if err != nil {
+		return nil, err
+	}
+	r := mrand.New(mrand.NewSource(int64(binary.LittleEndian.Uint64(seed[:]))))
+	var w [8]byte
+	for i := 0; i < size; i += 8 {
+		binary.LittleEndian.PutUint64(w[:], r.Uint64())
+		copy(b[i:], w[:])
+	}
+	return b, nil
 }
 
 func prettyByteSize(b int) string {
@@ -40,147 +49,755 @@ func prettyByteSize(b int) string {
 	return fmt.Sprintf("%.1fYiB", bf)
 }
 
+func ratio(a, b int64) string {
+	if b == 0 {
+		return "-"
+	}
+	return strconv.FormatFloat(float64(a)/float64(b), 'f', 4, 64)
+}
+
 func log(f io.Writer, m ...any) {
-	_, _ = fmt.Fprintln(f, time.Now().Format(time.RFC3339), fmt.Sprint(m...))
+	_, _ = fmt.Fprintln(f, clock.Now().Format(time.RFC3339), fmt.Sprint(m...))
 }
 
-func getStamp(batchID string) (*Batch, error) {
-	client := &http.Client{}
-	req, err := http.NewRequest(http.MethodGet, baseURL+"/stamps/"+batchID, nil)
+func run(exp Experiment, c *Client, stop <-chan error) (res *Result, err error) {
+	res = &Result{Experiment: exp, Start: clock.Now(), API: c.apiURL}
+	file, err := openLog(outPath(outName(exp.Name + ".log")))
 	if err != nil {
-		return nil, err
+		return res, fmt.Errorf("error opening file: %v", err)
 	}
-	res, err := client.Do(req)
-	if err != nil {
-		fmt.Println(err)
-		return nil, err
+	defer file.Close()
+	f := logWriter(file, exp.Name)
+	if global.verbose {
+		f = io.MultiWriter(f, newConsoleWriter(exp.Name))
 	}
-	defer res.Body.Close()
-	body, err := io.ReadAll(res.Body)
+	series, err := createSeries(outPath(outName(exp.Name+".ts")), res.Start)
 	if err != nil {
-		fmt.Println(err)
-		return nil, err
+		return res, fmt.Errorf("create series: %w", err)
 	}
+	defer series.Close()
 
-	var batch Batch
-	err = json.Unmarshal(body, &batch)
-	if err != nil {
-		return nil, err
-	}
-	return &batch, nil
-}
+	conns := &ConnStats{}
+	c = c.isolated(exp, conns)
+	defer c.close()
+	codes := &statusCounter{}
+	c = c.counting(codes)
+	res.StampsStart = snapshotStamps(f, c)
+	defer func() {
+		res.End = clock.Now()
+		res.StampsEnd = snapshotStamps(f, c)
+		logSnapshotChanges(f, exp.BatchID, res.StampsStart, res.StampsEnd)
+		res.StatusCodes = codes.counts()
+		if err != nil {
+			res.StopReason = stopError
+			res.Error = err.Error()
+			res.err = err
+		}
+		log(f, "summary stopReason=", res.StopReason, " uploads=", res.Uploads, " failures=", res.Failures, " errorRate=", strconv.FormatFloat(res.errorRate(), 'f', 4, 64),
+			" duplicates=", res.Duplicates, " duplicateRate=", strconv.FormatFloat(res.duplicateRate(), 'f', 4, 64))
+		log(f, "statusCodes ", formatStatusCodes(res.StatusCodes))
+		if conns.Opened+conns.Reused > 0 {
+			res.Connections = conns
+			log(f, "connections experiment=", conns.Experiment, " node=", conns.Node, " opened=", conns.Opened, " reused=", conns.Reused)
+		}
+		if exp.MixEncrypt != "" {
+			log(f, "mixEncrypt mode=", exp.MixEncrypt, " encrypted=", res.EncryptedUploads, " plain=", res.Uploads-res.EncryptedUploads)
+		}
+		if res.Timing != nil {
+			logTiming(f, "timing mean", *res.Timing)
+		}
+		board.update(res)
+		if exp.Hooks != nil {
+			s := summaryOf(res)
+			exp.Hooks.notify(f, exp.Hooks.Done, hookEvent{Event: "done", Experiment: exp.Name, BatchID: exp.BatchID, Summary: &s})
+		}
+		werr := writeResult(outPath(outName(exp.Name+".json")), res)
+		if werr != nil {
+			log(f, "write result: ", werr)
+		}
+		if global.resultsDB != "" {
+			werr = appendRecord(global.resultsDB, recordOf(res))
+			if werr != nil {
+				log(f, "results db: ", werr)
+			}
+		}
+	}()
 
-func uploadData(size int, batchID string, encrypt bool, deferred bool) error {
-	b, err := generateFile(size)
-	payload := bytes.NewReader(b)
-	client := &http.Client{}
-	req, err := http.NewRequest(http.MethodPost, baseURL+"/bytes", payload)
+	uploader, err := newUploader(c, exp)
 	if err != nil {
-		return err
+		return res, err
 	}
-	req.Header.Add("Swarm-Postage-Batch-Id", batchID)
-	req.Header.Add("Content-Type", "application/octet-stream")
-	req.Header.Add("Swarm-Deferred-Upload", strconv.FormatBool(deferred))
-	req.Header.Add("Swarm-Encrypt", strconv.FormatBool(encrypt))
 
-	res, err := client.Do(req)
+	batch := &Batch{
+		BatchID: exp.BatchID,
+		Usable:  false,
+	}
+	log(f, "batchID=", batch.BatchID, " encrypt=", exp.Encrypt, " deferred=", exp.Deferred, " redundancyLevel=", exp.RedundancyLevel, " workload=", exp.Workload, " size=", prettyByteSize(exp.Size), " random=", exp.Random, " align=", exp.Align)
+	if exp.Act != nil {
+		log(f, "act publisher=", exp.Act.Publisher, " grantees=", len(exp.Act.Grantees))
+	}
+	node, err := c.nodeInfo()
 	if err != nil {
-		return err
+		log(f, "node info incomplete: ", err)
 	}
-	defer res.Body.Close()
-
-	body, err := io.ReadAll(res.Body)
+	res.Node = node
+	log(f, "node version=", node.Version, " apiVersion=", node.APIVersion, " chainID=", node.ChainID, " beeMode=", node.BeeMode, " overlay=", node.Overlay)
+	batch, stopped, err := waitUsable(f, c, stop, batch.BatchID)
 	if err != nil {
-		return err
+		return res, err
 	}
+	if stopped {
+		res.StopReason = stopStopped
+		return res, nil
+	}
+	res.Batch = batch
+	log(f, "batch depth=", batch.Depth, " bucketDepth=", batch.BucketDepth, " amount=", batch.Amount, " immutable=", batch.Immutable, " ttl=", time.Duration(batch.TTL)*time.Second)
 
-	type uploadResponse struct {
-		Reference string `json:"reference"`
+	totalUploaded := 0
+	totalChunks := 0
+	var totalSplit, totalSeen int64
+	switch {
+	case len(exp.Mix) > 0:
+		log(f, "mix=", formatMix(exp.Mix), " concurrency=", exp.Concurrency)
+	case len(exp.Sweep) > 0:
+		log(f, "sweep=", formatSweep(exp.Sweep), " concurrency=", exp.Concurrency)
+	default:
+		log(f, "chunksPerUpload=", uploader.Chunks(exp.Size), " concurrency=", exp.Concurrency)
 	}
-	var upload uploadResponse
-	err = json.Unmarshal(body, &upload)
-	if err != nil {
-		return err
+	if exp.InFlight > 0 {
+		log(f, "pipelined inFlight=", exp.InFlight, " workers=", exp.Concurrency)
 	}
-	return nil
-}
-
-func run(name string, batchID string, stop <-chan error, encrypt, deferred bool) error {
-	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
-	if err != nil {
-		return fmt.Errorf("error opening file: %v", err)
+	poller := newStampPoller(c, exp.Poll, exp.Retry.stamp(), batch)
+	uploads := startPipeline(f, c, uploader, exp)
+	// soak runs replace both with every new batch
+	defer func() {
+		uploads.stop()
+		poller.stop()
+		res.InFlight = uploads.inFlightReport()
+		if res.InFlight != nil {
+			logInFlight(f, res.InFlight)
+		}
+	}()
+	gen := Generation{BatchID: batch.BatchID, Start: clock.Now()}
+	var throttle *throttle
+	if exp.Backpressure != nil {
+		throttle = newThrottle(exp.Backpressure, exp.uploadSlots())
 	}
-	defer f.Close()
-
-	const dataSize = 5 * 1024 * 1024
-
-	batch := &Batch{
-		BatchID: batchID,
-		Usable:  false,
+	var sizer *sizer
+	if exp.AdaptiveSize != nil {
+		sizer = newSizer(exp.AdaptiveSize, exp)
+		uploads.setSize(sizer.size)
+		log(f, "adaptive size target=", time.Duration(exp.AdaptiveSize.Latency), " size=", prettyByteSize(sizer.size))
+		defer func() {
+			res.AdaptedSize = sizer.size
+		}()
 	}
-	log(f, "batchID=", batch.BatchID)
-	for !batch.Usable {
-		log(f, "waiting for stamp to be usable")
-		batch, err = getStamp(batch.BatchID)
-		if err != nil {
-			return fmt.Errorf("get stamp: %w", err)
+	var breaker *breaker
+	if exp.Breaker != nil {
+		breaker = newBreaker(exp.Breaker)
+	}
+	var ramp *ramp
+	var rampTick <-chan time.Time
+	if exp.Ramp != nil {
+		ramp = newRamp(exp.Ramp, exp.uploadSlots())
+		uploads.throttle(ramp.limit(), 0)
+		log(f, "ramp concurrency=", ramp.limit())
+		t := clock.NewTicker(time.Duration(exp.Ramp.Every))
+		defer t.Stop()
+		rampTick = t.C
+		defer func() {
+			res.Ramp = ramp.finish(f)
+		}()
+	}
+	var heartbeat <-chan time.Time
+	if hb := systemd.heartbeat(exp.Heartbeat); hb > 0 {
+		t := clock.NewTicker(hb)
+		defer t.Stop()
+		heartbeat = t.C
+	}
+	lastResult := clock.Now()
+	var restarted time.Time
+	var stallTick <-chan time.Time
+	if exp.Stall != nil {
+		t := clock.NewTicker(time.Duration(exp.Stall.Window) / 4)
+		defer t.Stop()
+		stallTick = t.C
+	}
+	var heatmap *heatmap
+	var heatmapTick <-chan time.Time
+	if exp.Heatmap > 0 {
+		heatmap = newHeatmap(outPath(exp.Name+"-heatmap.html"), exp.Name)
+		heatmap.record(f, c, batch.BatchID)
+		t := clock.NewTicker(time.Duration(exp.Heatmap))
+		defer t.Stop()
+		heatmapTick = t.C
+		defer func() {
+			heatmap.record(f, c, batch.BatchID)
+		}()
+	}
+	var selfLogged time.Time
+	var timings Timing
+	alerter := newAlerter(exp.Alerts)
+	chain := newChainTracker(c)
+	steps := newStepTracker(batch)
+	var overflow *overflowCapture
+	var diluter *diluter
+	if exp.Dilute != nil {
+		diluter = newDiluter(*exp.Dilute)
+	}
+	var overwrite *overwriteCapture
+	if exp.Overwrite != nil {
+		overwrite = newOverwriteCapture(*exp.Overwrite)
+	}
+	var sweep *sweep
+	if len(exp.Sweep) > 0 {
+		sweep = newSweep(exp.Sweep)
+		defer func() {
+			res.Sweep = sweep.finish(f)
+		}()
+	}
+	var reader *retrievalChecker
+	if exp.Reader != nil {
+		reader = newRetrievalChecker(f, *exp.Reader)
+		defer func() {
+			res.Retrieval = reader.finish()
+		}()
+	}
+	if exp.Cancel != nil {
+		res.Canceled = &CancelReport{}
+		defer logCancel(f, res.Canceled)
+	}
+	var presence *presenceSampler
+	if exp.Presence != nil {
+		presence = newPresenceSampler(*exp.Presence)
+		res.Presence = &presence.report
+	}
+	var docker *dockerSampler
+	if exp.Docker != nil {
+		if exp.Docker.Container == "" {
+			return res, fmt.Errorf("docker stats: no container")
 		}
-		time.Sleep(5 * time.Second)
+		docker = newDockerSampler(f, *exp.Docker)
+		defer docker.stop()
+	}
+	var lastContainer *ContainerStats
+	var eviction *evictionStudy
+	if exp.Eviction != nil {
+		eviction = newEvictionStudy(*exp.Eviction)
+		res.Eviction = &eviction.report
 	}
+	reload, unsubscribe := reloads.subscribe(exp)
+	defer unsubscribe()
+	refs := referenceSet{}
+	var firstRef string
+	var repeatFirst int
+	keepGoing := exp.OnError == onErrorContinue || breaker != nil
+	// settle ends the run or rotates the soak batch once the batch is full
+	// or expired, and reports whether run returns. rejected is the upload
+	// a full batch turned down, the first overflow attempt.
+	settle := func(rejected *uploadResult) (bool, error) {
+		var reason string
+		switch {
+		case batch.Expired:
+			log(f, "batch expired")
+			reason = stopExpired
+		case batch.full():
+			if overwrite != nil && !batch.Immutable {
+				if overwrite.more(f, totalUploaded) {
+					return false, nil
+				}
+				res.Overwritten = overwrite.check(f, c)
+			}
+			log(f, "batch full")
+			logCost(f, c, batch, gen.Bytes)
+			if exp.Overflow > 0 && batch.Immutable && overflow == nil {
+				log(f, "capturing overflow attempts=", exp.Overflow)
+				overflow = newOverflowCapture(batch.BatchID, exp.Overflow, totalUploaded)
+				res.Overflow = &overflow.report
+				if rejected != nil && overflow.observe(f, c, *rejected) {
+					logOverflow(f, exp.Name, res.Overflow)
+					res.StopReason = stopFull
+					return true, nil
+				}
+				return false, nil
+			}
+			reason = stopFull
+		default:
+			return false, nil
+		}
+		if !exp.Soak {
+			res.StopReason = reason
+			return true, nil
+		}
 
-	totalUploaded := 0
+		gen.End, gen.StopReason = clock.Now(), reason
+		res.Generations = append(res.Generations, gen)
+		log(f, "soak generation=", len(res.Generations), " batchID=", gen.BatchID, " bytes=", prettyByteSize(gen.Bytes), " chunks=", gen.Chunks, " stopReason=", reason, " totalUploaded=", prettyByteSize(totalUploaded))
+		uploads.stop()
+		poller.stop()
+		next, stopped, err := rotateBatch(f, c, stop, exp)
+		if err != nil {
+			return true, err
+		}
+		if stopped {
+			res.StopReason = stopStopped
+			return true, nil
+		}
+		batch = next
+		exp.BatchID = batch.BatchID
+		uploader, err = newUploader(c, exp)
+		if err != nil {
+			return true, err
+		}
+		poller = newStampPoller(c, exp.Poll, exp.Retry.stamp(), batch)
+		uploads = startPipeline(f, c, uploader, exp)
+		switch {
+		case ramp != nil:
+			uploads.throttle(ramp.limit(), 0)
+		case throttle != nil:
+			uploads.throttle(throttle.limit, throttle.pause)
+		}
+		if sizer != nil {
+			uploads.setSize(sizer.size)
+		}
+		gen = Generation{BatchID: batch.BatchID, Start: clock.Now()}
+		alerter.reset()
+		steps.reset(batch)
+		return false, nil
+	}
 	for {
 		select {
 		case v := <-stop:
 			log(f, "stopping", v)
-			return nil
-		default:
-			err = uploadData(dataSize, batch.BatchID, encrypt, deferred)
-			if err != nil {
-				return fmt.Errorf("upload data: %w", err)
+			res.StopReason = stopStopped
+			return res, nil
+		case <-heartbeat:
+			log(f, "heartbeat uploads=", res.Uploads, " failures=", res.Failures, " inFlight=", uploads.inFlight(), " queue=", uploads.depth(), " sinceLastUpload=", since(lastResult).Round(time.Second))
+			systemd.alive()
+		case <-stallTick:
+			since := since(lastResult)
+			if since < time.Duration(exp.Stall.Window) || uploads.inFlight() == 0 {
+				break
+			}
+			logStall(f, uploads, res, since)
+			uploads.cancelInFlight()
+			if exp.Stall.OnStall != stallRetry {
+				return res, fmt.Errorf("stalled: no upload finished in %s", since.Round(time.Second))
+			}
+			lastResult = clock.Now()
+		case <-heatmapTick:
+			heatmap.record(f, c, batch.BatchID)
+		case next := <-reload:
+			exp = applyReload(f, exp, next, reloadTarget{uploads: uploads, poller: poller, adaptive: throttle != nil || ramp != nil})
+			res.Experiment = exp
+			reloads.applied(exp)
+		case <-rampTick:
+			limit, ok := ramp.next(f)
+			if !ok {
+				rampTick = nil
+				break
+			}
+			uploads.throttle(limit, 0)
+		case r, ok := <-uploads.results:
+			if !ok {
+				switch {
+				case exp.Trace != nil:
+					log(f, "trace replayed")
+				case exp.Source != nil:
+					log(f, "source done")
+				default:
+					return res, fmt.Errorf("payload generation stopped")
+				}
+				res.StopReason = stopDone
+				return res, nil
+			}
+			lastResult = clock.Now()
+			if r.canceled != nil {
+				if r.err != nil {
+					if !keepGoingAfter(keepGoing, r.err) {
+						return res, r.err
+					}
+					log(f, "skipping canceled upload: ", r.err)
+					continue
+				}
+				res.Canceled.add(f, *r.canceled)
+				continue
+			}
+			if overflow != nil {
+				r.span.export()
+				if r.err == nil {
+					res.Uploads++
+				} else if r.failed {
+					res.Failures++
+				}
+				if overflow.observe(f, c, r) {
+					logOverflow(f, exp.Name, res.Overflow)
+					res.StopReason = stopFull
+					return res, nil
+				}
+				continue
+			}
+			if ramp != nil {
+				ramp.observe(r.latency, r.err != nil)
+			}
+			if r.err != nil {
+				if r.failed {
+					res.Failures++
+				}
+				if exp.TolerateRestarts && r.started.Before(restarted) && isConnError(r.err) {
+					// sent before the node came back
+					continue
+				}
+				if exp.TolerateRestarts && nodeDown(c, r.err) {
+					uploads.hold()
+					after, stopped, err := waitRestart(f, c, stop, batch)
+					if err != nil {
+						return res, fmt.Errorf("after restart: %w", err)
+					}
+					if stopped {
+						res.StopReason = stopStopped
+						return res, nil
+					}
+					poller.set(after)
+					restarted, lastResult = clock.Now(), clock.Now()
+					uploads.resume()
+					continue
+				}
+				if after, full := rejectedFull(c, batch, r.err); full {
+					log(f, "upload rejected by the full batch: ", r.err)
+					batch = after
+					poller.set(batch)
+					if done, err := settle(&r); done {
+						return res, err
+					}
+					continue
+				}
+				if !keepGoingAfter(keepGoing, r.err) {
+					return res, r.err
+				}
+				log(f, "skipping failed upload: ", r.err, " failures=", res.Failures)
+				if breaker != nil && breaker.failure() {
+					uploads.hold()
+					stopped, err := breaker.wait(f, c, stop)
+					if err != nil {
+						return res, err
+					}
+					if stopped {
+						res.StopReason = stopStopped
+						return res, nil
+					}
+					uploads.resume()
+					lastResult = clock.Now()
+				}
+				continue
+			}
+			if breaker != nil {
+				breaker.success()
+			}
+			res.Uploads++
+			if throttle != nil && throttle.observe(r.started, r.latency) {
+				uploads.throttle(throttle.limit, throttle.pause)
+				log(f, "backpressure latency=", r.latency.Round(time.Millisecond), " concurrency=", throttle.limit, " pause=", throttle.pause)
+			}
+			if sizer != nil && sizer.observe(r.started, r.size, r.latency) {
+				uploads.setSize(sizer.size)
+				log(f, "adaptive size latency=", r.latency.Round(time.Millisecond), " size=", prettyByteSize(sizer.size))
+			}
+			switch {
+			case exp.Repeat > 0:
+				// the same payload has to give the same reference, unless
+				// encryption picks a new key each time
+				if firstRef == "" {
+					firstRef = r.upload.Reference
+					first, err := c.getStamp(exp.BatchID)
+					if err != nil {
+						return res, fmt.Errorf("get stamp: %w", err)
+					}
+					repeatFirst = first.Utilization
+				} else if !exp.Encrypt && exp.MixEncrypt == "" && r.upload.Reference != firstRef {
+					log(f, "repeat reference changed first=", firstRef, " reference=", r.upload.Reference)
+				}
+			case refs.add(r.upload.Reference):
+				res.Duplicates++
+				log(f, "duplicate reference=", r.upload.Reference, " duplicates=", res.Duplicates)
+			}
+			tag := r.tag
+			totalSplit += tag.Split
+			totalSeen += tag.Seen
+			log(f, "reference=", r.upload.Reference, " tag=", tag.UID, " split=", tag.Split, " stored=", tag.Stored, " seen=", tag.Seen, " seenRatio=", ratio(totalSeen, totalSplit), encryptedField(exp, r.encrypted), requestIDField(r.upload.RequestID))
+			if r.encrypted {
+				res.EncryptedUploads++
 			}
 
-			batch, err = getStamp(batch.BatchID)
+			batch, err = poller.uploaded()
+			r.span.set("swarm.batch.utilization", batch.Utilization)
+			r.span.export()
 			if err != nil {
-				return fmt.Errorf("get stamp: %w", err)
+				if !keepGoingAfter(keepGoing, err) && !(exp.TolerateRestarts && isConnError(err)) {
+					return res, fmt.Errorf("get stamp: %w", err)
+				}
+				log(f, "get stamp: ", err, ", using the last batch state")
+			}
+			if sweep != nil {
+				sweep.observe(r.size, tag.Split, r.grew)
+			}
+			chunks := uploader.Chunks(r.size)
+			if r.encrypted {
+				chunks = uploads.encrypted.Chunks(r.size)
+			}
+			totalUploaded += r.size
+			totalChunks += chunks
+			gen.Bytes += r.size
+			gen.Chunks += chunks
+			if step, ok := steps.observe(f, batch.Utilization, gen.Bytes, gen.Chunks, len(res.Generations)); ok {
+				res.Steps = append(res.Steps, step)
+			}
+			sample := Sample{Time: clock.Now(), Bytes: totalUploaded, Chunks: totalChunks, Utilization: batch.Utilization, Latency: r.latency, Queue: uploads.depth(), Generation: len(res.Generations)}
+			if batch.Depth > 0 {
+				sample.Capacity = batch.capacity()
 			}
-			totalUploaded += dataSize
-			log(f, "totalUploaded=", prettyByteSize(totalUploaded), " utilization=", batch.Utilization)
-			if batch.Expired {
-				log(f, "batch expired")
-				return nil
+			sample.Timing = &r.timing
+			sample.Block = chain.block(f)
+			timings.add(r.timing)
+			mean := timings.div(res.Uploads)
+			res.Timing = &mean
+			sample.Self = readSelfMetrics()
+			if since(selfLogged) >= selfLogInterval {
+				selfLogged = clock.Now()
+				log(f, "self goroutines=", sample.Self.Goroutines, " heapInuse=", prettyByteSize(int(sample.Self.HeapInuse)), " numGC=", sample.Self.NumGC, " gcPause=", sample.Self.GCPause, " lastGCPause=", sample.Self.LastGCPause)
 			}
-			if batch.Utilization == 16 {
-				log(f, "batch full")
-				return nil
+			if len(exp.NodeMetrics) > 0 {
+				sample.Metrics, err = c.scrapeMetrics(exp.NodeMetrics)
+				if err != nil {
+					log(f, "scrape metrics: ", err)
+				}
+				log(f, "metrics ", formatMetrics(exp.NodeMetrics, sample.Metrics))
+			}
+			if exp.DiskUsage != "" {
+				sample.DiskBytes, err = c.diskUsage(exp.DiskUsage)
+				if err != nil {
+					log(f, "disk usage: ", err)
+				} else {
+					log(f, "diskUsage=", prettyByteSize(int(sample.DiskBytes)), " diskPerUploaded=", ratio(sample.DiskBytes, int64(totalUploaded)))
+				}
+			}
+			if docker != nil {
+				sample.Container = docker.stats()
+				if st := sample.Container; st != nil && st != lastContainer {
+					lastContainer = st
+					log(f, "container cpu=", strconv.FormatFloat(st.CPUPercent, 'f', 1, 64), "% memory=", prettyByteSize(int(st.MemoryBytes)), " blockRead=", prettyByteSize(int(st.BlockRead)),
+						" blockWrite=", prettyByteSize(int(st.BlockWrite)), " netRx=", prettyByteSize(int(st.NetRx)), " netTx=", prettyByteSize(int(st.NetTx)))
+				}
+			}
+			res.Samples = downsample(append(res.Samples, sample))
+			err = series.write(sample)
+			if err != nil {
+				log(f, "write series: ", err)
+			}
+			board.update(res)
+			log(f, "totalUploaded=", prettyByteSize(totalUploaded), " totalChunks=", totalChunks, " utilization=", batch.Utilization, " queue=", sample.Queue, " block=", sample.Block)
+			logTiming(f, "timing", r.timing)
+			if s, ok := uploader.(*localStampUploader); ok && s.utilization() != batch.Utilization {
+				log(f, "utilization mismatch node=", batch.Utilization, " stamper=", s.utilization())
+			}
+			crossed := alerter.observe(f, batch, totalUploaded)
+			for i := range crossed {
+				if exp.Hooks != nil {
+					exp.Hooks.notify(f, exp.Hooks.Milestone, hookEvent{Event: "milestone", Experiment: exp.Name, BatchID: batch.BatchID, Alert: &crossed[i]})
+				}
+			}
+			res.Alerts = append(res.Alerts, crossed...)
+			if diluter != nil && diluter.due(batch) {
+				uploads.hold()
+				after, dl, err := diluter.dilute(f, c, batch, totalUploaded)
+				if err != nil {
+					return res, err
+				}
+				res.Dilutions = append(res.Dilutions, *dl)
+				batch = after
+				poller.set(batch)
+				alerter.reset()
+				uploads.resume()
+			}
+			if overwrite != nil {
+				overwrite.record(r.upload.Reference, totalUploaded)
+			}
+			if reader != nil {
+				reader.uploaded(r.upload.Reference)
+			}
+			if presence != nil {
+				presence.uploaded(f, c, r.upload.Reference)
+			}
+			if eviction != nil && eviction.uploaded(f, c, r.upload.Reference, totalUploaded, batch) {
+				log(f, "eviction phase done")
+				res.StopReason = stopDone
+				return res, nil
+			}
+			if bytesLeft, timeLeft, ok := predictFull(generationSamples(res.Samples, sample.Generation), batch.capacity()); ok {
+				log(f, "eta bytesLeft=", prettyByteSize(bytesLeft), " timeLeft=", timeLeft.Round(time.Second))
+			}
+			if exp.MaxBytes > 0 && totalUploaded >= exp.MaxBytes {
+				log(f, "byte limit reached")
+				res.StopReason = stopMaxBytes
+				return res, nil
+			}
+			if exp.StopAt > 0 && exp.StopAt.reached(batch) {
+				log(f, "stop-at reached target=", exp.StopAt, " utilization=", batch.Utilization, " capacity=", batch.capacity())
+				res.StopReason = stopTarget
+				return res, nil
+			}
+			if exp.Repeat > 0 && res.Uploads >= exp.Repeat {
+				return res, logRepeat(f, c, res, repeatFirst)
+			}
+			if done, err := settle(nil); done {
+				return res, err
 			}
 		}
 	}
 }
 
-func main() {
-	var wg sync.WaitGroup
-	wg.Add(2)
+// logRepeat ends a repeat run, comparing the utilization after the first
+// upload with the one after the last.
+func logRepeat(f io.Writer, c *Client, res *Result, first int) error {
+	batch, err := c.getStamp(res.Experiment.BatchID)
+	if err != nil {
+		return fmt.Errorf("get stamp: %w", err)
+	}
+	log(f, "repeat uploads=", res.Uploads, " utilizationFirst=", first, " utilizationLast=", batch.Utilization, " grew=", batch.Utilization > first)
+	if batch.Immutable && batch.Utilization > first {
+		log(f, "repeat used the immutable batch again")
+	}
+	res.StopReason = stopDone
+	return nil
+}
 
-	// stop both goroutines if one of them returns an error
-	stop := make(chan error, 2)
-	go func() {
-		defer wg.Done()
-		err := run("encrypted.log", "33061094e7281dbc29baf3b825d219d39c6999c8a11572863656225ad9bd287e", stop, true, false)
+// prepareNode detects the node version and checks it supports the
+// experiments.
+func prepareNode(c *Client, exps []Experiment) error {
+	health, err := c.detectVersion()
+	if err != nil {
+		return withExitCode(exitUnreachable, fmt.Errorf("node: %w", err))
+	}
+	fmt.Fprintln(console(), c.apiURL, "bee version", health.Version, "api version", health.APIVersion)
+	var p problems
+	for i, exp := range exps {
+		err = c.checkExperiment(exp)
 		if err != nil {
-			stop <- fmt.Errorf("encrypted: %w", err)
-			fmt.Println("encrypted err", err)
+			p.add(fmt.Sprintf("experiments[%d]", i), "%s: %v", exp.Name, err)
 		}
-	}()
+	}
+	return withExitCode(exitConfig, p.err(c.apiURL))
+}
 
-	go func() {
-		defer wg.Done()
-		err := run("non-encrypted.log", "b7f8691f430db68104e5c92b8aaf2041bd99749fc1aeba44db77ab0a014b614b", stop, false, false)
-		if err != nil {
-			stop <- fmt.Errorf("non-encrypted: %w", err)
-			fmt.Println("non-encrypted err", err)
+// checkBatches checks that the node knows the batches of the experiments and
+// that they haven't expired, before any upload starts.
+func checkBatches(c *Client, exps []Experiment) error {
+	var p problems
+	for i, exp := range exps {
+		field := fmt.Sprintf("experiments[%d].batchID", i)
+		batch, err := c.getStamp(exp.BatchID)
+		switch {
+		case err != nil:
+			p.add(field, "%s: %v", exp.Name, err)
+		case batch.Expired:
+			p.add(field, "%s: batch %s expired", exp.Name, exp.BatchID)
 		}
-	}()
+	}
+	return withExitCode(exitConfig, p.err(c.apiURL))
+}
+
+// runExperiments runs the experiments concurrently against one node and
+// returns their results in order.
+func runExperiments(c *Client, exps []Experiment) []*Result {
+	return runExperimentsUntil(c, exps, nil)
+}
+
+// runExperimentsUntil is runExperiments stopping the experiments once quit
+// is closed.
+func runExperimentsUntil(c *Client, exps []Experiment, quit <-chan struct{}) []*Result {
+	var wg sync.WaitGroup
+	wg.Add(len(exps))
+
+	// stop all goroutines if one of them returns an error
+	stop := make(chan error, len(exps))
+	results := make([]*Result, len(exps))
+	// closed when the experiment finished, for its dependents
+	done := map[string]chan struct{}{}
+	index := map[string]int{}
+	for i, exp := range exps {
+		done[exp.Name] = make(chan struct{})
+		index[exp.Name] = i
+	}
+	if quit != nil {
+		finished := make(chan struct{})
+		defer close(finished)
+		go func() {
+			select {
+			case <-quit:
+				for range exps {
+					select {
+					case stop <- fmt.Errorf("node left"):
+					default:
+					}
+				}
+			case <-finished:
+			}
+		}()
+	}
+	for i, exp := range exps {
+		i, exp := i, exp
+		go func() {
+			defer wg.Done()
+			defer close(done[exp.Name])
+			for _, d := range exp.DependsOn {
+				select {
+				case <-done[d.Experiment]:
+				case err := <-stop:
+					// pass it on to the others
+					stop <- err
+					results[i] = notRun(exp, stopStopped, "")
+					return
+				}
+				if why := d.unmet(results[index[d.Experiment]]); why != "" {
+					results[i] = notRun(exp, stopSkipped, "dependency "+why)
+					return
+				}
+			}
+			var err error
+			results[i], err = run(exp, c, stop)
+			if err != nil {
+				err = fmt.Errorf("%s: %w", exp.Name, err)
+				for range exps {
+					select {
+					case stop <- err:
+					default:
+					}
+				}
+			}
+		}()
+	}
 
 	wg.Wait()
+	return results
+}
+
+func writeComparison(cfg Config, results []*Result) error {
+	baseline := cfg.experiment(cfg.Baseline)
+	if baseline < 0 || len(cfg.Experiments) < 2 {
+		return nil
+	}
+
+	f, err := os.OpenFile(outPath("comparison.log"), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return fmt.Errorf("error opening file: %v", err)
+	}
+	defer f.Close()
+	for i, exp := range cfg.Experiments {
+		if i == baseline {
+			continue
+		}
+		compare(f, exp.Name, results[i].Samples, cfg.Baseline, results[baseline].Samples)
+	}
+	logEncryptionOverhead(f, results)
+	return nil
 }
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+)
+
+const (
+	defaultContentType = "application/octet-stream"
+	defaultFilename    = "payload.bin"
+)
+
+// Metadata is the manifest metadata of /bzz uploads, so its overhead can be
+// compared across content types and names. Every upload takes the next
+// entry of each list.
+type Metadata struct {
+	// ContentTypes and Filenames are set on the uploads of the file
+	// workload.
+	ContentTypes []string `json:"contentTypes"`
+	Filenames    []string `json:"filenames"`
+	// IndexDocuments are the Swarm-Index-Document of the website workload,
+	// index.html by default.
+	IndexDocuments []string `json:"indexDocuments"`
+}
+
+// rotate returns the entry of list for upload n, or def for an empty list.
+func rotate(list []string, n uint32, def string) string {
+	if len(list) == 0 {
+		return def
+	}
+	return list[int(n)%len(list)]
+}
+
+// fileUploader uploads the payload as a single file through /bzz, which
+// wraps it in a manifest holding its name and content type.
+type fileUploader struct {
+	client *Client
+	exp    Experiment
+	// uploads counts the uploads for the metadata rotation
+	uploads uint32
+}
+
+func (u *fileUploader) Payload(size int) ([]byte, error) {
+	return generateFile(size, u.exp.Random)
+}
+
+func (u *fileUploader) Upload(ctx context.Context, payload []byte, tag uint64, history string) (*uploadResponse, error) {
+	n := atomic.AddUint32(&u.uploads, 1) - 1
+	var m Metadata
+	if u.exp.Metadata != nil {
+		m = *u.exp.Metadata
+	}
+	name := rotate(m.Filenames, n, defaultFilename)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.client.apiURL+"/bzz?name="+url.QueryEscape(name), uploadBody(ctx, payload))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(payload))
+	req.Header.Add("Content-Type", rotate(m.ContentTypes, n, defaultContentType))
+	return u.client.upload(req, u.exp, tag, history)
+}
+
+// Chunks only counts the file content, the manifest chunks come on top.
+func (u *fileUploader) Chunks(size int) int {
+	return estimateChunks(size, u.exp.Encrypt)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// MixEntry is one payload size of a mixed workload, uploaded with a
+// probability proportional to its weight.
+type MixEntry struct {
+	Size   int     `json:"size"`
+	Weight float64 `json:"weight"`
+}
+
+func validateMix(mix []MixEntry, workload string) error {
+	for _, m := range mix {
+		if m.Size <= 0 || m.Weight <= 0 {
+			return fmt.Errorf("mix entries need a positive size and weight")
+		}
+		if workload == workloadPss && m.Size > pssMaxPayload {
+			return fmt.Errorf("mix size %d exceeds the pss payload limit", m.Size)
+		}
+	}
+	return nil
+}
+
+// pickSize draws the size of the next payload from the mix.
+func pickSize(mix []MixEntry, r *rand.Rand) int {
+	total := 0.0
+	for _, m := range mix {
+		total += m.Weight
+	}
+	x := r.Float64() * total
+	for _, m := range mix {
+		x -= m.Weight
+		if x < 0 {
+			return m.Size
+		}
+	}
+	return mix[len(mix)-1].Size
+}
+
+func formatMix(mix []MixEntry) string {
+	total := 0.0
+	for _, m := range mix {
+		total += m.Weight
+	}
+	s := ""
+	for i, m := range mix {
+		if i > 0 {
+			s += ","
+		}
+		s += fmt.Sprintf("%.0f%%:%s", 100*m.Weight/total, prettyByteSize(m.Size))
+	}
+	return s
+}
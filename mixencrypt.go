@@ -0,0 +1,40 @@
+package main
+
+import "math/rand"
+
+const (
+	// mixEncryptAlternate flips the encryption with every upload,
+	// starting plain, mixEncryptRandom picks it per upload.
+	mixEncryptAlternate = "alternate"
+	mixEncryptRandom    = "random"
+)
+
+// encryptPicker decides which uploads of a MixEncrypt run are encrypted.
+type encryptPicker struct {
+	mode string
+	n    int
+	rnd  *rand.Rand
+}
+
+func (p *encryptPicker) next() bool {
+	p.n++
+	switch p.mode {
+	case mixEncryptAlternate:
+		return p.n%2 == 0
+	case mixEncryptRandom:
+		return p.rnd.Intn(2) == 1
+	}
+	return false
+}
+
+// encryptedField is the log field telling whether an upload of a MixEncrypt
+// run was encrypted, empty for other runs.
+func encryptedField(exp Experiment, encrypted bool) string {
+	if exp.MixEncrypt == "" {
+		return ""
+	}
+	if encrypted {
+		return " encrypted=true"
+	}
+	return " encrypted=false"
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// NodeInfo identifies the node a run was made against.
+type NodeInfo struct {
+	Version    string `json:"version"`
+	APIVersion string `json:"apiVersion"`
+	// ChainID identifies the network in place of the network id, which
+	// the API does not expose: 100 is mainnet on Gnosis Chain, 11155111 the
+	// Sepolia testnet.
+	ChainID int64  `json:"chainID"`
+	BeeMode string `json:"beeMode"`
+	Overlay string `json:"overlay"`
+}
+
+func (c *Client) getJSON(url string, v any) error {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	res, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d: %s", res.StatusCode, body)
+	}
+	return json.Unmarshal(body, v)
+}
+
+// nodeInfo collects what it can about the node; endpoints missing on older
+// nodes leave their fields empty, the error only reports the first failure.
+func (c *Client) nodeInfo() (*NodeInfo, error) {
+	info := &NodeInfo{}
+	var first error
+	keep := func(err error) {
+		if first == nil {
+			first = err
+		}
+	}
+
+	health, err := c.getHealth(c.apiURL)
+	if err != nil {
+		health, err = c.getHealth(c.debugURL)
+	}
+	if err == nil {
+		info.Version, info.APIVersion = health.Version, health.APIVersion
+	} else {
+		keep(fmt.Errorf("health: %w", err))
+	}
+
+	var wallet struct {
+		ChainID int64 `json:"chainID"`
+	}
+	if err := c.getJSON(c.debugURL+"/wallet", &wallet); err == nil {
+		info.ChainID = wallet.ChainID
+	} else {
+		keep(fmt.Errorf("wallet: %w", err))
+	}
+
+	var node struct {
+		BeeMode string `json:"beeMode"`
+	}
+	if err := c.getJSON(c.debugURL+"/node", &node); err == nil {
+		info.BeeMode = node.BeeMode
+	} else {
+		keep(fmt.Errorf("node: %w", err))
+	}
+
+	var addresses struct {
+		Overlay string `json:"overlay"`
+	}
+	if err := c.getJSON(c.debugURL+"/addresses", &addresses); err == nil {
+		info.Overlay = addresses.Overlay
+	} else {
+		keep(fmt.Errorf("addresses: %w", err))
+	}
+	return info, first
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	otlpBatch    = 512
+	otlpMaxQueue = 8 * otlpBatch
+	otlpInterval = 5 * time.Second
+)
+
+// exporter sends spans of the uploads and stamp polls to an OpenTelemetry
+// collector, as OTLP/HTTP JSON. It is configured like the OpenTelemetry
+// SDKs, with OTEL_EXPORTER_OTLP_ENDPOINT or
+// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT, OTEL_EXPORTER_OTLP_HEADERS and
+// OTEL_SERVICE_NAME. All methods are no-ops when no endpoint is set.
+type exporter struct {
+	url     string
+	headers map[string]string
+	service string
+	http    *http.Client
+
+	mu      sync.Mutex
+	queue   []*span
+	dropped int
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+var tracer = newExporter()
+
+func newExporter() *exporter {
+	e := &exporter{
+		url:     os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"),
+		headers: map[string]string{},
+		service: os.Getenv("OTEL_SERVICE_NAME"),
+		http:    &http.Client{Timeout: 10 * time.Second},
+	}
+	if base := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); e.url == "" && base != "" {
+		e.url = strings.TrimSuffix(base, "/") + "/v1/traces"
+	}
+	if e.service == "" {
+		e.service = "batch-utilization-exp"
+	}
+	for _, kv := range strings.Split(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), ",") {
+		k, v, ok := strings.Cut(kv, "=")
+		if ok {
+			e.headers[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+	}
+	return e
+}
+
+func (e *exporter) enabled() bool {
+	return e.url != ""
+}
+
+// start begins exporting, until shutdown.
+func (e *exporter) start() {
+	if !e.enabled() {
+		return
+	}
+	e.done = make(chan struct{})
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		t := time.NewTicker(otlpInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-e.done:
+				return
+			case <-t.C:
+				e.flush()
+			}
+		}
+	}()
+}
+
+// shutdown exports the remaining spans.
+func (e *exporter) shutdown() {
+	if e.done == nil {
+		return
+	}
+	close(e.done)
+	e.wg.Wait()
+	e.done = nil
+	e.flush()
+}
+
+func (e *exporter) record(s *span) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.queue) >= otlpMaxQueue {
+		e.dropped++
+		return
+	}
+	e.queue = append(e.queue, s)
+}
+
+func (e *exporter) flush() {
+	e.mu.Lock()
+	queue, dropped := e.queue, e.dropped
+	e.queue, e.dropped = nil, 0
+	e.mu.Unlock()
+	if dropped > 0 {
+		fmt.Fprintln(console(), "otlp: dropped", dropped, "spans, the collector is too slow")
+	}
+	for len(queue) > 0 {
+		n := len(queue)
+		if n > otlpBatch {
+			n = otlpBatch
+		}
+		err := e.send(queue[:n])
+		if err != nil {
+			fmt.Fprintln(console(), "otlp: export", n, "spans:", err)
+		}
+		queue = queue[n:]
+	}
+}
+
+func (e *exporter) send(spans []*span) error {
+	b, err := json.Marshal(e.request(spans))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, e.url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+	res, err := e.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		return &statusError{code: res.StatusCode}
+	}
+	return nil
+}
+
+// OTLP JSON encoding of an export request
+type (
+	otlpRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	}
+	otlpScopeSpans struct {
+		Scope struct {
+			Name string `json:"name"`
+		} `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpSpan struct {
+		TraceID    string          `json:"traceId"`
+		SpanID     string          `json:"spanId"`
+		Name       string          `json:"name"`
+		Kind       int             `json:"kind"`
+		Start      string          `json:"startTimeUnixNano"`
+		End        string          `json:"endTimeUnixNano"`
+		Attributes []otlpAttribute `json:"attributes"`
+		Status     *otlpStatus     `json:"status,omitempty"`
+	}
+	otlpAttribute struct {
+		Key   string         `json:"key"`
+		Value map[string]any `json:"value"`
+	}
+	otlpStatus struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+)
+
+// span kind client and status code error
+const (
+	otlpKindClient  = 3
+	otlpStatusError = 2
+)
+
+func (e *exporter) request(spans []*span) otlpRequest {
+	scope := otlpScopeSpans{}
+	scope.Scope.Name = "batch-utilization-exp"
+	for _, s := range spans {
+		o := otlpSpan{
+			TraceID: hex.EncodeToString(s.traceID[:]),
+			SpanID:  hex.EncodeToString(s.spanID[:]),
+			Name:    s.name,
+			Kind:    otlpKindClient,
+			Start:   strconv.FormatInt(s.start.UnixNano(), 10),
+			End:     strconv.FormatInt(s.end.UnixNano(), 10),
+		}
+		for _, a := range s.attrs {
+			o.Attributes = append(o.Attributes, a.otlp())
+		}
+		if s.err != nil {
+			o.Status = &otlpStatus{Code: otlpStatusError, Message: s.err.Error()}
+		}
+		scope.Spans = append(scope.Spans, o)
+	}
+	resource := otlpResource{Attributes: []otlpAttribute{attribute{"service.name", e.service}.otlp()}}
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{Resource: resource, ScopeSpans: []otlpScopeSpans{scope}}}}
+}
+
+type attribute struct {
+	key   string
+	value any
+}
+
+func (a attribute) otlp() otlpAttribute {
+	var v map[string]any
+	switch x := a.value.(type) {
+	case bool:
+		v = map[string]any{"boolValue": x}
+	case int:
+		v = map[string]any{"intValue": strconv.Itoa(x)}
+	case int64:
+		v = map[string]any{"intValue": strconv.FormatInt(x, 10)}
+	case uint64:
+		v = map[string]any{"intValue": strconv.FormatUint(x, 10)}
+	case float64:
+		v = map[string]any{"doubleValue": x}
+	default:
+		v = map[string]any{"stringValue": fmt.Sprint(x)}
+	}
+	return otlpAttribute{Key: a.key, Value: v}
+}
+
+// span is one traced operation, the root of its own trace. A nil span, as
+// returned while tracing is off, ignores all calls.
+type span struct {
+	traceID [16]byte
+	spanID  [8]byte
+	name    string
+	start   time.Time
+	end     time.Time
+	attrs   []attribute
+	err     error
+}
+
+type spanKey struct{}
+
+// startSpan begins a span and returns a context carrying it, for the W3C
+// traceparent header of the requests made with it.
+func startSpan(ctx context.Context, name string, attrs ...attribute) (context.Context, *span) {
+	if !tracer.enabled() {
+		return ctx, nil
+	}
+	s := &span{name: name, start: time.Now(), attrs: attrs}
+	_, _ = rand.Read(s.traceID[:])
+	_, _ = rand.Read(s.spanID[:])
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+func (s *span) set(key string, value any) {
+	if s == nil {
+		return
+	}
+	s.attrs = append(s.attrs, attribute{key, value})
+}
+
+// finish ends the span without exporting it yet, so attributes known only
+// later can still be added.
+func (s *span) finish(err error) {
+	if s == nil {
+		return
+	}
+	s.end, s.err = time.Now(), err
+	if code := statusCode(err); code != 0 {
+		s.set("http.response.status_code", code)
+	}
+}
+
+func (s *span) export() {
+	if s == nil {
+		return
+	}
+	tracer.record(s)
+}
+
+func (s *span) endWith(err error) {
+	s.finish(err)
+	s.export()
+}
+
+// spanOf returns the span in ctx, nil if there is none.
+func spanOf(ctx context.Context) *span {
+	s, _ := ctx.Value(spanKey{}).(*span)
+	return s
+}
+
+// injectTrace adds the traceparent header of the span in the request's
+// context, so the node's traces of the request join the experiment's.
+func injectTrace(req *http.Request) {
+	s := spanOf(req.Context())
+	if s == nil {
+		return
+	}
+	req.Header.Set("traceparent", "00-"+hex.EncodeToString(s.traceID[:])+"-"+hex.EncodeToString(s.spanID[:])+"-01")
+}
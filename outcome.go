@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+)
+
+// summary is the machine readable outcome of a run, one JSON object per
+// experiment on stdout.
+type summary struct {
+	Experiment  string  `json:"experiment"`
+	BatchID     string  `json:"batchID"`
+	StopReason  string  `json:"stopReason"`
+	Error       string  `json:"error,omitempty"`
+	Uploads     int     `json:"uploads"`
+	Failures    int     `json:"failures"`
+	Bytes       int     `json:"bytes"`
+	Chunks      int     `json:"chunks"`
+	Utilization int     `json:"utilization"`
+	Duration    float64 `json:"duration"`
+	// StatusCodes are the counts of the node's responses by status code.
+	StatusCodes map[string]int `json:"statusCodes,omitempty"`
+}
+
+// summaryOf is the summary line of a result.
+func summaryOf(r *Result) summary {
+	s := summary{
+		Experiment:  r.Experiment.Name,
+		BatchID:     r.Experiment.BatchID,
+		StopReason:  r.StopReason,
+		Error:       r.Error,
+		Uploads:     r.Uploads,
+		Failures:    r.Failures,
+		Duration:    r.End.Sub(r.Start).Seconds(),
+		StatusCodes: r.StatusCodes,
+	}
+	if r.Batch != nil {
+		s.BatchID = r.Batch.BatchID
+	}
+	if len(r.Samples) > 0 {
+		last := r.Samples[len(r.Samples)-1]
+		s.Bytes, s.Chunks, s.Utilization = last.Bytes, last.Chunks, last.Utilization
+	}
+	return s
+}
+
+func writeSummaries(w io.Writer, results []*Result) error {
+	enc := json.NewEncoder(w)
+	for _, r := range results {
+		s := summaryOf(r)
+		err := enc.Encode(s)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// printOutcomes writes the final status table of the runs and returns an
+// error with the exit code when they didn't all fill their batch.
+func printOutcomes(w io.Writer, results []*Result) error {
+	color := w == os.Stderr && colorConsole()
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "EXPERIMENT\t%s\tUPLOADS\tFAILURES\tUPLOADED\tUTILIZATION\tERROR\n", stopReasonColor("STOP REASON", color))
+	for _, r := range results {
+		utilization := "-"
+		if len(r.Samples) > 0 {
+			utilization = fmt.Sprint(r.Samples[len(r.Samples)-1].Utilization)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%s\t%s\t%s\n",
+			r.Experiment.Name, stopReasonColor(r.StopReason, color), r.Uploads, r.Failures, prettyByteSize(r.totalUploaded()), utilization, r.Error)
+	}
+	err := tw.Flush()
+	if err != nil {
+		return err
+	}
+	return withExitCode(outcomeCode(results))
+}
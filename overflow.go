@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+// OverflowEvent is one upload attempted after an immutable batch filled up,
+// with the batch state polled right after it.
+type OverflowEvent struct {
+	Time    time.Time `json:"time"`
+	Attempt int       `json:"attempt"`
+	// Status is the HTTP status of a rejected upload, 0 for accepted
+	// uploads and errors without a response.
+	Status      int    `json:"status,omitempty"`
+	Error       string `json:"error,omitempty"`
+	Reference   string `json:"reference,omitempty"`
+	Utilization int    `json:"utilization"`
+	Usable      bool   `json:"usable"`
+}
+
+// Overflow is how the node behaved once the fullest bucket of an
+// immutable batch overflowed.
+type Overflow struct {
+	// Bytes is the total uploaded when the batch was reported full.
+	Bytes  int             `json:"bytes"`
+	Events []OverflowEvent `json:"events"`
+	// Accepted counts the uploads the node still took, FirstFailure is the
+	// attempt of the first rejected one, 0 if there was none.
+	Accepted     int `json:"accepted"`
+	FirstFailure int `json:"firstFailure"`
+	// UnusableAt is the attempt after which the batch was no longer
+	// usable, 0 if it stayed usable.
+	UnusableAt int `json:"unusableAt"`
+}
+
+// overflowCapture keeps uploading into a full immutable batch for a number
+// of attempts, recording every response.
+type overflowCapture struct {
+	batchID  string
+	attempts int
+	report   Overflow
+}
+
+func newOverflowCapture(batchID string, attempts, bytes int) *overflowCapture {
+	return &overflowCapture{batchID: batchID, attempts: attempts, report: Overflow{Bytes: bytes}}
+}
+
+// observe records an upload result and reports whether the capture is
+// complete.
+func (o *overflowCapture) observe(f io.Writer, c *Client, r uploadResult) bool {
+	e := OverflowEvent{Time: clock.Now(), Attempt: len(o.report.Events) + 1}
+	if r.err != nil {
+		e.Status = statusCode(r.err)
+		e.Error = r.err.Error()
+		if o.report.FirstFailure == 0 {
+			o.report.FirstFailure = e.Attempt
+		}
+	} else {
+		e.Reference = r.upload.Reference
+		o.report.Accepted++
+	}
+	batch, err := c.getStamp(o.batchID)
+	if err != nil {
+		log(f, "overflow get stamp: ", err)
+	} else {
+		e.Utilization, e.Usable = batch.Utilization, batch.Usable
+		if !batch.Usable && o.report.UnusableAt == 0 {
+			o.report.UnusableAt = e.Attempt
+		}
+	}
+	o.report.Events = append(o.report.Events, e)
+	log(f, "overflow attempt=", e.Attempt, " status=", e.Status, " accepted=", r.err == nil, " utilization=", e.Utilization, " usable=", e.Usable, " error=", e.Error)
+	return len(o.report.Events) >= o.attempts
+}
+
+// rejectedFull re-reads the batch after an upload the node or the local
+// stamper turned down and returns it when the batch is full, the upload
+// arrived after the last poll had seen it fill up.
+func rejectedFull(c *Client, batch *Batch, err error) (*Batch, bool) {
+	if statusCode(err) == 0 && !errors.Is(err, errBucketFull) {
+		return nil, false
+	}
+	after, err := c.getStamp(batch.BatchID)
+	if err != nil || !after.full() {
+		return nil, false
+	}
+	return after, true
+}
+
+// logOverflow writes the overflow report section of an experiment.
+func logOverflow(f io.Writer, name string, o *Overflow) {
+	log(f, "overflow report ", name, " fullAt=", prettyByteSize(o.Bytes), " attempts=", len(o.Events), " accepted=", o.Accepted,
+		" firstFailure=", formatInt(o.FirstFailure, o.FirstFailure > 0), " unusableAt=", formatInt(o.UnusableAt, o.UnusableAt > 0))
+	statuses := map[int]int{}
+	var codes []int
+	for _, e := range o.Events {
+		if e.Error == "" {
+			continue
+		}
+		if _, ok := statuses[e.Status]; !ok {
+			codes = append(codes, e.Status)
+		}
+		statuses[e.Status]++
+	}
+	for _, code := range codes {
+		log(f, "overflow report ", name, " status=", code, " count=", statuses[code])
+	}
+}
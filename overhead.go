@@ -0,0 +1,116 @@
+package main
+
+import (
+	"io"
+	"strconv"
+)
+
+const gib = 1 << 30
+
+// OverheadClass is the utilization encrypted and plain uploads of one
+// payload size consumed per GiB uploaded. Size is 0 for mixed sizes.
+type OverheadClass struct {
+	Size            int
+	EncryptedPerGiB float64
+	PlainPerGiB     float64
+	// ChunkFactor is how many more chunks the encrypted uploads took, when
+	// known.
+	ChunkFactor float64
+}
+
+// factor is how many times the utilization of the plain uploads the
+// encrypted ones consumed, 0 when unknown.
+func (c OverheadClass) factor() float64 {
+	if c.PlainPerGiB == 0 {
+		return 0
+	}
+	return c.EncryptedPerGiB / c.PlainPerGiB
+}
+
+// encryptionOverhead compares an encrypted run with a plain one, per payload
+// size when both swept the same sizes and over the whole run otherwise.
+func encryptionOverhead(enc, plain *Result) []OverheadClass {
+	if len(enc.Sweep) > 0 && len(plain.Sweep) > 0 {
+		plainBySize := map[int]SweepClass{}
+		for _, s := range plain.Sweep {
+			plainBySize[s.Size] = s
+		}
+		var classes []OverheadClass
+		for _, e := range enc.Sweep {
+			p, ok := plainBySize[e.Size]
+			if !ok || e.Bytes == 0 || p.Bytes == 0 {
+				continue
+			}
+			c := OverheadClass{
+				Size:            e.Size,
+				EncryptedPerGiB: perGiB(e.Utilization, e.Bytes),
+				PlainPerGiB:     perGiB(p.Utilization, p.Bytes),
+			}
+			if p.Chunks > 0 && e.Bytes > 0 {
+				// per byte, the classes may have different upload counts
+				c.ChunkFactor = float64(e.Chunks) / float64(e.Bytes) / (float64(p.Chunks) / float64(p.Bytes))
+			}
+			classes = append(classes, c)
+		}
+		return classes
+	}
+	if len(enc.Samples) == 0 || len(plain.Samples) == 0 {
+		return nil
+	}
+	// compare at the bytes both runs got to
+	at := enc.Samples[len(enc.Samples)-1].Bytes
+	if b := plain.Samples[len(plain.Samples)-1].Bytes; b < at {
+		at = b
+	}
+	ue, _ := utilizationAt(enc.Samples, at)
+	up, _ := utilizationAt(plain.Samples, at)
+	c := OverheadClass{EncryptedPerGiB: perGiB(ue, at), PlainPerGiB: perGiB(up, at)}
+	if len(enc.Experiment.Mix) == 0 && len(plain.Experiment.Mix) == 0 && enc.Experiment.Size == plain.Experiment.Size {
+		c.Size = enc.Experiment.Size
+		c.ChunkFactor = float64(estimateChunks(c.Size, true)) / float64(estimateChunks(c.Size, false))
+	}
+	return []OverheadClass{c}
+}
+
+func perGiB(utilization, bytes int) float64 {
+	if bytes == 0 {
+		return 0
+	}
+	return float64(utilization) * gib / float64(bytes)
+}
+
+// logEncryptionOverhead compares every encrypted run with the first plain
+// one of the same workload.
+func logEncryptionOverhead(f io.Writer, results []*Result) {
+	for _, enc := range results {
+		if !enc.Experiment.Encrypt {
+			continue
+		}
+		for _, plain := range results {
+			if plain.Experiment.Encrypt || plain.Experiment.MixEncrypt != "" || plain.Experiment.Workload != enc.Experiment.Workload {
+				continue
+			}
+			for _, c := range encryptionOverhead(enc, plain) {
+				size := "mixed"
+				if c.Size > 0 {
+					size = prettyByteSize(c.Size)
+				}
+				log(f, "encryption overhead encrypted=", enc.Experiment.Name, " plain=", plain.Experiment.Name, " size=", size,
+					" encryptedPerGiB=", formatFloat(c.EncryptedPerGiB), " plainPerGiB=", formatFloat(c.PlainPerGiB),
+					" extraPerGiB=", formatFloat(c.EncryptedPerGiB-c.PlainPerGiB), " factor=", formatFactor(c.factor()), " chunkFactor=", formatFactor(c.ChunkFactor))
+			}
+			break
+		}
+	}
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', 2, 64)
+}
+
+func formatFactor(v float64) string {
+	if v == 0 {
+		return "-"
+	}
+	return strconv.FormatFloat(v, 'f', 3, 64)
+}
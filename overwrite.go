@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultOverwriteCheck   = 100
+	defaultRetrievalTimeout = 30 * time.Second
+)
+
+// Overwrite keeps uploading once a mutable batch is full, so new chunks
+// replace the oldest ones of their buckets, and then retrieves earlier
+// uploads to see which content got lost.
+type Overwrite struct {
+	// Uploads is the number of uploads past full.
+	Uploads int `json:"uploads"`
+	// Check is how many of the earlier references are retrieved, spread
+	// evenly over the run, 100 by default.
+	Check int `json:"check"`
+	// Timeout bounds each retrieval, 30s by default.
+	Timeout duration `json:"timeout"`
+}
+
+// OverwriteCheck is the retrieval of one earlier upload.
+type OverwriteCheck struct {
+	Reference string `json:"reference"`
+	// Bytes is the total uploaded when the upload finished.
+	Bytes int `json:"bytes"`
+	// AfterFull is set for uploads made after the batch was full.
+	AfterFull   bool   `json:"afterFull"`
+	Retrievable bool   `json:"retrievable"`
+	Error       string `json:"error,omitempty"`
+}
+
+// OverwriteReport is what the uploads past full overwrote.
+type OverwriteReport struct {
+	FullAt  int              `json:"fullAt"`
+	Uploads int              `json:"uploads"`
+	Checks  []OverwriteCheck `json:"checks"`
+	// Lost and LostAfterFull count the unretrievable uploads from before
+	// and after the batch was full.
+	Lost          int `json:"lost"`
+	LostAfterFull int `json:"lostAfterFull"`
+}
+
+type writtenRef struct {
+	ref       string
+	bytes     int
+	afterFull bool
+}
+
+type overwriteCapture struct {
+	cfg     Overwrite
+	written []writtenRef
+	full    bool
+	past    int
+	report  OverwriteReport
+}
+
+func newOverwriteCapture(cfg Overwrite) *overwriteCapture {
+	if cfg.Check <= 0 {
+		cfg.Check = defaultOverwriteCheck
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = duration(defaultRetrievalTimeout)
+	}
+	return &overwriteCapture{cfg: cfg}
+}
+
+func (o *overwriteCapture) record(ref string, bytes int) {
+	o.written = append(o.written, writtenRef{ref: ref, bytes: bytes, afterFull: o.full})
+}
+
+// more is called with every upload that found the batch full and reports
+// whether to keep uploading.
+func (o *overwriteCapture) more(f io.Writer, bytes int) bool {
+	if !o.full {
+		o.full = true
+		o.report.FullAt = bytes
+		log(f, "overwriting uploads=", o.cfg.Uploads)
+	} else {
+		o.past++
+	}
+	return o.past < o.cfg.Uploads
+}
+
+// check retrieves a sample of the earlier uploads.
+func (o *overwriteCapture) check(f io.Writer, c *Client) *OverwriteReport {
+	o.report.Uploads = o.past
+	var before, after []writtenRef
+	for _, w := range o.written {
+		if w.afterFull {
+			after = append(after, w)
+		} else {
+			before = append(before, w)
+		}
+	}
+	for _, w := range append(spread(before, o.cfg.Check), spread(after, o.cfg.Check)...) {
+		ctx, cancel := clock.WithTimeout(context.Background(), time.Duration(o.cfg.Timeout))
+		err := c.retrieve(ctx, w.ref)
+		cancel()
+		check := OverwriteCheck{Reference: w.ref, Bytes: w.bytes, AfterFull: w.afterFull, Retrievable: err == nil}
+		if err != nil {
+			check.Error = err.Error()
+			if w.afterFull {
+				o.report.LostAfterFull++
+			} else {
+				o.report.Lost++
+			}
+			log(f, "overwrite lost reference=", w.ref, " uploadedAt=", prettyByteSize(w.bytes), " afterFull=", w.afterFull, " error=", err)
+		}
+		o.report.Checks = append(o.report.Checks, check)
+	}
+	logOverwrite(f, &o.report)
+	return &o.report
+}
+
+// spread picks n of the references, evenly spaced and including the first
+// and last.
+func spread(refs []writtenRef, n int) []writtenRef {
+	if len(refs) <= n {
+		return refs
+	}
+	if n == 1 {
+		return refs[:1]
+	}
+	picked := make([]writtenRef, 0, n)
+	for i := 0; i < n; i++ {
+		picked = append(picked, refs[i*(len(refs)-1)/(n-1)])
+	}
+	return picked
+}
+
+func logOverwrite(f io.Writer, r *OverwriteReport) {
+	checked, checkedAfter := 0, 0
+	oldest, newest := -1, -1
+	for _, c := range r.Checks {
+		if c.AfterFull {
+			checkedAfter++
+			continue
+		}
+		checked++
+		if !c.Retrievable {
+			if oldest < 0 {
+				oldest = c.Bytes
+			}
+			newest = c.Bytes
+		}
+	}
+	log(f, "overwrite report fullAt=", prettyByteSize(r.FullAt), " uploadsPastFull=", r.Uploads, " checked=", checked, " lost=", r.Lost,
+		" lostRate=", ratio(int64(r.Lost), int64(checked)), " oldestLost=", formatBytes(oldest, oldest >= 0), " newestLost=", formatBytes(newest, newest >= 0),
+		" checkedAfterFull=", checkedAfter, " lostAfterFull=", r.LostAfterFull)
+}
+
+// retrieve downloads the content of ref and discards it.
+func (c *Client) retrieve(ctx context.Context, ref string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.apiURL+"/bytes/"+ref, nil)
+	if err != nil {
+		return err
+	}
+	res, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(res.Body)
+		return &statusError{code: res.StatusCode, body: string(body)}
+	}
+	_, err = io.Copy(io.Discard, res.Body)
+	if err != nil {
+		return fmt.Errorf("read content: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,610 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// payload is the generated data of one iteration and its nominal size,
+// which the data exceeds for archives.
+type payload struct {
+	data []byte
+	size int
+	// generate is how long generating the data took.
+	generate time.Duration
+	// encrypt is set for the encrypted uploads of a MixEncrypt run.
+	encrypt bool
+}
+
+// uploadResult is one finished iteration of the pipeline.
+type uploadResult struct {
+	size   int
+	upload *uploadResponse
+	tag    *Tag
+	// started is when the iteration began and latency how long the
+	// upload request took.
+	started time.Time
+	latency time.Duration
+	err     error
+	// failed is set when the upload itself, not the tag handling, failed.
+	failed bool
+	// stalled is set when the upload was canceled by the stall timer.
+	stalled bool
+	timing  Timing
+	// span is exported by the run loop once the utilization after the
+	// upload is known.
+	span *span
+	// canceled is set for uploads canceled on purpose.
+	canceled *CanceledUpload
+	// encrypted is set when the upload was encrypted.
+	encrypted bool
+	// grew is the utilization growth around the upload, polled by the
+	// worker for sweeps so no other upload lands in between.
+	grew int
+}
+
+// pipeline generates payloads ahead of the uploads into a bounded queue
+// that the upload workers drain, so data generation overlaps with the
+// network I/O.
+type pipeline struct {
+	f        io.Writer
+	c        *Client
+	uploader Uploader
+	// encrypted uploads the encrypted payloads of a MixEncrypt run
+	encrypted Uploader
+	exp       Experiment
+	// history is the ACT history, ACT experiments run a single worker.
+	history string
+
+	queue   chan payload
+	results chan uploadResult
+	done    chan struct{}
+	wg      sync.WaitGroup
+	// stopOnce lets a soak run stop the pipeline it replaces and stop it
+	// again on return when buying the next batch fails
+	stopOnce sync.Once
+	// ctx is canceled by stop, aborting the uploads in flight
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// workers is the number of upload workers, which limit can't exceed
+	workers int
+
+	// limit caps the uploads in flight below the number of workers and
+	// pause delays every upload, both lowered under backpressure.
+	mu     sync.Mutex
+	cond   *sync.Cond
+	limit  int
+	active int
+	pause  time.Duration
+	// interval spaces the upload starts out for the rate limit, next is
+	// when the next one may start
+	interval time.Duration
+	next     time.Time
+	// size of the payloads generated next, changed by the control API
+	size    int
+	held    bool
+	stopped bool
+	// levels are the throughput at each number of uploads in flight
+	levels levelStats
+	// cancels of the uploads in flight, by upload id
+	cancels map[int]context.CancelFunc
+	stalled map[int]bool
+	nextID  int
+}
+
+func startPipeline(f io.Writer, c *Client, u Uploader, exp Experiment) *pipeline {
+	workers := exp.Concurrency
+	if workers < 1 {
+		workers = 1
+	}
+	depth := exp.Queue
+	if depth < 1 {
+		depth = workers
+	}
+	p := &pipeline{
+		f:        f,
+		c:        c,
+		uploader: u,
+		exp:      exp,
+		queue:    make(chan payload, depth),
+		results:  make(chan uploadResult),
+		done:     make(chan struct{}),
+		workers:  workers,
+		limit:    workers,
+		interval: rateInterval(exp.Rate),
+		size:     exp.Size,
+		cancels:  map[int]context.CancelFunc{},
+		stalled:  map[int]bool{},
+	}
+	if exp.InFlight > 0 {
+		p.limit = exp.InFlight
+	}
+	if exp.MixEncrypt != "" {
+		enc := exp
+		enc.Encrypt = true
+		// the config was validated with the same workload
+		p.encrypted, _ = newUploader(c, enc)
+	}
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+	p.cond = sync.NewCond(&p.mu)
+	p.wg.Add(1 + workers)
+	switch {
+	case exp.Trace != nil:
+		go p.replay()
+	case exp.Source != nil:
+		go p.ingest()
+	default:
+		go p.produce()
+	}
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+	// results is closed once a replay or source ran out and the workers are done
+	go func() {
+		p.wg.Wait()
+		close(p.results)
+	}()
+	return p
+}
+
+// replay queues the uploads of the experiment's trace at their time.
+func (p *pipeline) replay() {
+	defer p.wg.Done()
+	defer close(p.queue)
+	entries, skipped, err := loadTrace(p.exp.Trace.File)
+	if err != nil {
+		p.send(uploadResult{err: fmt.Errorf("load trace: %w", err)})
+		return
+	}
+	log(p.f, "trace uploads=", len(entries), " skipped=", skipped, " speed=", p.exp.Trace.Speed)
+	speed := p.exp.Trace.Speed
+	if speed <= 0 {
+		speed = 1
+	}
+	start := clock.Now()
+	for _, e := range entries {
+		if p.exp.Align != "" {
+			e.size = alignSize(e.size, p.exp.Align, p.exp.Encrypt)
+		}
+		generating := clock.Now()
+		b, err := p.uploader.Payload(e.size)
+		if err != nil {
+			p.send(uploadResult{err: fmt.Errorf("generate payload: %w", err)})
+			return
+		}
+		wait := until(start.Add(time.Duration(float64(e.at) / speed)))
+		if wait > 0 {
+			select {
+			case <-clock.After(wait):
+			case <-p.done:
+				return
+			}
+		}
+		select {
+		case p.queue <- payload{data: b, size: e.size, generate: since(generating)}:
+		case <-p.done:
+			return
+		}
+	}
+}
+
+func (p *pipeline) produce() {
+	defer p.wg.Done()
+	defer close(p.queue)
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	picker := encryptPicker{mode: p.exp.MixEncrypt, rnd: rnd}
+	var b payload
+	for i := 0; ; i++ {
+		if b.data == nil || p.exp.Repeat == 0 {
+			b.size = p.payloadSize()
+			if len(p.exp.Mix) > 0 && p.exp.Repeat == 0 {
+				b.size = pickSize(p.exp.Mix, rnd)
+			}
+			if len(p.exp.Sweep) > 0 {
+				b.size = p.exp.Sweep[i%len(p.exp.Sweep)]
+			}
+			generating := clock.Now()
+			var err error
+			b.data, err = p.uploader.Payload(b.size)
+			if err != nil {
+				p.send(uploadResult{err: fmt.Errorf("generate payload: %w", err)})
+				return
+			}
+			b.generate = since(generating)
+		} else {
+			// repeated payloads are generated once
+			b.generate = 0
+		}
+		b.encrypt = picker.next()
+		select {
+		case p.queue <- b:
+		case <-p.done:
+			return
+		}
+	}
+}
+
+func (p *pipeline) work() {
+	defer p.wg.Done()
+	for {
+		var b payload
+		var ok bool
+		select {
+		case b, ok = <-p.queue:
+			if !ok {
+				return
+			}
+		case <-p.done:
+			return
+		}
+		if !p.acquire() {
+			return
+		}
+		if p.exp.InFlight > 0 {
+			// pipelined, the worker takes the next payload while the
+			// upload is in flight
+			p.wg.Add(1)
+			go func() {
+				defer p.wg.Done()
+				if r, ok := p.finish(b); ok {
+					p.send(r)
+				}
+			}()
+			continue
+		}
+		r, ok := p.finish(b)
+		if !ok || !p.send(r) {
+			return
+		}
+	}
+}
+
+// finish uploads b, retrying stalled uploads if configured, and frees its
+// slot. ok is false when the pipeline stopped meanwhile.
+func (p *pipeline) finish(b payload) (r uploadResult, ok bool) {
+	defer p.release()
+	p.mu.Lock()
+	start, area := p.levels.tick(p.active)
+	p.mu.Unlock()
+	r = p.upload(b)
+	for r.stalled && p.exp.Stall != nil && p.exp.Stall.OnStall == stallRetry {
+		select {
+		case <-p.done:
+			return r, false
+		default:
+		}
+		log(p.f, "retrying stalled upload size=", prettyByteSize(b.size))
+		r = p.upload(b)
+	}
+	if r.err == nil && r.upload != nil {
+		p.mu.Lock()
+		p.levels.finished(p.active, start, area, r.size)
+		p.mu.Unlock()
+	}
+	return r, true
+}
+
+// acquire waits for an upload slot and the pause, false when the pipeline
+// stopped meanwhile.
+func (p *pipeline) acquire() bool {
+	p.mu.Lock()
+	for (p.held || p.active >= p.limit) && !p.stopped {
+		p.cond.Wait()
+	}
+	if p.stopped {
+		p.mu.Unlock()
+		return false
+	}
+	p.levels.tick(p.active)
+	p.active++
+	pause := p.pause
+	if p.interval > 0 {
+		now := clock.Now()
+		if p.next.Before(now) {
+			p.next = now
+		}
+		pause += p.next.Sub(now)
+		p.next = p.next.Add(p.interval)
+	}
+	p.mu.Unlock()
+	if pause > 0 {
+		select {
+		case <-clock.After(pause):
+		case <-p.done:
+			p.release()
+			return false
+		}
+	}
+	return true
+}
+
+func (p *pipeline) release() {
+	p.mu.Lock()
+	p.levels.tick(p.active)
+	p.active--
+	p.mu.Unlock()
+	p.cond.Broadcast()
+}
+
+// hold pauses new uploads until resume, uploads in flight finish.
+func (p *pipeline) hold() {
+	p.mu.Lock()
+	p.held = true
+	p.mu.Unlock()
+}
+
+func (p *pipeline) resume() {
+	p.mu.Lock()
+	p.held = false
+	p.mu.Unlock()
+	p.cond.Broadcast()
+}
+
+// throttle sets the uploads in flight and the pause before each upload.
+func (p *pipeline) throttle(limit int, pause time.Duration) {
+	p.mu.Lock()
+	p.limit, p.pause = limit, pause
+	p.mu.Unlock()
+	p.cond.Broadcast()
+}
+
+// setRate limits the upload starts to perSecond, 0 lifts the limit.
+func (p *pipeline) setRate(perSecond float64) {
+	p.mu.Lock()
+	p.interval = rateInterval(perSecond)
+	p.mu.Unlock()
+}
+
+func rateInterval(perSecond float64) time.Duration {
+	if perSecond <= 0 {
+		return 0
+	}
+	return time.Duration(float64(time.Second) / perSecond)
+}
+
+// setSize changes the size of the payloads generated from now on, the
+// queued ones keep theirs.
+func (p *pipeline) setSize(size int) {
+	p.mu.Lock()
+	p.size = size
+	p.mu.Unlock()
+}
+
+func (p *pipeline) payloadSize() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.size
+}
+
+func (p *pipeline) upload(b payload) uploadResult {
+	started := clock.Now()
+	var tag *Tag
+	err := p.exp.Retry.tag().do(p.ctx, p.f, "create tag", func() error {
+		var err error
+		tag, err = p.c.createTag()
+		return err
+	})
+	if err != nil {
+		return uploadResult{started: started, err: fmt.Errorf("create tag: %w", err)}
+	}
+	if p.exp.Hooks != nil {
+		err = p.exp.Hooks.run(p.exp.Hooks.BeforeUpload, hookEvent{Event: "beforeUpload", Experiment: p.exp.Name, BatchID: p.exp.BatchID, Size: b.size})
+		if err != nil {
+			return uploadResult{started: started, err: err}
+		}
+	}
+	var cut *CanceledUpload
+	if p.exp.Cancel != nil && p.exp.Cancel.due() {
+		cut, err = p.beforeCancel(b)
+		if err != nil {
+			return uploadResult{started: started, err: err}
+		}
+	}
+	var before *Batch
+	if len(p.exp.Sweep) > 0 {
+		before, err = p.c.getStamp(p.exp.BatchID)
+		if err != nil {
+			return uploadResult{started: started, err: fmt.Errorf("get stamp: %w", err)}
+		}
+	}
+	ctx, id := p.track()
+	if cut != nil {
+		ctx = withCancelAt(ctx, cut.Sent)
+	}
+	ctx, span := startSpan(ctx, "upload",
+		attribute{"swarm.experiment", p.exp.Name},
+		attribute{"swarm.batch.id", p.exp.BatchID},
+		attribute{"swarm.workload", p.exp.Workload},
+		attribute{"swarm.encrypt", p.exp.Encrypt || b.encrypt},
+		attribute{"swarm.redundancy_level", p.exp.RedundancyLevel},
+		attribute{"swarm.upload.size", b.size})
+	sent := clock.Now()
+	tagging := sent.Sub(started)
+	var timer requestTimer
+	uploader := p.uploader
+	if b.encrypt {
+		uploader = p.encrypted
+	}
+	var upload *uploadResponse
+	err = p.exp.Retry.upload().do(ctx, p.f, "upload", func() error {
+		var err error
+		upload, err = uploader.Upload(timer.trace(ctx), b.data, tag.UID, p.history)
+		return err
+	})
+	stalled := p.untrack(id)
+	span.finish(err)
+	if cut != nil && err != nil && !stalled {
+		span.set("swarm.upload.canceled_at", cut.Sent)
+		span.export()
+		err = p.afterCancel(cut)
+		return uploadResult{size: b.size, started: started, canceled: cut, err: err}
+	}
+	if err != nil {
+		span.export()
+		return uploadResult{started: started, err: fmt.Errorf("upload data: %w", err), failed: true, stalled: stalled}
+	}
+	span.set("swarm.reference", upload.Reference)
+	latency := since(sent)
+	timing := timer.timing(latency)
+	timing.Generate = b.generate
+	if p.exp.Act != nil && p.history == "" {
+		// the first upload creates the history, the grantee list is
+		// added to it once and shared by all later uploads.
+		p.history = upload.History
+		if len(p.exp.Act.Grantees) > 0 {
+			grantee, err := p.c.createGrantees(p.exp.BatchID, p.history, p.exp.Act.Grantees)
+			if err != nil {
+				span.export()
+				return uploadResult{started: started, err: fmt.Errorf("create grantees: %w", err)}
+			}
+			p.history = grantee.HistoryRef
+			log(p.f, "act granteeRef=", grantee.Ref, " history=", p.history)
+		}
+	}
+	getting := clock.Now()
+	uid := tag.UID
+	err = p.exp.Retry.tag().do(p.ctx, p.f, "get tag", func() error {
+		var err error
+		tag, err = p.c.getTag(uid)
+		return err
+	})
+	if err != nil {
+		span.export()
+		return uploadResult{started: started, err: fmt.Errorf("get tag: %w", err)}
+	}
+	timing.Tag = tagging + since(getting)
+	span.set("swarm.tag.split", tag.Split)
+	r := uploadResult{size: b.size, upload: upload, tag: tag, started: started, latency: latency, timing: timing, span: span, encrypted: b.encrypt}
+	if before != nil {
+		after, err := p.c.getStamp(p.exp.BatchID)
+		if err != nil {
+			span.export()
+			return uploadResult{started: started, err: fmt.Errorf("get stamp: %w", err)}
+		}
+		r.grew = after.Utilization - before.Utilization
+	}
+	return r
+}
+
+// beforeCancel counts the stamped chunks before an upload gets canceled.
+func (p *pipeline) beforeCancel(b payload) (*CanceledUpload, error) {
+	at := p.exp.Cancel.At
+	if at <= 0 {
+		at = defaultCancelAt
+	}
+	stamped, err := stampedChunks(p.c, p.exp.BatchID)
+	if err != nil {
+		return nil, fmt.Errorf("count stamped chunks: %w", err)
+	}
+	batch, err := p.c.getStamp(p.exp.BatchID)
+	if err != nil {
+		return nil, fmt.Errorf("get stamp: %w", err)
+	}
+	return &CanceledUpload{
+		Size:              b.size,
+		Sent:              int(float64(len(b.data)) * at),
+		StampedChunks:     stamped,
+		ExpectedChunks:    p.uploader.Chunks(b.size),
+		UtilizationBefore: batch.Utilization,
+	}, nil
+}
+
+// afterCancel counts what the canceled upload stamped, once the node had
+// time to store what it got.
+func (p *pipeline) afterCancel(cut *CanceledUpload) error {
+	clock.Sleep(cancelSettle)
+	stamped, err := stampedChunks(p.c, p.exp.BatchID)
+	if err != nil {
+		return fmt.Errorf("count stamped chunks: %w", err)
+	}
+	batch, err := p.c.getStamp(p.exp.BatchID)
+	if err != nil {
+		return fmt.Errorf("get stamp: %w", err)
+	}
+	cut.StampedChunks = stamped - cut.StampedChunks
+	cut.UtilizationAfter = batch.Utilization
+	return nil
+}
+
+func (p *pipeline) send(r uploadResult) bool {
+	select {
+	case p.results <- r:
+		return true
+	case <-p.done:
+		return false
+	}
+}
+
+// inFlight is the number of uploads in progress.
+func (p *pipeline) inFlight() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.active
+}
+
+// track returns the context of a new upload and its id.
+func (p *pipeline) track() (context.Context, int) {
+	ctx, cancel := context.WithCancel(p.ctx)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.nextID++
+	p.cancels[p.nextID] = cancel
+	return ctx, p.nextID
+}
+
+// untrack ends an upload and reports whether it was canceled as stalled.
+func (p *pipeline) untrack(id int) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if cancel, ok := p.cancels[id]; ok {
+		cancel()
+		delete(p.cancels, id)
+	}
+	stalled := p.stalled[id]
+	delete(p.stalled, id)
+	return stalled
+}
+
+// cancelInFlight cancels all uploads in progress as stalled.
+func (p *pipeline) cancelInFlight() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for id, cancel := range p.cancels {
+		cancel()
+		delete(p.cancels, id)
+		p.stalled[id] = true
+	}
+}
+
+// inFlightReport is the throughput at the levels of uploads in flight the
+// pipeline went through, nil for fewer than two.
+func (p *pipeline) inFlightReport() *InFlightReport {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.levels.tick(p.active)
+	return p.levels.report()
+}
+
+// depth is the number of payloads waiting for a worker.
+func (p *pipeline) depth() int {
+	return len(p.queue)
+}
+
+// stop ends the pipeline, dropping queued payloads and the results of
+// uploads still in flight.
+func (p *pipeline) stop() {
+	p.stopOnce.Do(func() {
+		close(p.done)
+		p.cancel()
+		p.mu.Lock()
+		p.stopped = true
+		p.mu.Unlock()
+		p.cond.Broadcast()
+		p.wg.Wait()
+	})
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const maxDepth = 40
+
+// redundancyShards are the data chunks per group of 128 references at each
+// redundancy level, the rest of the group are parities. Encrypted
+// references are 64 bytes, so their groups are 64 references with the
+// shards of encryptedRedundancyShards.
+var (
+	redundancyShards          = [maxRedundancyLevel + 1]int{branches, 119, 107, 97, 38}
+	encryptedRedundancyShards = [maxRedundancyLevel + 1]int{branches / 2, 59, 53, 48, 19}
+)
+
+// planChunks is the number of chunks a dataset of size bytes stamps,
+// including the trie and the parities of the redundancy level.
+func planChunks(size int, encrypt bool, level int) int {
+	n := estimateChunks(size, encrypt)
+	refs, shards := branches, redundancyShards[level]
+	if encrypt {
+		refs, shards = branches/2, encryptedRedundancyShards[level]
+	}
+	return int(math.Ceil(float64(n) * float64(refs) / float64(shards)))
+}
+
+// theoreticalFill is the share of a batch's chunks stamped once the fullest
+// bucket is full, for chunks assigned to the 2^bucketDepth buckets
+// uniformly at random. The fullest of n buckets at a mean load m holds
+// about m + sqrt(2 m ln n), solved for the m that fills capacity c.
+func theoreticalFill(depth, bucketDepth int) float64 {
+	c := float64(uint64(1) << uint(depth-bucketDepth))
+	l := float64(bucketDepth) * math.Ln2
+	return (c + l - math.Sqrt(l*l+2*c*l)) / c
+}
+
+// planDepth is the smallest depth above the bucket depth that holds chunks
+// at the fill ratio fill returns for it.
+func planDepth(chunks, bucketDepth int, fill func(depth int) float64) (int, error) {
+	for depth := bucketDepth + 1; depth <= maxDepth; depth++ {
+		if fill(depth)*float64(uint64(1)<<uint(depth)) >= float64(chunks) {
+			return depth, nil
+		}
+	}
+	return 0, fmt.Errorf("%d chunks don't fit a batch of depth %d", chunks, maxDepth)
+}
+
+// empiricalFactor is how the fill ratios past runs observed compare to
+// the theoretical model at their depth, averaged over the runs that filled
+// a batch with the same encryption, redundancy and bucket depth.
+func empiricalFactor(records []Record, encrypt bool, level, bucketDepth int) (factor float64, runs int) {
+	for _, r := range records {
+		if r.fillRatio() == 0 || r.Encrypt != encrypt || r.RedundancyLevel != level || r.BucketDepth != bucketDepth || r.Depth <= r.BucketDepth {
+			continue
+		}
+		factor += r.fillRatio() / theoreticalFill(r.Depth, r.BucketDepth)
+		runs++
+	}
+	if runs == 0 {
+		return 0, 0
+	}
+	return factor / float64(runs), runs
+}
+
+// planAmount is the amount per chunk that keeps a batch alive for ttl at
+// the price per chunk and block.
+func planAmount(price *big.Int, ttl time.Duration) *big.Int {
+	blocks := int64((ttl + blockTime - 1) / blockTime)
+	return new(big.Int).Mul(price, big.NewInt(blocks))
+}
+
+func batchBZZ(amount *big.Int, depth int) float64 {
+	plur := new(big.Int).Lsh(amount, uint(depth))
+	bzz, _ := new(big.Float).Quo(new(big.Float).SetInt(plur), big.NewFloat(plurPerBZZ)).Float64()
+	return bzz
+}
+
+// parseSize parses sizes like 4096, 512MiB or 1.5TiB.
+func parseSize(s string) (int, error) {
+	s = strings.TrimSuffix(strings.TrimSpace(s), "B")
+	i := strings.IndexFunc(s, func(r rune) bool { return r != '.' && (r < '0' || r > '9') })
+	if i < 0 {
+		return parseByteSize(s, "")
+	}
+	return parseByteSize(s[:i], s[i:])
+}
+
+func cmdPlan(args []string) error {
+	fs := newFlagSet("plan", "[flags] -size <dataset size>")
+	size := fs.String("size", "", "size of the dataset, e.g. 10GiB")
+	encrypt := fs.Bool("encrypt", false, "the dataset is uploaded encrypted")
+	level := fs.Int("redundancy", 0, "erasure coding level of the uploads, 0-4")
+	bucketDepth := fs.Int("bucket-depth", 16, "bucket depth of the batch")
+	margin := fs.Float64("margin", 0.1, "extra room planned on top of the dataset, as a share of it")
+	ttl := fs.Duration("ttl", 30*24*time.Hour, "time the batch has to stay alive")
+	price := fs.String("price", "", "price per chunk and block in PLUR, the node's current price by default")
+	fs.Parse(args)
+	if *size == "" {
+		fs.Usage()
+		return withExitCode(exitUsage, fmt.Errorf("need the dataset size"))
+	}
+	bytes, err := parseSize(*size)
+	if err != nil {
+		return withExitCode(exitUsage, fmt.Errorf("-size: %w", err))
+	}
+	switch {
+	case bytes <= 0:
+		return withExitCode(exitUsage, fmt.Errorf("-size must be positive"))
+	case *level < 0 || *level > maxRedundancyLevel:
+		return withExitCode(exitUsage, fmt.Errorf("-redundancy %d out of range 0-%d", *level, maxRedundancyLevel))
+	case *bucketDepth <= 0 || *bucketDepth >= maxDepth:
+		return withExitCode(exitUsage, fmt.Errorf("-bucket-depth %d out of range", *bucketDepth))
+	case *margin < 0 || *ttl <= 0:
+		return withExitCode(exitUsage, fmt.Errorf("negative -margin or -ttl"))
+	}
+
+	var records []Record
+	if global.resultsDB != "" {
+		records, err = loadRecords(global.resultsDB)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("results db: %w", err)
+		}
+	}
+	var perChunk *big.Int
+	if *price == "" {
+		state, err := global.client().getChainState()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "no amount and cost: get chainstate:", err, "- pass -price to plan offline")
+		} else {
+			*price = state.CurrentPrice
+		}
+	}
+	if *price != "" {
+		p, ok := new(big.Int).SetString(*price, 10)
+		if !ok || p.Sign() <= 0 {
+			return withExitCode(exitUsage, fmt.Errorf("invalid price %q", *price))
+		}
+		perChunk = planAmount(p, *ttl)
+	}
+
+	if *price == "" {
+		*price = "-"
+	}
+	chunks := planChunks(bytes, *encrypt, *level)
+	chunks += int(math.Ceil(float64(chunks) * *margin))
+	fmt.Fprintf(os.Stdout, "dataset=%s encrypt=%t redundancy=%d chunks=%d margin=%s ttl=%s price=%s\n",
+		prettyByteSize(bytes), *encrypt, *level, chunks, formatFloat(*margin*100)+"%", *ttl, *price)
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "MODEL\tRUNS\tFILL\tDEPTH\tCAPACITY\tAMOUNT\tCOST")
+	row := func(model, runs string, fill func(depth int) float64) (int, error) {
+		depth, err := planDepth(chunks, *bucketDepth, fill)
+		if err != nil {
+			return 0, fmt.Errorf("%s model: %w", model, err)
+		}
+		amount, cost := "-", "-"
+		if perChunk != nil {
+			amount, cost = perChunk.String(), fmt.Sprintf("%.4fBZZ", batchBZZ(perChunk, depth))
+		}
+		capacity := int(fill(depth) * float64(uint64(1)<<uint(depth)) * chunkSize)
+		fmt.Fprintf(tw, "%s\t%s\t%.3f\t%d\t%s\t%s\t%s\n", model, runs, fill(depth), depth, prettyByteSize(capacity), amount, cost)
+		return depth, nil
+	}
+	depth, err := row("theoretical", "-", func(depth int) float64 { return theoreticalFill(depth, *bucketDepth) })
+	if err != nil {
+		return err
+	}
+	model := "theoretical"
+	if factor, runs := empiricalFactor(records, *encrypt, *level, *bucketDepth); runs > 0 {
+		depth, err = row("empirical", fmt.Sprint(runs), func(depth int) float64 {
+			return math.Min(1, factor*theoreticalFill(depth, *bucketDepth))
+		})
+		if err != nil {
+			return err
+		}
+		model = "empirical"
+	}
+	err = tw.Flush()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stdout, "recommended model=%s depth=%d", model, depth)
+	if perChunk != nil {
+		fmt.Fprintf(os.Stdout, " amount=%s cost=%.4fBZZ", perChunk, batchBZZ(perChunk, depth))
+	}
+	fmt.Fprintln(os.Stdout)
+	return nil
+}
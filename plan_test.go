@@ -0,0 +1,166 @@
+package main
+
+import (
+	"math"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestTheoreticalFill(t *testing.T) {
+	tests := []struct {
+		depth, bucketDepth int
+		want               float64
+	}{
+		{17, 16, 0.0768},
+		{20, 16, 0.3269},
+		{22, 16, 0.5596},
+		{24, 16, 0.7458},
+		{30, 16, 0.9639},
+	}
+	for _, tt := range tests {
+		if got := theoreticalFill(tt.depth, tt.bucketDepth); math.Abs(got-tt.want) > 1e-4 {
+			t.Errorf("theoreticalFill(%d, %d) = %.4f, want %.4f", tt.depth, tt.bucketDepth, got, tt.want)
+		}
+	}
+	// deeper batches even out the buckets
+	for depth := 18; depth <= maxDepth; depth++ {
+		if theoreticalFill(depth, 16) <= theoreticalFill(depth-1, 16) {
+			t.Errorf("fill at depth %d isn't above depth %d", depth, depth-1)
+		}
+	}
+}
+
+func TestPlanDepth(t *testing.T) {
+	theoretical := func(depth int) float64 { return theoreticalFill(depth, 16) }
+	full := func(int) float64 { return 1 }
+	half := func(int) float64 { return 0.5 }
+	tests := []struct {
+		name   string
+		chunks int
+		fill   func(int) float64
+		want   int
+	}{
+		{"one chunk", 1, theoretical, 17},
+		{"theoretical", 100000, theoretical, 19},
+		{"theoretical boundary", 115153, theoretical, 19},
+		{"theoretical past boundary", 115154, theoretical, 20},
+		{"full", 1 << 20, full, 20},
+		{"full past capacity", 1<<20 + 1, full, 21},
+		{"half", 1 << 20, half, 21},
+		{"too large", 1 << 40, half, 0},
+	}
+	for _, tt := range tests {
+		got, err := planDepth(tt.chunks, 16, tt.fill)
+		if tt.want == 0 {
+			if err == nil {
+				t.Errorf("%s: got depth %d, want an error", tt.name, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%s: got %d, %v, want %d", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestPlanChunks(t *testing.T) {
+	const size = 1000 * chunkSize
+	tests := []struct {
+		encrypt bool
+		level   int
+		want    int
+	}{
+		{false, 0, estimateChunks(size, false)},
+		{false, 1, int(math.Ceil(float64(estimateChunks(size, false)) * 128 / 119))},
+		{false, 4, int(math.Ceil(float64(estimateChunks(size, false)) * 128 / 38))},
+		{true, 0, estimateChunks(size, true)},
+		// encrypted groups are 64 references with fewer data shards
+		{true, 1, int(math.Ceil(float64(estimateChunks(size, true)) * 64 / 59))},
+		{true, 4, int(math.Ceil(float64(estimateChunks(size, true)) * 64 / 19))},
+	}
+	for _, tt := range tests {
+		if got := planChunks(size, tt.encrypt, tt.level); got != tt.want {
+			t.Errorf("planChunks(encrypt=%v, level=%d) = %d, want %d", tt.encrypt, tt.level, got, tt.want)
+		}
+	}
+	if planChunks(size, true, 4) <= planChunks(size, false, 4) {
+		t.Error("encrypted paranoid uploads don't take more chunks than plain ones")
+	}
+}
+
+func TestEmpiricalFactor(t *testing.T) {
+	// a run at depth 20 that filled to twice the theoretical fill, and one
+	// at the theoretical fill
+	twice := int(2 * theoreticalFill(20, 16) * (1 << 20))
+	exact := int(theoreticalFill(22, 16) * (1 << 22))
+	records := []Record{
+		{Depth: 20, BucketDepth: 16, ChunksToFull: twice},
+		{Depth: 22, BucketDepth: 16, ChunksToFull: exact},
+		{Depth: 20, BucketDepth: 16, ChunksToFull: twice, Encrypt: true},
+		{Depth: 20, BucketDepth: 16, ChunksToFull: twice, RedundancyLevel: 2},
+		{Depth: 20, BucketDepth: 18, ChunksToFull: twice},
+		{Depth: 20, BucketDepth: 16},
+	}
+	tests := []struct {
+		name               string
+		encrypt            bool
+		level, bucketDepth int
+		factor             float64
+		runs               int
+	}{
+		{"plain", false, 0, 16, 1.5, 2},
+		{"encrypted", true, 0, 16, 2, 1},
+		{"redundancy", false, 2, 16, 2, 1},
+		{"no runs", false, 1, 16, 0, 0},
+	}
+	for _, tt := range tests {
+		factor, runs := empiricalFactor(records, tt.encrypt, tt.level, tt.bucketDepth)
+		if runs != tt.runs || math.Abs(factor-tt.factor) > 1e-4 {
+			t.Errorf("%s: got factor %.4f of %d runs, want %.4f of %d", tt.name, factor, runs, tt.factor, tt.runs)
+		}
+	}
+}
+
+func TestPlanAmount(t *testing.T) {
+	tests := []struct {
+		price int64
+		ttl   time.Duration
+		want  int64
+	}{
+		{24000, 10 * blockTime, 240000},
+		// a part of a block costs the whole block
+		{24000, 10*blockTime + time.Second, 264000},
+		{1, 24 * time.Hour, 17280},
+	}
+	for _, tt := range tests {
+		if got := planAmount(big.NewInt(tt.price), tt.ttl); got.Int64() != tt.want {
+			t.Errorf("planAmount(%d, %v) = %s, want %d", tt.price, tt.ttl, got, tt.want)
+		}
+	}
+	if got := batchBZZ(big.NewInt(1e10), 20); math.Abs(got-1.048576) > 1e-9 {
+		t.Errorf("batchBZZ = %v, want 1.048576", got)
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int
+		ok   bool
+	}{
+		{"4096", 4096, true},
+		{"4KiB", 4096, true},
+		{"512MiB", 512 << 20, true},
+		{"1.5GiB", 3 << 29, true},
+		{" 2TiB ", 2 << 40, true},
+		{"10GB", 0, false},
+		{"lots", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := parseSize(tt.in)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("parseSize(%q) = %d, %v, want %d", tt.in, got, err, tt.want)
+		}
+	}
+}
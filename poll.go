@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Poll sets how often the batch is polled during a run. A poll is due
+// every Uploads uploads or every Interval, whichever comes first. Without
+// it the batch is polled after every upload.
+type Poll struct {
+	Uploads  int      `json:"uploads"`
+	Interval duration `json:"interval"`
+}
+
+// duration is a time.Duration read from a JSON string such as "30s".
+type duration time.Duration
+
+func (d *duration) UnmarshalJSON(b []byte) error {
+	var s string
+	err := json.Unmarshal(b, &s)
+	if err != nil {
+		return fmt.Errorf("duration must be a string such as \"30s\"")
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(v)
+	return nil
+}
+
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// stampPoller polls the batch for the upload loop. Polls by upload count
+// run as the uploads finish, polls by interval run in the background so
+// uploads never wait on them, and the loop reads the latest batch.
+type stampPoller struct {
+	c       *Client
+	poll    Poll
+	trigger chan struct{}
+	// interval takes a new poll interval to the loop
+	interval chan time.Duration
+	done     chan struct{}
+	wg       sync.WaitGroup
+	stopOnce sync.Once
+	// polling serializes the polls of the loop and the upload loop
+	polling sync.Mutex
+	// retry retries failed polls, ctx is canceled by stop to end the waits
+	retry  *RetryPolicy
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// uploads is only touched by the upload loop
+	uploads int
+
+	mu    sync.Mutex
+	batch *Batch
+	err   error
+}
+
+func newStampPoller(c *Client, poll *Poll, retry *RetryPolicy, batch *Batch) *stampPoller {
+	p := &stampPoller{
+		c:        c,
+		retry:    retry,
+		batch:    batch,
+		trigger:  make(chan struct{}, 1),
+		interval: make(chan time.Duration),
+		done:     make(chan struct{}),
+	}
+	if poll != nil {
+		p.poll = *poll
+	}
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+	p.wg.Add(1)
+	go p.loop(time.Duration(p.poll.Interval))
+	return p
+}
+
+func (p *stampPoller) loop(interval time.Duration) {
+	defer p.wg.Done()
+	var t *Ticker
+	var tick <-chan time.Time
+	reset := func() {
+		if t != nil {
+			t.Stop()
+			t, tick = nil, nil
+		}
+		if interval > 0 {
+			t = clock.NewTicker(interval)
+			tick = t.C
+		}
+	}
+	reset()
+	defer func() {
+		if t != nil {
+			t.Stop()
+		}
+	}()
+	id := p.latest().BatchID
+	for {
+		select {
+		case <-p.done:
+			return
+		case interval = <-p.interval:
+			reset()
+			continue
+		case <-tick:
+		case <-p.trigger:
+		}
+		p.refresh(id)
+	}
+}
+
+// refresh polls the batch and stores the outcome. Polls are serialized so
+// a slower one can't overwrite the state of a later one.
+func (p *stampPoller) refresh(id string) {
+	p.polling.Lock()
+	defer p.polling.Unlock()
+	_, span := startSpan(context.Background(), "stamp poll", attribute{"swarm.batch.id", id})
+	var batch *Batch
+	err := p.retry.do(p.ctx, io.Discard, "get stamp", func() error {
+		var err error
+		batch, err = p.c.getStamp(id)
+		return err
+	})
+	if err == nil {
+		span.set("swarm.batch.utilization", batch.Utilization)
+		span.set("swarm.batch.depth", batch.Depth)
+		span.set("swarm.batch.usable", batch.Usable)
+	}
+	span.endWith(err)
+	p.mu.Lock()
+	if err == nil {
+		p.batch = batch
+	}
+	p.err = err
+	p.mu.Unlock()
+}
+
+func (p *stampPoller) latest() *Batch {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.batch
+}
+
+// uploaded records an upload, polls when one is due and returns the latest
+// batch along with the error of the last poll. Polling per upload, or by
+// count without an interval, waits for the poll so the run sees the batch
+// the upload left behind; polls between intervals run in the background.
+func (p *stampPoller) uploaded() (*Batch, error) {
+	p.uploads++
+	every := p.poll.Uploads
+	if every <= 0 && p.poll.Interval <= 0 {
+		every = 1
+	}
+	if every > 0 && p.uploads >= every {
+		p.uploads = 0
+		if every == 1 || p.poll.Interval <= 0 {
+			return p.now()
+		}
+		select {
+		case p.trigger <- struct{}{}:
+		default:
+			// a poll is already pending
+		}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.batch, p.err
+}
+
+func (p *stampPoller) now() (*Batch, error) {
+	p.refresh(p.latest().BatchID)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.batch, p.err
+}
+
+// setPoll replaces the poll settings, like uploaded it is only called by
+// the upload loop.
+func (p *stampPoller) setPoll(poll Poll) {
+	p.poll = poll
+	p.uploads = 0
+	select {
+	case p.interval <- time.Duration(poll.Interval):
+	case <-p.done:
+	}
+}
+
+// set replaces the latest batch and clears the last poll error.
+func (p *stampPoller) set(batch *Batch) {
+	p.mu.Lock()
+	p.batch, p.err = batch, nil
+	p.mu.Unlock()
+}
+
+func (p *stampPoller) stop() {
+	p.stopOnce.Do(func() {
+		close(p.done)
+		p.cancel()
+		p.wg.Wait()
+	})
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"io"
+	mrand "math/rand"
+	"net/http"
+)
+
+const (
+	defaultPresenceEvery = 10
+	presencePool         = 100
+)
+
+// Presence checks every Every uploads whether the node still holds the root
+// chunks of the latest upload and of a random earlier one, to catch data
+// the node silently lost.
+type Presence struct {
+	Every int `json:"every"`
+}
+
+// PresenceReport counts the root chunks checked and found on the node.
+type PresenceReport struct {
+	Checked int `json:"checked"`
+	Present int `json:"present"`
+	// Errors counts checks the node didn't answer.
+	Errors int `json:"errors"`
+}
+
+func (r PresenceReport) rate() string {
+	return ratio(int64(r.Present), int64(r.Checked))
+}
+
+type presenceSampler struct {
+	every   int
+	uploads int
+	// pool is a uniform sample of the earlier references
+	pool   []string
+	report PresenceReport
+}
+
+func newPresenceSampler(cfg Presence) *presenceSampler {
+	if cfg.Every <= 0 {
+		cfg.Every = defaultPresenceEvery
+	}
+	return &presenceSampler{every: cfg.Every}
+}
+
+func (p *presenceSampler) uploaded(f io.Writer, c *Client, ref string) {
+	p.uploads++
+	if p.uploads%p.every == 0 {
+		p.check(f, c, ref, false)
+		if len(p.pool) > 0 {
+			p.check(f, c, p.pool[mrand.Intn(len(p.pool))], true)
+		}
+		log(f, "presence checked=", p.report.Checked, " present=", p.report.Present, " presenceRate=", p.report.rate())
+	}
+	// reservoir sampling
+	if len(p.pool) < presencePool {
+		p.pool = append(p.pool, ref)
+	} else if i := mrand.Intn(p.uploads); i < presencePool {
+		p.pool[i] = ref
+	}
+}
+
+func (p *presenceSampler) check(f io.Writer, c *Client, ref string, earlier bool) {
+	present, err := c.hasChunk(rootChunk(ref))
+	if err != nil {
+		p.report.Errors++
+		log(f, "presence check reference=", ref, ": ", err)
+		return
+	}
+	p.report.Checked++
+	if present {
+		p.report.Present++
+		return
+	}
+	log(f, "missing root chunk reference=", ref, " earlier=", earlier)
+}
+
+// rootChunk is the address of the root chunk of a reference, encrypted
+// references append the decryption key.
+func rootChunk(ref string) string {
+	if len(ref) > 64 {
+		return ref[:64]
+	}
+	return ref
+}
+
+// hasChunk reports whether the chunk is stored on the node itself, without
+// retrieving it from the network.
+func (c *Client) hasChunk(addr string) (bool, error) {
+	req, err := http.NewRequest(http.MethodHead, c.apiURL+"/chunks/"+addr, nil)
+	if err != nil {
+		return false, err
+	}
+	res, err := c.http.Do(req)
+	if err != nil {
+		return false, err
+	}
+	res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+	return false, &statusError{code: res.StatusCode}
+}
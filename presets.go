@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// presets are the standard experiments, selected with -preset. Their
+// experiments come without batch ids and buy their batches with the Buy
+// spec.
+var presets = map[string]struct {
+	usage  string
+	config string
+}{
+	"quick-smoke": {
+		"one small upload series on a small batch, to check the setup",
+		`{"experiments":[
+			{"name":"smoke","size":1048576,"maxBytes":20971520,"buy":{"amount":"10000000000","depth":17,"immutable":true}}
+		]}`,
+	},
+	"encrypted-vs-plain": {
+		"fill two batches of the same depth with encrypted and plain uploads",
+		`{"baseline":"plain","experiments":[
+			{"name":"encrypted","encrypt":true,"buy":{"amount":"10000000000","depth":20,"immutable":true}},
+			{"name":"plain","buy":{"amount":"10000000000","depth":20,"immutable":true}}
+		]}`,
+	},
+	"depth-sweep": {
+		"fill batches of depth 17 to 20 to compare the utilization at full",
+		`{"baseline":"depth-20","experiments":[
+			{"name":"depth-17","buy":{"amount":"10000000000","depth":17,"immutable":true}},
+			{"name":"depth-18","buy":{"amount":"10000000000","depth":18,"immutable":true}},
+			{"name":"depth-19","buy":{"amount":"10000000000","depth":19,"immutable":true}},
+			{"name":"depth-20","buy":{"amount":"10000000000","depth":20,"immutable":true}}
+		]}`,
+	},
+	"soak": {
+		"upload forever, buying a new batch whenever one is full, and survive node restarts",
+		`{"experiments":[
+			{"name":"soak","soak":true,"random":"fast","heartbeat":"1m","tolerateRestarts":true,"breaker":{},
+				"buy":{"amount":"10000000000","depth":20,"immutable":true}}
+		]}`,
+	},
+}
+
+func loadPreset(name string) (Config, error) {
+	p, ok := presets[name]
+	if !ok {
+		return Config{}, fmt.Errorf("unknown preset %q, one of %s", name, strings.Join(presetNames(), ", "))
+	}
+	return parseConfig("preset "+name, []byte(p.config))
+}
+
+func presetNames() []string {
+	var names []string
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// cmdPresets lists the presets or prints the config of one, as a starting
+// point for a config file.
+func cmdPresets(args []string) error {
+	fs := newFlagSet("presets", "[name]")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		for _, name := range presetNames() {
+			fmt.Printf("%-20s %s\n", name, presets[name].usage)
+		}
+		return nil
+	}
+	p, ok := presets[fs.Arg(0)]
+	if !ok {
+		return fmt.Errorf("unknown preset %q", fs.Arg(0))
+	}
+	var b bytes.Buffer
+	err := json.Indent(&b, []byte(p.config), "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(b.String())
+	return nil
+}
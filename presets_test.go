@@ -0,0 +1,25 @@
+package main
+
+import "testing"
+
+func TestDepthSweepPresetFills(t *testing.T) {
+	global.out = t.TempDir()
+	cfg, err := loadPreset("depth-sweep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, exp := range cfg.Experiments {
+		// the node holds the batch the preset would buy, stamping every
+		// chunk into one bucket
+		_, c := newFullBee(t, exp.Buy.Depth, 16)
+		capacity := 1 << (exp.Buy.Depth - 16)
+		exp.Buy, exp.BatchID, exp.Size = nil, testBatchID, chunkSize
+		res, err := run(exp, c, make(chan error))
+		if err != nil {
+			t.Fatalf("%s: %v", exp.Name, err)
+		}
+		if full, ok := bytesToFull(res.Samples); !ok || full != capacity*chunkSize {
+			t.Errorf("%s: bytes to full %s, want the %d chunks of the batch", exp.Name, formatBytes(full, ok), capacity)
+		}
+	}
+}
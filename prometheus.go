@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+// experimentMetrics are what /metrics exposes of every experiment, each
+// labeled by experimentLabels so dashboards can filter and split all of
+// them the same way.
+var experimentMetrics = []struct {
+	name, kind, help string
+	value            func(s experimentStatus) float64
+}{
+	{"batchexp_uploads_total", "counter", "Uploads that succeeded.", func(s experimentStatus) float64 { return float64(s.Uploads) }},
+	{"batchexp_upload_failures_total", "counter", "Uploads that failed.", func(s experimentStatus) float64 { return float64(s.Failures) }},
+	{"batchexp_uploaded_bytes_total", "counter", "Bytes uploaded.", func(s experimentStatus) float64 { return float64(s.TotalUploaded) }},
+	{"batchexp_uploaded_chunks_total", "counter", "Chunks uploaded.", func(s experimentStatus) float64 { return float64(s.TotalChunks) }},
+	{"batchexp_bucket_utilization", "gauge", "Chunks in the batch's fullest bucket.", func(s experimentStatus) float64 { return float64(s.Utilization) }},
+	{"batchexp_bucket_capacity", "gauge", "Chunks a bucket of the batch holds.", func(s experimentStatus) float64 { return float64(s.Capacity) }},
+	{"batchexp_running", "gauge", "1 while the experiment runs.", func(s experimentStatus) float64 {
+		if s.StopReason == "" {
+			return 1
+		}
+		return 0
+	}},
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func experimentLabels(s experimentStatus) string {
+	return fmt.Sprintf(`experiment="%s",batch="%s",node="%s",encrypted="%t",deferred="%t"`,
+		labelEscaper.Replace(s.Name), labelEscaper.Replace(s.BatchID), labelEscaper.Replace(s.Node), s.Encrypt, s.Deferred)
+}
+
+// metrics serves the experiments of the board in the Prometheus text
+// format.
+func (b *statusBoard) metrics(w http.ResponseWriter, _ *http.Request) {
+	b.mu.Lock()
+	list := make([]experimentStatus, 0, len(b.experiments))
+	for _, s := range b.experiments {
+		list = append(list, s)
+	}
+	b.mu.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	for _, m := range experimentMetrics {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+		for _, s := range list {
+			fmt.Fprintf(w, "%s{%s} %g\n", m.name, experimentLabels(s), m.value(s))
+		}
+	}
+}
+
+// startMetrics serves /metrics on addr for the lifetime of the process.
+func startMetrics(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", board.metrics)
+	go func() {
+		err := http.ListenAndServe(addr, mux)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "metrics:", err)
+		}
+	}()
+	fmt.Fprintln(console(), "metrics listening on", addr)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// Trojan chunks spend part of the chunk on the nonce, the length prefix and
+// the envelope, so a message has to be smaller than a chunk.
+const pssMaxPayload = chunkSize - 128
+
+type Pss struct {
+	Topic string `json:"topic"`
+	// Targets is the comma separated list of address prefixes the message
+	// is mined for.
+	Targets string `json:"targets"`
+	// Recipient is the public key the message is encrypted for, the node's
+	// own key when empty.
+	Recipient string `json:"recipient"`
+}
+
+// pssUploader sends one PSS message stamped with the batch per iteration
+// instead of uploading content.
+type pssUploader struct {
+	client *Client
+	exp    Experiment
+}
+
+func (u *pssUploader) Payload(size int) ([]byte, error) {
+	return generateFile(size, u.exp.Random)
+}
+
+func (u *pssUploader) Upload(ctx context.Context, payload []byte, _ uint64, _ string) (*uploadResponse, error) {
+	p := u.exp.Pss
+	endpoint := u.client.apiURL + "/pss/send/" + url.PathEscape(p.Topic) + "/" + url.PathEscape(p.Targets)
+	if p.Recipient != "" {
+		endpoint += "?recipient=" + url.QueryEscape(p.Recipient)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Swarm-Postage-Batch-Id", u.exp.BatchID)
+	for k, v := range u.exp.Headers {
+		req.Header.Set(k, v)
+	}
+
+	impair(req, u.exp.Impair)
+	res, err := u.client.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusCreated && res.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(res.Body)
+		return nil, &statusError{code: res.StatusCode, body: string(body)}
+	}
+	return &uploadResponse{}, nil
+}
+
+// Chunks is always one, every message is a single trojan chunk.
+func (u *pssUploader) Chunks(int) int {
+	return 1
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"io"
+	"time"
+)
+
+// Ramp raises the concurrency of an experiment over time, from Start
+// workers by Step every Every up to the experiment's Concurrency, to find
+// the level at which the node starts failing or slowing down. A level is
+// degraded when its mean latency is Degrade times that of the first level.
+type Ramp struct {
+	Start   int      `json:"start"`
+	Step    int      `json:"step"`
+	Every   duration `json:"every"`
+	Degrade float64  `json:"degrade"`
+}
+
+const defaultDegrade = 2
+
+// RampLevel is what was observed at one concurrency level.
+type RampLevel struct {
+	Concurrency int           `json:"concurrency"`
+	Uploads     int           `json:"uploads"`
+	Failures    int           `json:"failures"`
+	Latency     time.Duration `json:"latency"`
+}
+
+type ramp struct {
+	step    int
+	max     int
+	degrade float64
+
+	levels   []RampLevel
+	current  RampLevel
+	total    time.Duration
+	errors   bool
+	degraded bool
+}
+
+func newRamp(r *Ramp, max int) *ramp {
+	rp := &ramp{step: r.Step, max: max, degrade: r.Degrade}
+	rp.current.Concurrency = r.Start
+	if rp.current.Concurrency < 1 {
+		rp.current.Concurrency = 1
+	}
+	if rp.current.Concurrency > max {
+		rp.current.Concurrency = max
+	}
+	if rp.step < 1 {
+		rp.step = 1
+	}
+	if rp.degrade <= 0 {
+		rp.degrade = defaultDegrade
+	}
+	return rp
+}
+
+func (r *ramp) limit() int {
+	return r.current.Concurrency
+}
+
+func (r *ramp) observe(latency time.Duration, failed bool) {
+	if failed {
+		r.current.Failures++
+		return
+	}
+	r.current.Uploads++
+	r.total += latency
+}
+
+// next closes the current level and moves to the next one. ok is false
+// once the ramp is at full concurrency.
+func (r *ramp) next(f io.Writer) (limit int, ok bool) {
+	if r.current.Concurrency >= r.max {
+		return r.max, false
+	}
+	r.close(f)
+	c := r.current.Concurrency + r.step
+	if c > r.max {
+		c = r.max
+	}
+	r.current = RampLevel{Concurrency: c}
+	r.total = 0
+	log(f, "ramp concurrency=", c)
+	return c, true
+}
+
+func (r *ramp) close(f io.Writer) {
+	l := r.current
+	if l.Uploads > 0 {
+		l.Latency = r.total / time.Duration(l.Uploads)
+	}
+	r.levels = append(r.levels, l)
+	log(f, "ramp level concurrency=", l.Concurrency, " uploads=", l.Uploads, " failures=", l.Failures, " latency=", l.Latency.Round(time.Millisecond))
+	if l.Failures > 0 && !r.errors {
+		r.errors = true
+		log(f, "ramp errors began concurrency=", l.Concurrency)
+	}
+	first := r.levels[0].Latency
+	if first > 0 && float64(l.Latency) > r.degrade*float64(first) && !r.degraded {
+		r.degraded = true
+		log(f, "ramp latency degraded concurrency=", l.Concurrency, " latency=", l.Latency.Round(time.Millisecond), " first=", first.Round(time.Millisecond))
+	}
+}
+
+// finish closes the last level and returns all levels.
+func (r *ramp) finish(f io.Writer) []RampLevel {
+	r.close(f)
+	return r.levels
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	defaultReadEvery  = 10
+	defaultReadRecent = 5
+)
+
+// Reader retrieves recent uploads through a second node while the run goes
+// on, to verify the data propagated beyond the uploading node, which for
+// deferred uploads happens only after the upload returned.
+type Reader struct {
+	// API is the reader node's API URL.
+	API string `json:"api"`
+	// Every is the number of uploads between retrievals, 10 by default.
+	Every int `json:"every"`
+	// Recent is how many of the latest references are retrieved each
+	// time, 5 by default.
+	Recent int `json:"recent"`
+	// Timeout bounds each retrieval, 30s by default.
+	Timeout duration `json:"timeout"`
+}
+
+// Retrieval is how the uploads retrieved through the reader node fared.
+type Retrieval struct {
+	Attempts  int `json:"attempts"`
+	Successes int `json:"successes"`
+	// Skipped counts rounds dropped because the previous one was still
+	// retrieving.
+	Skipped     int           `json:"skipped"`
+	MeanLatency time.Duration `json:"meanLatency"`
+	MaxLatency  time.Duration `json:"maxLatency"`
+}
+
+func (r Retrieval) successRate() string {
+	return ratio(int64(r.Successes), int64(r.Attempts))
+}
+
+// retrievalChecker retrieves references through the reader node in the
+// background, so slow retrievals don't hold up the uploads.
+type retrievalChecker struct {
+	cfg     Reader
+	c       *Client
+	f       io.Writer
+	uploads int
+	recent  []string
+	rounds  chan []string
+	wg      sync.WaitGroup
+
+	mu      sync.Mutex
+	report  Retrieval
+	latency time.Duration
+}
+
+func newRetrievalChecker(f io.Writer, cfg Reader) *retrievalChecker {
+	if cfg.Every <= 0 {
+		cfg.Every = defaultReadEvery
+	}
+	if cfg.Recent <= 0 {
+		cfg.Recent = defaultReadRecent
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = duration(defaultRetrievalTimeout)
+	}
+	r := &retrievalChecker{cfg: cfg, c: newClient(cfg.API, cfg.API), f: f, rounds: make(chan []string, 1)}
+	r.wg.Add(1)
+	go r.loop()
+	return r
+}
+
+// uploaded records an upload and starts a round of retrievals when one is
+// due.
+func (r *retrievalChecker) uploaded(ref string) {
+	r.recent = append(r.recent, ref)
+	if len(r.recent) > r.cfg.Recent {
+		r.recent = r.recent[1:]
+	}
+	r.uploads++
+	if r.uploads%r.cfg.Every != 0 {
+		return
+	}
+	select {
+	case r.rounds <- append([]string(nil), r.recent...):
+	default:
+		r.mu.Lock()
+		r.report.Skipped++
+		r.mu.Unlock()
+	}
+}
+
+func (r *retrievalChecker) loop() {
+	defer r.wg.Done()
+	for refs := range r.rounds {
+		ok := 0
+		var slowest time.Duration
+		for _, ref := range refs {
+			ctx, cancel := clock.WithTimeout(context.Background(), time.Duration(r.cfg.Timeout))
+			start := clock.Now()
+			err := r.c.retrieve(ctx, ref)
+			took := since(start)
+			cancel()
+			if err != nil {
+				log(r.f, "retrieval failed reader=", r.cfg.API, " reference=", ref, " error=", err)
+			} else {
+				ok++
+			}
+			if took > slowest {
+				slowest = took
+			}
+			r.mu.Lock()
+			r.report.Attempts++
+			if err == nil {
+				r.report.Successes++
+				r.latency += took
+				if took > r.report.MaxLatency {
+					r.report.MaxLatency = took
+				}
+			}
+			r.mu.Unlock()
+		}
+		log(r.f, "retrieval reader=", r.cfg.API, " retrieved=", ok, "/", len(refs), " slowest=", slowest.Round(time.Millisecond))
+	}
+}
+
+// finish waits for the last round and logs the report.
+func (r *retrievalChecker) finish() *Retrieval {
+	close(r.rounds)
+	r.wg.Wait()
+	if r.report.Successes > 0 {
+		r.report.MeanLatency = r.latency / time.Duration(r.report.Successes)
+	}
+	log(r.f, "retrieval report reader=", r.cfg.API, " attempts=", r.report.Attempts, " successes=", r.report.Successes, " successRate=", r.report.successRate(),
+		" skipped=", r.report.Skipped, " meanLatency=", r.report.MeanLatency.Round(time.Millisecond), " maxLatency=", r.report.MaxLatency.Round(time.Millisecond))
+	return &r.report
+}
@@ -0,0 +1,24 @@
+package main
+
+import "encoding/hex"
+
+// referenceSet remembers the references returned during a run. Payloads
+// are random, so a reference seen twice points at a generation or node bug.
+// Only the content address is kept, decryption keys are left out.
+type referenceSet map[[refSize]byte]struct{}
+
+// add records ref and reports whether it was seen before. References that
+// aren't addresses, like the empty one of PSS messages, are ignored.
+func (s referenceSet) add(ref string) bool {
+	b, err := hex.DecodeString(ref)
+	if err != nil || len(b) < refSize {
+		return false
+	}
+	var addr [refSize]byte
+	copy(addr[:], b)
+	if _, ok := s[addr]; ok {
+		return true
+	}
+	s[addr] = struct{}{}
+	return false
+}
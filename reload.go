@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// reloadInterval is how often serve checks the config file for changes.
+const reloadInterval = 2 * time.Second
+
+// reloads hands config changes and control API patches to the running
+// experiments, by name.
+var reloads = &reloadHub{subs: map[string]chan Experiment{}, running: map[string]Experiment{}}
+
+type reloadHub struct {
+	mu   sync.Mutex
+	subs map[string]chan Experiment
+	// running are the settings the experiments run with, patches apply to
+	// them
+	running map[string]Experiment
+}
+
+// subscribe returns the channel the changed config of the experiment
+// arrives on and a func to unsubscribe.
+func (h *reloadHub) subscribe(exp Experiment) (<-chan Experiment, func()) {
+	ch := make(chan Experiment, 1)
+	h.mu.Lock()
+	h.subs[exp.Name] = ch
+	h.running[exp.Name] = exp
+	h.mu.Unlock()
+	return ch, func() {
+		h.mu.Lock()
+		delete(h.subs, exp.Name)
+		delete(h.running, exp.Name)
+		h.mu.Unlock()
+	}
+}
+
+// applied records the settings a running experiment took.
+func (h *reloadHub) applied(exp Experiment) {
+	h.mu.Lock()
+	if _, ok := h.running[exp.Name]; ok {
+		h.running[exp.Name] = exp
+	}
+	h.mu.Unlock()
+}
+
+// publish hands the experiments of a reloaded config to the running ones,
+// replacing a change they didn't pick up yet.
+func (h *reloadHub) publish(exps []Experiment) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, exp := range exps {
+		h.send(exp)
+	}
+}
+
+// patch applies p to the running experiment name and hands it over, false
+// when no such experiment runs.
+func (h *reloadHub) patch(name string, p controlPatch) (Experiment, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	exp, ok := h.running[name]
+	if !ok {
+		return Experiment{}, false
+	}
+	exp = p.apply(exp)
+	// later patches build on this one
+	h.running[name] = exp
+	h.send(exp)
+	return exp, true
+}
+
+// send replaces the pending change of the experiment. The caller holds mu.
+func (h *reloadHub) send(exp Experiment) {
+	ch, ok := h.subs[exp.Name]
+	if !ok {
+		return
+	}
+	select {
+	case <-ch:
+	default:
+	}
+	ch <- exp
+}
+
+// watchConfig reloads the config file of o whenever it changes and
+// publishes its experiments. A config that fails to load is reported and
+// skipped, the experiments keep their settings.
+func watchConfig(o runOptions) {
+	if o.batches == "-" {
+		// stdin was read once, the running experiments keep their batches
+		o.batches = ""
+	}
+	last := modTime(o.config)
+	for range time.Tick(reloadInterval) {
+		t := modTime(o.config)
+		if t.Equal(last) {
+			continue
+		}
+		last = t
+		cfg, err := o.loadConfig()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "reload config:", err)
+			continue
+		}
+		reloads.publish(cfg.Experiments)
+	}
+}
+
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// reloadTarget is what a reload changes in a running experiment.
+type reloadTarget struct {
+	uploads *pipeline
+	poller  *stampPoller
+	// adaptive is set when backpressure or a ramp owns the concurrency
+	adaptive bool
+}
+
+// applyReload takes the safe settings of next into exp: the concurrency,
+// the rate, the payload size, the polling and the stop thresholds. Every
+// applied change is logged, other changes need a restart and are logged as
+// ignored.
+func applyReload(f io.Writer, exp Experiment, next Experiment, t reloadTarget) Experiment {
+	if next.Concurrency != exp.Concurrency {
+		limit := next.Concurrency
+		if limit < 1 {
+			limit = 1
+		}
+		switch {
+		case t.adaptive:
+			log(f, "reload ignored concurrency=", next.Concurrency, ", backpressure or ramp sets it")
+		case exp.InFlight > 0:
+			log(f, "reload ignored concurrency=", next.Concurrency, ", inFlight bounds the uploads")
+		case limit > t.uploads.workers:
+			log(f, "reload ignored concurrency=", next.Concurrency, ", the run started ", t.uploads.workers, " workers")
+		default:
+			t.uploads.throttle(limit, 0)
+			log(f, "reload concurrency=", exp.Concurrency, "->", next.Concurrency)
+			exp.Concurrency = next.Concurrency
+		}
+	}
+	if next.Rate != exp.Rate {
+		t.uploads.setRate(next.Rate)
+		log(f, "reload rate=", exp.Rate, "->", next.Rate)
+		exp.Rate = next.Rate
+	}
+	if next.Size != exp.Size {
+		switch {
+		case len(exp.Mix) > 0 || len(exp.Sweep) > 0 || exp.Repeat > 0 || exp.Trace != nil || exp.Source != nil:
+			log(f, "reload ignored size=", next.Size, ", the payloads don't come from size")
+		case exp.AdaptiveSize != nil:
+			log(f, "reload ignored size=", next.Size, ", adaptiveSize sets it")
+		case next.Size <= 0:
+			log(f, "reload ignored size=", next.Size)
+		default:
+			size := alignSize(next.Size, exp.Align, exp.Encrypt)
+			t.uploads.setSize(size)
+			log(f, "reload size=", exp.Size, "->", size)
+			exp.Size = size
+		}
+	}
+	if !reflect.DeepEqual(next.Poll, exp.Poll) {
+		var poll Poll
+		if next.Poll != nil {
+			poll = *next.Poll
+		}
+		t.poller.setPoll(poll)
+		log(f, "reload poll uploads=", poll.Uploads, " interval=", time.Duration(poll.Interval))
+		exp.Poll = next.Poll
+	}
+	if next.MaxBytes != exp.MaxBytes {
+		log(f, "reload maxBytes=", exp.MaxBytes, "->", next.MaxBytes)
+		exp.MaxBytes = next.MaxBytes
+	}
+	if next.StopAt != exp.StopAt {
+		log(f, "reload stopAt=", exp.StopAt, "->", next.StopAt)
+		exp.StopAt = next.StopAt
+	}
+
+	rest := next
+	if rest.BatchID == "" {
+		// bought by the tool
+		rest.BatchID = exp.BatchID
+	}
+	rest.Concurrency, rest.Rate, rest.Size, rest.Poll, rest.MaxBytes, rest.StopAt = exp.Concurrency, exp.Rate, exp.Size, exp.Poll, exp.MaxBytes, exp.StopAt
+	if !reflect.DeepEqual(rest, exp) {
+		log(f, "reload ignored changes that need a restart")
+	}
+	return exp
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"syscall"
+	"time"
+)
+
+const (
+	minReconnectWait = time.Second
+	maxReconnectWait = 30 * time.Second
+)
+
+// isConnError reports whether err could come from a node going away: the
+// connection was refused or dropped.
+func isConnError(err error) bool {
+	return errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// nodeDown reports whether a connection error means the node is down,
+// which it does when the node doesn't answer its health check either.
+func nodeDown(c *Client, err error) bool {
+	if !isConnError(err) {
+		return false
+	}
+	_, herr := c.getHealth(c.debugURL)
+	return herr != nil
+}
+
+// waitRestart waits with backoff for a restarting node to come back, then
+// polls the batch again and logs the outage and whether the utilization
+// survived the restart. stopped is set when the run was stopped meanwhile.
+func waitRestart(f io.Writer, c *Client, stop <-chan error, before *Batch) (batch *Batch, stopped bool, err error) {
+	log(f, "node unreachable, waiting for it to restart")
+	down := clock.Now()
+	wait := minReconnectWait
+	for {
+		select {
+		case v := <-stop:
+			log(f, "stopping", v)
+			return nil, true, nil
+		case <-clock.After(wait):
+		}
+		_, err = c.getHealth(c.debugURL)
+		if err == nil {
+			break
+		}
+		log(f, "reconnect: ", err, " retryIn=", wait)
+		systemd.alive()
+		wait *= 2
+		if wait > maxReconnectWait {
+			wait = maxReconnectWait
+		}
+	}
+	batch, err = c.getStamp(before.BatchID)
+	if err != nil {
+		return nil, false, err
+	}
+	log(f, "restart outage=", since(down).Round(time.Second), " utilizationBefore=", before.Utilization, " utilizationAfter=", batch.Utilization,
+		" survived=", batch.Utilization >= before.Utilization, " usable=", batch.Usable)
+	return batch, false, nil
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+const (
+	stopFull    = "full"
+	stopExpired = "expired"
+	stopStopped = "stopped"
+	stopError   = "error"
+	// stopDone ends runs with a fixed number of uploads.
+	stopDone = "done"
+	// stopMaxBytes ends runs that uploaded their byte limit.
+	stopMaxBytes = "maxBytes"
+	// stopTarget ends runs that filled the batch to their stop-at share.
+	stopTarget = "target"
+	// stopSkipped marks experiments whose dependencies didn't end as
+	// required.
+	stopSkipped = "skipped"
+)
+
+// Result is everything recorded about one experiment run. It is written next
+// to the experiment log as <name>.json.
+type Result struct {
+	Experiment Experiment `json:"experiment"`
+	Start      time.Time  `json:"start"`
+	End        time.Time  `json:"end"`
+	StopReason string     `json:"stopReason"`
+	Error      string     `json:"error,omitempty"`
+	Uploads    int        `json:"uploads"`
+	Failures   int        `json:"failures"`
+	Node       *NodeInfo  `json:"node"`
+	// API is the URL of the node's API the run uploaded to.
+	API string `json:"api,omitempty"`
+	// Duplicates counts uploads that returned an already seen reference.
+	Duplicates int `json:"duplicates"`
+	// StatusCodes counts the node's responses during the run by status
+	// code, "error" for requests that got none.
+	StatusCodes map[string]int `json:"statusCodes,omitempty"`
+	// Connections counts the connections of the experiment's own client.
+	Connections *ConnStats `json:"connections,omitempty"`
+	// EncryptedUploads counts the encrypted uploads of a MixEncrypt run.
+	EncryptedUploads int `json:"encryptedUploads,omitempty"`
+	// InFlight is the node's throughput at the numbers of uploads in
+	// flight the run went through.
+	InFlight *InFlightReport `json:"inFlight,omitempty"`
+	// AdaptedSize is the payload size an adaptiveSize run ended at.
+	AdaptedSize int `json:"adaptedSize,omitempty"`
+	// Ramp are the concurrency levels of a ramped run.
+	Ramp []RampLevel `json:"ramp,omitempty"`
+	// Generations are the batches a soak run filled, the current one is
+	// not included.
+	Generations []Generation `json:"generations,omitempty"`
+	// Overflow is how the node answered uploads into the full batch.
+	Overflow *Overflow `json:"overflow,omitempty"`
+	// Dilutions are the automatic dilutions of the batch.
+	Dilutions []Dilution `json:"dilutions,omitempty"`
+	// Overwritten is what uploads into the full mutable batch overwrote.
+	Overwritten *OverwriteReport `json:"overwritten,omitempty"`
+	// Alerts are the fill thresholds the fullest bucket crossed.
+	Alerts []Alert `json:"alerts,omitempty"`
+	// Sweep is what each payload size of a sweep consumed.
+	Sweep []SweepClass `json:"sweep,omitempty"`
+	// Retrieval is how the uploads fared retrieved through the reader
+	// node.
+	Retrieval *Retrieval `json:"retrieval,omitempty"`
+	// Presence counts the sampled root chunks found on the node.
+	Presence *PresenceReport `json:"presence,omitempty"`
+	// Canceled are the uploads canceled on purpose and what they stamped.
+	Canceled *CancelReport `json:"canceled,omitempty"`
+	// Eviction is how the reserve and the earliest uploads fared past the
+	// reserve capacity.
+	Eviction *EvictionReport `json:"eviction,omitempty"`
+	// Steps are the bytes uploaded between the utilization levels.
+	Steps []UtilizationStep `json:"steps,omitempty"`
+	// Timing is the mean timing breakdown of the uploads.
+	Timing *Timing `json:"timing,omitempty"`
+
+	// err is the error that ended the run, for the exit code
+	err error
+	// Batch is the batch as it was when uploads started.
+	Batch   *Batch   `json:"batch"`
+	Samples []Sample `json:"samples"`
+	// StampsStart and StampsEnd are all batches of the node when the run
+	// started and ended, to spot side effects on other batches.
+	StampsStart []Batch `json:"stampsStart"`
+	StampsEnd   []Batch `json:"stampsEnd"`
+}
+
+func writeResult(path string, r *Result) error {
+	// keep the owner key out of result files, they get shared
+	r.Experiment.OwnerKey = ""
+	if src := r.Experiment.Source; src != nil && src.S3 != nil {
+		s3 := *src.S3
+		s3.SecretKey, s3.SessionToken = "", ""
+		r.Experiment.Source = &Source{S3: &s3}
+	}
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	if isGzip(path) {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		_, _ = zw.Write(b)
+		err = zw.Close()
+		if err != nil {
+			return err
+		}
+		b = buf.Bytes()
+	}
+	return os.WriteFile(path, b, 0666)
+}
+
+func loadResult(path string) (*Result, error) {
+	f, err := openInput(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	b, err := io.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	var r Result
+	err = json.Unmarshal(b, &r)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return &r, nil
+}
+
+func (r *Result) totalUploaded() int {
+	if len(r.Samples) == 0 {
+		return 0
+	}
+	return r.Samples[len(r.Samples)-1].Bytes
+}
+
+// fullSample is the first sample at which the batch was full. Samples of
+// results written before they recorded the capacity count against the
+// batch the run started with.
+func (r *Result) fullSample() (Sample, bool) {
+	if r.Batch == nil || r.Batch.Depth == 0 {
+		return fullSample(r.Samples)
+	}
+	samples := make([]Sample, len(r.Samples))
+	for i, s := range r.Samples {
+		if s.Capacity == 0 {
+			s.Capacity = r.Batch.capacity()
+		}
+		samples[i] = s
+	}
+	return fullSample(samples)
+}
+
+func (r *Result) bytesToFull() (int, bool) {
+	s, ok := r.fullSample()
+	return s.Bytes, ok
+}
+
+func (r *Result) chunksToFull() (int, bool) {
+	s, ok := r.fullSample()
+	return s.Chunks, ok
+}
+
+// throughput is the upload rate in bytes per second over the whole run.
+func (r *Result) throughput() float64 {
+	d := r.End.Sub(r.Start).Seconds()
+	if d <= 0 {
+		return 0
+	}
+	return float64(r.totalUploaded()) / d
+}
+
+func (r *Result) duplicateRate() float64 {
+	if r.Uploads == 0 {
+		return 0
+	}
+	return float64(r.Duplicates) / float64(r.Uploads)
+}
+
+func (r *Result) errorRate() float64 {
+	n := r.Uploads + r.Failures
+	if n == 0 {
+		return 0
+	}
+	return float64(r.Failures) / float64(n)
+}
+
+// latencyPercentile returns the p-th percentile (0-100) of the upload
+// latencies.
+func (r *Result) latencyPercentile(p float64) time.Duration {
+	if len(r.Samples) == 0 {
+		return 0
+	}
+	l := make([]time.Duration, len(r.Samples))
+	for i, s := range r.Samples {
+		l[i] = s.Latency
+	}
+	sort.Slice(l, func(i, j int) bool { return l[i] < l[j] })
+	i := int(p / 100 * float64(len(l)-1))
+	return l[i]
+}
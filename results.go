@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// ways to aggregate the records of the results command
+const (
+	groupVersion = "version"
+	groupNode    = "node"
+	groupDepth   = "depth"
+)
+
+// recordFilter selects records of the results database, zero fields match
+// every record.
+type recordFilter struct {
+	// node matches the API URL or the overlay prefix
+	node         string
+	since, until time.Time
+	encrypt      *bool
+	depth        int
+}
+
+func (f recordFilter) match(r Record) bool {
+	switch {
+	case f.node != "" && r.Node != f.node && (r.Overlay == "" || !strings.HasPrefix(r.Overlay, f.node)):
+		return false
+	case !f.since.IsZero() && r.Time.Before(f.since):
+		return false
+	case !f.until.IsZero() && !r.Time.Before(f.until):
+		return false
+	case f.encrypt != nil && r.Encrypt != *f.encrypt:
+		return false
+	case f.depth != 0 && r.Depth != f.depth:
+		return false
+	}
+	return true
+}
+
+// parseDay parses an RFC 3339 time or a day. A day ending a range
+// includes the whole day.
+func parseDay(s string, end bool) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, s)
+	if err == nil {
+		return t, nil
+	}
+	t, err = time.Parse("2006-01-02", s)
+	if err != nil {
+		return t, fmt.Errorf("invalid time %q, want 2006-01-02 or RFC 3339", s)
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// recordGroup aggregates the records of one version, node or depth.
+type recordGroup struct {
+	key     string
+	version version
+	runs    int
+	full    int
+	// sums over the full runs
+	bytesToFull int
+	fill        float64
+}
+
+func (g *recordGroup) add(r Record) {
+	g.runs++
+	if r.BytesToFull > 0 {
+		g.full++
+		g.bytesToFull += r.BytesToFull
+		g.fill += r.fillRatio()
+	}
+}
+
+func (g *recordGroup) meanBytesToFull() float64 {
+	if g.full == 0 {
+		return 0
+	}
+	return float64(g.bytesToFull) / float64(g.full)
+}
+
+func (g *recordGroup) meanFill() float64 {
+	if g.full == 0 {
+		return 0
+	}
+	return g.fill / float64(g.full)
+}
+
+// groupRecords aggregates the records by group, in version order for
+// versions and key order otherwise.
+func groupRecords(records []Record, group string) []*recordGroup {
+	groups := map[string]*recordGroup{}
+	var all []*recordGroup
+	for _, r := range records {
+		var key string
+		var v version
+		switch group {
+		case groupVersion:
+			key = r.BeeVersion
+			if parsed, err := parseVersion(r.BeeVersion); err == nil {
+				v, key = parsed, parsed.String()
+			}
+		case groupNode:
+			key = r.Node
+		case groupDepth:
+			key = strconv.Itoa(r.Depth)
+		}
+		g, ok := groups[key]
+		if !ok {
+			g = &recordGroup{key: key, version: v}
+			groups[key] = g
+			all = append(all, g)
+		}
+		g.add(r)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		switch group {
+		case groupVersion:
+			if all[i].version != all[j].version {
+				return all[i].version.less(all[j].version)
+			}
+		case groupDepth:
+			a, _ := strconv.Atoi(all[i].key)
+			b, _ := strconv.Atoi(all[j].key)
+			return a < b
+		}
+		return all[i].key < all[j].key
+	})
+	return all
+}
+
+func formatMeanBytes(v float64) string {
+	if v == 0 {
+		return "-"
+	}
+	return prettyByteSize(int(v))
+}
+
+func cmdResults(args []string) error {
+	fs := newFlagSet("results", "[flags]")
+	var filter recordFilter
+	fs.StringVar(&filter.node, "node", "", "only runs on this API URL or overlay prefix")
+	since := fs.String("since", "", "only runs that ended at or after this day or time")
+	until := fs.String("until", "", "only runs that ended before the end of this day or this time")
+	encrypt := fs.String("encrypt", "", "only encrypted (true) or plain (false) runs")
+	fs.IntVar(&filter.depth, "depth", 0, "only runs on batches of this depth")
+	group := fs.String("group", "", "aggregate by version, for the trend over Bee versions, node or depth instead of listing the runs")
+	fs.Parse(args)
+	if global.resultsDB == "" {
+		fs.Usage()
+		return withExitCode(exitUsage, fmt.Errorf("need the -results-db to query"))
+	}
+	var err error
+	if *since != "" {
+		filter.since, err = parseDay(*since, false)
+		if err != nil {
+			return withExitCode(exitUsage, fmt.Errorf("-since: %w", err))
+		}
+	}
+	if *until != "" {
+		filter.until, err = parseDay(*until, true)
+		if err != nil {
+			return withExitCode(exitUsage, fmt.Errorf("-until: %w", err))
+		}
+	}
+	if *encrypt != "" {
+		b, err := strconv.ParseBool(*encrypt)
+		if err != nil {
+			return withExitCode(exitUsage, fmt.Errorf("-encrypt: want true or false"))
+		}
+		filter.encrypt = &b
+	}
+	switch *group {
+	case "", groupVersion, groupNode, groupDepth:
+	default:
+		return withExitCode(exitUsage, fmt.Errorf("-group: unknown %q, want %s, %s or %s", *group, groupVersion, groupNode, groupDepth))
+	}
+
+	records, err := loadRecords(global.resultsDB)
+	if err != nil {
+		return fmt.Errorf("results db: %w", err)
+	}
+	var matched []Record
+	for _, r := range records {
+		if filter.match(r) {
+			matched = append(matched, r)
+		}
+	}
+	sort.SliceStable(matched, func(i, j int) bool { return matched[i].Time.Before(matched[j].Time) })
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if *group != "" {
+		fmt.Fprintf(tw, "%s\tRUNS\tFULL\tMEAN BYTES TO FULL\tMEAN FILL\tCHANGE\n", strings.ToUpper(*group))
+		var prev float64
+		for _, g := range groupRecords(matched, *group) {
+			change := "-"
+			// the trend is how bytes to full moved from one group to the next
+			if mean := g.meanBytesToFull(); mean > 0 {
+				if prev > 0 {
+					change = fmt.Sprintf("%+.2f%%", relDiff(prev, mean)*100)
+				}
+				prev = mean
+			}
+			fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t%.3f\t%s\n", g.key, g.runs, g.full, formatMeanBytes(g.meanBytesToFull()), g.meanFill(), change)
+		}
+		return tw.Flush()
+	}
+	fmt.Fprintln(tw, "TIME\tEXPERIMENT\tNODE\tVERSION\tDEPTH\tENCRYPT\tSTOP\tBYTES\tBYTES TO FULL\tFILL")
+	total := recordGroup{}
+	for _, r := range matched {
+		total.add(r)
+		toFull := "-"
+		if r.BytesToFull > 0 {
+			toFull = prettyByteSize(r.BytesToFull)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%t\t%s\t%s\t%s\t%.3f\n", r.Time.Format(time.RFC3339), r.Experiment, r.Node, r.BeeVersion,
+			r.Depth, r.Encrypt, r.StopReason, prettyByteSize(r.Bytes), toFull, r.fillRatio())
+	}
+	err = tw.Flush()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stdout, "runs=%d full=%d meanBytesToFull=%s meanFill=%.3f\n", total.runs, total.full, formatMeanBytes(total.meanBytesToFull()), total.meanFill())
+	return nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import "testing"
+
+func TestGroupRecordsByDepth(t *testing.T) {
+	diluted := filledResult("a", 20, true)
+	diluted.Batch.Depth = 19
+	unfinished := filledResult("a", 18, true)
+	unfinished.Samples = unfinished.Samples[:3]
+	var records []Record
+	for _, r := range []*Result{filledResult("a", 18, true), filledResult("a", 18, false), unfinished, filledResult("a", 19, true), diluted} {
+		records = append(records, recordOf(r))
+	}
+	tests := []struct {
+		key         string
+		runs, full  int
+		bytesToFull float64
+	}{
+		{"18", 3, 2, 4 * chunkSize},
+		{"19", 1, 1, 8 * chunkSize},
+		// the diluted run counts at the depth it filled up at
+		{"20", 1, 1, 16 * chunkSize},
+	}
+	groups := groupRecords(records, groupDepth)
+	if len(groups) != len(tests) {
+		t.Fatalf("%d groups, want %d", len(groups), len(tests))
+	}
+	for i, tt := range tests {
+		g := groups[i]
+		if g.key != tt.key || g.runs != tt.runs || g.full != tt.full || g.meanBytesToFull() != tt.bytesToFull {
+			t.Errorf("group %s: %d runs, %d full, mean bytes to full %v, want group %s with %d, %d and %v", g.key, g.runs, g.full, g.meanBytesToFull(), tt.key, tt.runs, tt.full, tt.bytesToFull)
+		}
+		if want := tt.bytesToFull / chunkSize / float64(uint64(1)<<uint(18+i)); g.meanFill() != want {
+			t.Errorf("group %s: mean fill %v, want %v", g.key, g.meanFill(), want)
+		}
+	}
+}
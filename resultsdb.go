@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"math/bits"
+	"os"
+	"sync"
+	"time"
+)
+
+// Record is the line of one run in the results database, the JSONL file of
+// -results-db that every run appends to.
+type Record struct {
+	Time       time.Time `json:"time"`
+	Experiment string    `json:"experiment"`
+	// Node is the API URL the run uploaded to.
+	Node            string `json:"node"`
+	Overlay         string `json:"overlay,omitempty"`
+	BeeVersion      string `json:"beeVersion,omitempty"`
+	BatchID         string `json:"batchID"`
+	Depth           int    `json:"depth"`
+	BucketDepth     int    `json:"bucketDepth"`
+	Workload        string `json:"workload"`
+	Size            int    `json:"size"`
+	Encrypt         bool   `json:"encrypt"`
+	Deferred        bool   `json:"deferred"`
+	RedundancyLevel int    `json:"redundancyLevel"`
+	StopReason      string `json:"stopReason"`
+	Bytes           int    `json:"bytes"`
+	Chunks          int    `json:"chunks"`
+	Utilization     int    `json:"utilization"`
+	// BytesToFull and ChunksToFull are 0 when the batch didn't fill up.
+	BytesToFull  int `json:"bytesToFull"`
+	ChunksToFull int `json:"chunksToFull"`
+}
+
+// recordOf is the database record of a run.
+func recordOf(r *Result) Record {
+	rec := Record{
+		Time:            r.End,
+		Experiment:      r.Experiment.Name,
+		Node:            r.API,
+		BatchID:         r.Experiment.BatchID,
+		Workload:        r.Experiment.Workload,
+		Size:            r.Experiment.Size,
+		Encrypt:         r.Experiment.Encrypt,
+		Deferred:        r.Experiment.Deferred,
+		RedundancyLevel: r.Experiment.RedundancyLevel,
+		StopReason:      r.StopReason,
+	}
+	if r.Node != nil {
+		rec.Overlay, rec.BeeVersion = r.Node.Overlay, r.Node.Version
+	}
+	if r.Batch != nil {
+		rec.BatchID, rec.Depth, rec.BucketDepth = r.Batch.BatchID, r.Batch.Depth, r.Batch.BucketDepth
+	}
+	if len(r.Samples) > 0 {
+		last := r.Samples[len(r.Samples)-1]
+		rec.Bytes, rec.Chunks, rec.Utilization = last.Bytes, last.Chunks, last.Utilization
+	}
+	if s, ok := r.fullSample(); ok {
+		rec.BytesToFull, rec.ChunksToFull = s.Bytes, s.Chunks
+		// the depth the batch filled up at, deeper than the one the run
+		// started with after dilutions
+		if s.Capacity > 0 && rec.BucketDepth > 0 {
+			rec.Depth = rec.BucketDepth + bits.Len(uint(s.Capacity)) - 1
+		}
+	}
+	return rec
+}
+
+// fillRatio is the share of the batch's 2^depth chunks the run stamped
+// before a bucket was full, 0 when the batch didn't fill up.
+func (r Record) fillRatio() float64 {
+	if r.ChunksToFull == 0 || r.Depth == 0 {
+		return 0
+	}
+	return float64(r.ChunksToFull) / float64(uint64(1)<<uint(r.Depth))
+}
+
+// resultsDBMu serializes the appends of experiments ending together.
+var resultsDBMu sync.Mutex
+
+func appendRecord(path string, rec Record) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	resultsDBMu.Lock()
+	defer resultsDBMu.Unlock()
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(b, '\n'))
+	cerr := f.Close()
+	if err != nil {
+		return err
+	}
+	return cerr
+}
+
+func loadRecords(path string) ([]Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var records []Record
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; sc.Scan(); line++ {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var rec Record
+		err = json.Unmarshal(sc.Bytes(), &rec)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		records = append(records, rec)
+	}
+	return records, sc.Err()
+}
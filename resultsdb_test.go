@@ -0,0 +1,31 @@
+package main
+
+import "testing"
+
+func TestRecordOf(t *testing.T) {
+	// diluted started at depth 19 and filled up at 20
+	diluted := filledResult("a", 20, true)
+	diluted.Batch.Depth = 19
+	unfinished := filledResult("a", 18, true)
+	unfinished.Samples = unfinished.Samples[:3]
+	tests := []struct {
+		name                string
+		result              *Result
+		depth, chunksToFull int
+	}{
+		{"depth 18", filledResult("a", 18, true), 18, 4},
+		{"depth 18 without capacities", filledResult("a", 18, false), 18, 4},
+		{"depth 22", filledResult("a", 22, true), 22, 64},
+		{"diluted", diluted, 20, 16},
+		{"not full", unfinished, 18, 0},
+	}
+	for _, tt := range tests {
+		rec := recordOf(tt.result)
+		if rec.Depth != tt.depth || rec.ChunksToFull != tt.chunksToFull || rec.BytesToFull != tt.chunksToFull*chunkSize {
+			t.Errorf("%s: depth %d, %d chunks and %d bytes to full, want depth %d and %d chunks", tt.name, rec.Depth, rec.ChunksToFull, rec.BytesToFull, tt.depth, tt.chunksToFull)
+		}
+		if want := float64(tt.chunksToFull) / float64(uint64(1)<<uint(tt.depth)); rec.fillRatio() != want {
+			t.Errorf("%s: fill ratio %v, want %v", tt.name, rec.fillRatio(), want)
+		}
+	}
+}
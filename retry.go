@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultRetryAttempts = 3
+	defaultRetryBackoff  = time.Second
+
+	// what happens when the retries of an operation are used up: end the
+	// run or count the failure and go on, the experiment's OnError by
+	// default
+	exhaustedAbort = "abort"
+	exhaustedSkip  = "skip"
+)
+
+// Retry retries the node requests of an operation that failed with a
+// connection error, a timeout, 429 or 5xx before giving up on them.
+type Retry struct {
+	Upload *RetryPolicy `json:"upload"`
+	// Stamp are the batch polls, a poll that gives up and is skipped
+	// leaves the last batch state.
+	Stamp *RetryPolicy `json:"stamp"`
+	// Tag creates and reads the tags of the uploads.
+	Tag *RetryPolicy `json:"tag"`
+}
+
+type RetryPolicy struct {
+	// Attempts counts the first try, 3 by default.
+	Attempts int `json:"attempts"`
+	// MaxTime caps the time spent on the operation including the waits,
+	// no cap when 0.
+	MaxTime duration `json:"maxTime"`
+	// Backoff is the wait before the first retry, doubled for every next
+	// one, 1s by default.
+	Backoff duration `json:"backoff"`
+	// OnExhausted is "abort" or "skip", the experiment's OnError when
+	// empty.
+	OnExhausted string `json:"onExhausted"`
+}
+
+func (r *Retry) validate() error {
+	for name, p := range map[string]*RetryPolicy{"upload": r.Upload, "stamp": r.Stamp, "tag": r.Tag} {
+		if p == nil {
+			continue
+		}
+		switch {
+		case p.Attempts < 0 || p.MaxTime < 0 || p.Backoff < 0:
+			return fmt.Errorf("%s: negative attempts, maxTime or backoff", name)
+		case p.OnExhausted != "" && p.OnExhausted != exhaustedAbort && p.OnExhausted != exhaustedSkip:
+			return fmt.Errorf("%s: unknown onExhausted %q, want %q or %q", name, p.OnExhausted, exhaustedAbort, exhaustedSkip)
+		}
+	}
+	return nil
+}
+
+func (r *Retry) upload() *RetryPolicy {
+	if r == nil {
+		return nil
+	}
+	return r.Upload
+}
+
+func (r *Retry) stamp() *RetryPolicy {
+	if r == nil {
+		return nil
+	}
+	return r.Stamp
+}
+
+func (r *Retry) tag() *RetryPolicy {
+	if r == nil {
+		return nil
+	}
+	return r.Tag
+}
+
+// retryExhausted is the error of an operation that failed every attempt
+// the policy allowed.
+type retryExhausted struct {
+	op          string
+	attempts    int
+	onExhausted string
+	err         error
+}
+
+func (e *retryExhausted) Error() string {
+	return fmt.Sprintf("%s gave up after %d attempts: %v", e.op, e.attempts, e.err)
+}
+
+func (e *retryExhausted) Unwrap() error {
+	return e.err
+}
+
+// keepGoingAfter tells whether the run goes on after err, the give-up
+// policy of an exhausted retry overrides the experiment's OnError.
+func keepGoingAfter(keepGoing bool, err error) bool {
+	var e *retryExhausted
+	if errors.As(err, &e) {
+		switch e.onExhausted {
+		case exhaustedAbort:
+			return false
+		case exhaustedSkip:
+			return true
+		}
+	}
+	return keepGoing
+}
+
+func retryable(err error) bool {
+	var ne net.Error
+	if isConnError(err) || (errors.As(err, &ne) && ne.Timeout()) {
+		return true
+	}
+	code := statusCode(err)
+	return code == http.StatusTooManyRequests || code >= 500
+}
+
+// do runs fn until it succeeds, fails for good or the policy gives up,
+// logging every retry to f. A nil policy tries once.
+func (p *RetryPolicy) do(ctx context.Context, f io.Writer, op string, fn func() error) error {
+	err := fn()
+	if p == nil || err == nil {
+		return err
+	}
+	attempts := p.Attempts
+	if attempts == 0 {
+		attempts = defaultRetryAttempts
+	}
+	wait := time.Duration(p.Backoff)
+	if wait == 0 {
+		wait = defaultRetryBackoff
+	}
+	start := clock.Now()
+	for attempt := 1; ; attempt++ {
+		if ctx.Err() != nil || !retryable(err) {
+			return err
+		}
+		if attempt >= attempts || (p.MaxTime > 0 && since(start)+wait > time.Duration(p.MaxTime)) {
+			return &retryExhausted{op: op, attempts: attempt, onExhausted: p.OnExhausted, err: err}
+		}
+		log(f, "retry ", op, " attempt=", attempt+1, " wait=", wait, ": ", err)
+		select {
+		case <-clock.After(wait):
+		case <-ctx.Done():
+			return err
+		}
+		wait *= 2
+		err = fn()
+		if err == nil {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fullBee is a Bee node with one immutable batch that stamps every data
+// chunk into the same bucket, so it fills after capacity chunks and
+// rejects the uploads past that the way Bee does, with 402.
+type fullBee struct {
+	mu      sync.Mutex
+	batch   Batch
+	uploads int
+}
+
+func newFullBee(t *testing.T, depth, bucketDepth int) (*fullBee, *Client) {
+	b := &fullBee{batch: Batch{BatchID: testBatchID, Usable: true, Depth: depth, BucketDepth: bucketDepth, Immutable: true, Amount: "1000", TTL: 3600}}
+	node := httptest.NewServer(b)
+	t.Cleanup(node.Close)
+	return b, newClient(node.URL, node.URL)
+}
+
+func (b *fullBee) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	reply := func(code int, v interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(v)
+	}
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/stamps/"+testBatchID:
+		reply(http.StatusOK, b.batch)
+	case r.Method == http.MethodPatch && strings.HasPrefix(r.URL.Path, "/stamps/dilute/"+testBatchID+"/"):
+		b.batch.Depth, _ = strconv.Atoi(path.Base(r.URL.Path))
+		reply(http.StatusAccepted, map[string]string{"batchID": testBatchID})
+	case r.Method == http.MethodPost && r.URL.Path == "/tags":
+		reply(http.StatusCreated, Tag{UID: 1})
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/tags/"):
+		reply(http.StatusOK, Tag{UID: 1})
+	case r.Method == http.MethodPost && r.URL.Path == "/bytes":
+		n, _ := io.Copy(io.Discard, r.Body)
+		chunks := int(n+chunkSize-1) / chunkSize
+		if b.batch.Utilization+chunks > b.batch.capacity() {
+			reply(http.StatusPaymentRequired, map[string]interface{}{"code": 402, "message": "batch is overissued"})
+			return
+		}
+		b.uploads++
+		b.batch.Utilization += chunks
+		reply(http.StatusCreated, uploadResponse{Reference: fmt.Sprintf("%064x", b.uploads)})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestRunStopsFullUnderDefaultPolling(t *testing.T) {
+	global.out = t.TempDir()
+	tests := []struct {
+		name string
+		exp  Experiment
+		// overflow is the attempts captured, firstRejected that the first
+		// of them came after the batch filled up
+		overflow      int
+		firstRejected bool
+	}{
+		// the pipeline sends the next upload before the run sees the
+		// batch fill up, the rejection mustn't end the run in an error
+		{"sequential", Experiment{Concurrency: 1}, 0, false},
+		{"overflow", Experiment{Concurrency: 1, Overflow: 3}, 3, true},
+		{"concurrent", Experiment{Concurrency: 4}, 0, false},
+		{"concurrent overflow", Experiment{Concurrency: 4, Overflow: 2}, 2, false},
+		// polls an hour apart never see the batch fill up, only the
+		// rejection tells
+		{"interval", Experiment{Concurrency: 1, Poll: &Poll{Interval: duration(3600e9)}}, 0, false},
+		{"interval overflow", Experiment{Concurrency: 1, Overflow: 2, Poll: &Poll{Interval: duration(3600e9)}}, 2, true},
+	}
+	for _, tt := range tests {
+		bee, c := newFullBee(t, 19, 16)
+		exp := tt.exp
+		exp.Name, exp.BatchID, exp.Workload, exp.Size = strings.ReplaceAll(tt.name, " ", "-"), testBatchID, workloadBytes, chunkSize
+		res, err := run(exp, c, make(chan error))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if res.StopReason != stopFull {
+			t.Errorf("%s: stop reason %q, want %q", tt.name, res.StopReason, stopFull)
+		}
+		bee.mu.Lock()
+		uploads := bee.uploads
+		bee.mu.Unlock()
+		if uploads != 8 {
+			t.Errorf("%s: %d uploads accepted, want the 8 of a full batch", tt.name, uploads)
+		}
+		// only sequential uploads polled one by one pin the full sample
+		if chunks, ok := chunksToFull(res.Samples); exp.Concurrency == 1 && exp.Poll == nil && (!ok || chunks != 8) {
+			t.Errorf("%s: chunks to full %d, %v, want the 8 of a full batch", tt.name, chunks, ok)
+		}
+		switch {
+		case tt.overflow == 0 && res.Overflow != nil:
+			t.Errorf("%s: captured an overflow", tt.name)
+		case tt.overflow > 0 && (res.Overflow == nil || len(res.Overflow.Events) != tt.overflow):
+			t.Errorf("%s: overflow %+v, want %d attempts", tt.name, res.Overflow, tt.overflow)
+		case tt.firstRejected && (res.Overflow.FirstFailure != 1 || res.Overflow.Events[0].Status != http.StatusPaymentRequired):
+			t.Errorf("%s: overflow %+v, want the first attempt rejected with 402", tt.name, res.Overflow)
+		}
+	}
+}
+
+func TestRunSweepCreditsTheUpload(t *testing.T) {
+	global.out = t.TempDir()
+	for _, poll := range []*Poll{nil, {Uploads: 3}, {Interval: duration(3600e9)}} {
+		_, c := newFullBee(t, 26, 16)
+		exp := Experiment{Name: "sweep", BatchID: testBatchID, Workload: workloadBytes, Concurrency: 1, Poll: poll,
+			Sweep: []int{chunkSize, 5 * chunkSize}, MaxBytes: 60 * chunkSize}
+		res, err := run(exp, c, make(chan error))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, class := range res.Sweep {
+			if class.Uploads == 0 || class.Utilization != class.DataChunks {
+				t.Errorf("poll %+v: size %d credited %d steps for %d data chunks", poll, class.Size, class.Utilization, class.DataChunks)
+			}
+		}
+	}
+}
+
+func TestRunDilutedFillsToTheNewCapacity(t *testing.T) {
+	global.out = t.TempDir()
+	// the batch is diluted to a capacity of 32 halfway to its 16
+	_, c := newFullBee(t, 20, 16)
+	exp := Experiment{Name: "dilute", BatchID: testBatchID, Workload: workloadBytes, Size: chunkSize, Concurrency: 1, Dilute: &AutoDilute{Threshold: 50}}
+	res, err := run(exp, c, make(chan error))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Dilutions) != 1 || res.StopReason != stopFull {
+		t.Fatalf("dilutions %+v, stop reason %q, want one dilution and a full batch", res.Dilutions, res.StopReason)
+	}
+
+	logged, err := os.Open(filepath.Join(global.out, "dilute.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logged.Close()
+	a, err := parseLog(logged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	series, err := os.Open(filepath.Join(global.out, "dilute.ts"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer series.Close()
+	samples, err := readSeries(series)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, samples := range map[string][]Sample{"result": res.Samples, "log": a.samples, "series": samples} {
+		if chunks, ok := chunksToFull(samples); !ok || chunks != 32 {
+			t.Errorf("%s: chunks to full %d, %v, want the 32 of the diluted batch", name, chunks, ok)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	defaultS3Region = "us-east-1"
+	// emptySHA256 is the payload hash of the bodiless S3 requests.
+	emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// S3Source uploads the objects of an S3 compatible bucket, addressed path
+// style as MinIO and most other stores expect. The credentials fall back
+// to AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN.
+type S3Source struct {
+	Endpoint     string `json:"endpoint"`
+	Bucket       string `json:"bucket"`
+	Prefix       string `json:"prefix"`
+	Region       string `json:"region"`
+	AccessKey    string `json:"accessKey"`
+	SecretKey    string `json:"secretKey"`
+	SessionToken string `json:"sessionToken"`
+	// MaxObjects ends the source after this many objects, 0 reads them all.
+	MaxObjects int `json:"maxObjects"`
+}
+
+func (s S3Source) validate() error {
+	if s.Endpoint == "" || s.Bucket == "" {
+		return fmt.Errorf("missing endpoint or bucket")
+	}
+	u, err := url.Parse(s.Endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid endpoint %q", s.Endpoint)
+	}
+	if s.MaxObjects < 0 {
+		return fmt.Errorf("negative maxObjects")
+	}
+	return nil
+}
+
+// s3Objects lists the bucket a page at a time and fetches every object as
+// it is asked for.
+type s3Objects struct {
+	cfg    S3Source
+	base   *url.URL
+	http   *http.Client
+	keys   []string
+	token  string
+	listed bool
+	read   int
+}
+
+func newS3Objects(cfg S3Source) (*s3Objects, error) {
+	if cfg.Region == "" {
+		cfg.Region = defaultS3Region
+	}
+	if cfg.AccessKey == "" {
+		cfg.AccessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+	}
+	if cfg.SecretKey == "" {
+		cfg.SecretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	}
+	if cfg.SessionToken == "" {
+		cfg.SessionToken = os.Getenv("AWS_SESSION_TOKEN")
+	}
+	if cfg.AccessKey == "" || cfg.SecretKey == "" {
+		return nil, fmt.Errorf("s3: missing credentials")
+	}
+	base, err := url.Parse(strings.TrimSuffix(cfg.Endpoint, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("s3: %w", err)
+	}
+	return &s3Objects{cfg: cfg, base: base, http: &http.Client{}}, nil
+}
+
+func (s *s3Objects) next(ctx context.Context) (object, error) {
+	if s.cfg.MaxObjects > 0 && s.read >= s.cfg.MaxObjects {
+		return object{}, io.EOF
+	}
+	for len(s.keys) == 0 {
+		if s.listed && s.token == "" {
+			return object{}, io.EOF
+		}
+		err := s.list(ctx)
+		if err != nil {
+			return object{}, err
+		}
+	}
+	key := s.keys[0]
+	s.keys = s.keys[1:]
+	data, err := s.get(ctx, key)
+	if err != nil {
+		return object{}, fmt.Errorf("get %s: %w", key, err)
+	}
+	s.read++
+	return object{name: key, data: data}, nil
+}
+
+type listBucketResult struct {
+	Contents []struct {
+		Key  string `xml:"Key"`
+		Size int64  `xml:"Size"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// list fetches the next page of keys.
+func (s *s3Objects) list(ctx context.Context) error {
+	q := url.Values{"list-type": {"2"}}
+	if s.cfg.Prefix != "" {
+		q.Set("prefix", s.cfg.Prefix)
+	}
+	if s.token != "" {
+		q.Set("continuation-token", s.token)
+	}
+	body, err := s.do(ctx, "/"+s.cfg.Bucket, q)
+	if err != nil {
+		return fmt.Errorf("list %s: %w", s.cfg.Bucket, err)
+	}
+	var page listBucketResult
+	err = xml.Unmarshal(body, &page)
+	if err != nil {
+		return fmt.Errorf("list %s: %w", s.cfg.Bucket, err)
+	}
+	for _, c := range page.Contents {
+		s.keys = append(s.keys, c.Key)
+	}
+	s.listed = true
+	s.token = ""
+	if page.IsTruncated {
+		s.token = page.NextContinuationToken
+	}
+	return nil
+}
+
+func (s *s3Objects) get(ctx context.Context, key string) ([]byte, error) {
+	return s.do(ctx, "/"+s.cfg.Bucket+"/"+key, nil)
+}
+
+// do sends a signed GET of path and returns the body.
+func (s *s3Objects) do(ctx context.Context, path string, query url.Values) ([]byte, error) {
+	u := *s.base
+	u.Path = s.base.Path + path
+	u.RawPath = s.base.EscapedPath() + s3Escape(path, false)
+	u.RawQuery = s3Query(query)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	s.sign(req, time.Now().UTC())
+	res, err := s.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d: %s", res.StatusCode, s3ErrorMessage(body))
+	}
+	return body, nil
+}
+
+// s3ErrorMessage is the code and message of an S3 error response.
+func s3ErrorMessage(body []byte) string {
+	var e struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	if xml.Unmarshal(body, &e) != nil || e.Code == "" {
+		return strings.TrimSpace(string(body))
+	}
+	return e.Code + ": " + e.Message
+}
+
+// sign adds an AWS signature version 4 to the bodiless request.
+func (s *s3Objects) sign(req *http.Request, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", emptySHA256)
+	if s.cfg.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.cfg.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonical strings.Builder
+	for _, k := range names {
+		canonical.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signed := strings.Join(names, ";")
+
+	request := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonical.String(),
+		signed,
+		emptySHA256,
+	}, "\n")
+	scope := day + "/" + s.cfg.Region + "/s3/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hexSHA256(request)
+
+	key := hmacSHA256([]byte("AWS4"+s.cfg.SecretKey), day)
+	key = hmacSHA256(key, s.cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+s.cfg.AccessKey+"/"+scope+", SignedHeaders="+signed+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func hexSHA256(s string) string {
+	h := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(h[:])
+}
+
+// s3Escape percent-encodes everything but the unreserved characters, and
+// the slashes unless slash is set.
+func s3Escape(s string, slash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !slash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// s3Query is the canonical query string, sorted and encoded as the
+// signature requires, so the request sends exactly what was signed.
+func s3Query(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		for _, v := range q[k] {
+			parts = append(parts, s3Escape(k, true)+"="+s3Escape(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
@@ -0,0 +1,85 @@
+package main
+
+import "fmt"
+
+// Dependency makes an experiment wait for another one to finish. The
+// experiment is skipped when the other one failed or, with StopReason set,
+// ended any other way.
+type Dependency struct {
+	Experiment string `json:"experiment"`
+	StopReason string `json:"stopReason"`
+}
+
+// validateDependencies checks that the dependencies name other experiments
+// and don't form a cycle.
+func validateDependencies(exps []Experiment, p *problems) {
+	index := map[string]int{}
+	for i, e := range exps {
+		index[e.Name] = i
+	}
+	known := true
+	for i, e := range exps {
+		for j, d := range e.DependsOn {
+			field := fmt.Sprintf("experiments[%d].dependsOn[%d]", i, j)
+			if _, ok := index[d.Experiment]; !ok {
+				p.add(field, "unknown experiment %q", d.Experiment)
+				known = false
+			} else if d.Experiment == e.Name {
+				p.add(field, "depends on itself")
+				known = false
+			}
+		}
+	}
+	if !known {
+		return
+	}
+	// 0 unvisited, 1 on the current path, 2 done
+	state := make([]int, len(exps))
+	var visit func(i int) bool
+	visit = func(i int) bool {
+		switch state[i] {
+		case 1:
+			return false
+		case 2:
+			return true
+		}
+		state[i] = 1
+		for _, d := range exps[i].DependsOn {
+			if !visit(index[d.Experiment]) {
+				return false
+			}
+		}
+		state[i] = 2
+		return true
+	}
+	for i := range exps {
+		if !visit(i) {
+			p.add(fmt.Sprintf("experiments[%d].dependsOn", i), "dependency cycle")
+			return
+		}
+	}
+}
+
+// unmet returns why the finished dependency r keeps d's experiment from
+// running, or "" when it may run.
+func (d Dependency) unmet(r *Result) string {
+	switch {
+	case d.StopReason != "" && r.StopReason != d.StopReason:
+		return fmt.Sprintf("%s ended %s, not %s", d.Experiment, r.StopReason, d.StopReason)
+	case d.StopReason == "" && (r.StopReason == stopError || r.StopReason == stopSkipped):
+		return fmt.Sprintf("%s ended %s", d.Experiment, r.StopReason)
+	}
+	return ""
+}
+
+// notRun records an experiment that never started.
+func notRun(exp Experiment, stopReason, why string) *Result {
+	now := clock.Now()
+	res := &Result{Experiment: exp, Start: now, End: now, StopReason: stopReason, Error: why}
+	board.update(res)
+	err := writeResult(outPath(outName(exp.Name+".json")), res)
+	if err != nil {
+		fmt.Fprintln(console(), exp.Name+": write result:", err)
+	}
+	return res
+}
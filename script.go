@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+const workloadScript = "script"
+
+func cmdScript(args []string) error {
+	fs := newFlagSet("script", "[flags] <file.star>")
+	name := fs.String("name", "", "experiment name of the results, the script's file name by default")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return withExitCode(exitUsage, fmt.Errorf("need one script"))
+	}
+	path := fs.Arg(0)
+	if *name == "" {
+		*name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return withExitCode(exitConfig, fmt.Errorf("read script: %w", err))
+	}
+
+	res, err := runScript(global.client(), *name, path, src)
+	if err != nil {
+		return err
+	}
+	err = writeSummaries(os.Stdout, []*Result{res})
+	if err != nil {
+		return err
+	}
+	return printOutcomes(console(), []*Result{res})
+}
+
+// scriptRun is the state a script builds up through the client primitives,
+// reported like a configured experiment.
+type scriptRun struct {
+	f      io.Writer
+	c      *Client
+	res    *Result
+	series *seriesWriter
+	// batch is the last state getStamp returned
+	batch         *Batch
+	bytes, chunks int
+}
+
+// runScript runs a Starlark script against the node. The script gets
+// upload, getStamp, sleep and log, its uploads are recorded as samples of
+// one experiment.
+func runScript(c *Client, name, path string, src []byte) (res *Result, err error) {
+	res = &Result{Experiment: Experiment{Name: name, Workload: workloadScript}, Start: clock.Now()}
+	file, err := openLog(outPath(outName(name + ".log")))
+	if err != nil {
+		return res, fmt.Errorf("error opening file: %v", err)
+	}
+	defer file.Close()
+	f := logWriter(file, name)
+	if global.verbose {
+		f = io.MultiWriter(file, newConsoleWriter(name))
+	}
+	series, err := createSeries(outPath(outName(name+".ts")), res.Start)
+	if err != nil {
+		return res, fmt.Errorf("create series: %w", err)
+	}
+	defer series.Close()
+	s := &scriptRun{f: f, c: c, res: res, series: series}
+	defer func() {
+		res.End = clock.Now()
+		if err != nil {
+			res.StopReason = stopError
+			res.Error = err.Error()
+			res.err = err
+		} else {
+			res.StopReason = stopDone
+		}
+		log(f, "summary stopReason=", res.StopReason, " uploads=", res.Uploads, " failures=", res.Failures)
+		board.update(res)
+		werr := writeResult(outPath(outName(name+".json")), res)
+		if werr != nil {
+			log(f, "write result: ", werr)
+		}
+	}()
+
+	log(f, "script=", path)
+	thread := &starlark.Thread{
+		Name: name,
+		Print: func(_ *starlark.Thread, msg string) {
+			log(f, msg)
+		},
+	}
+	predeclared := starlark.StringDict{
+		"upload":   starlark.NewBuiltin("upload", s.upload),
+		"getStamp": starlark.NewBuiltin("getStamp", s.getStamp),
+		"sleep":    starlark.NewBuiltin("sleep", s.sleep),
+		"log":      starlark.NewBuiltin("log", s.log),
+	}
+	// scripts are experiments, not configuration: allow loops at the top
+	// level and while loops
+	opts := &syntax.FileOptions{Set: true, While: true, TopLevelControl: true, GlobalReassign: true, Recursion: true}
+	_, err = starlark.ExecFileOptions(opts, thread, path, src, predeclared)
+	if err != nil {
+		if e, ok := err.(*starlark.EvalError); ok {
+			return res, fmt.Errorf("script: %s", e.Backtrace())
+		}
+		return res, fmt.Errorf("script: %w", err)
+	}
+	return res, nil
+}
+
+// upload(batchID, size=4096, encrypt=False) uploads random bytes and
+// returns the reference.
+func (s *scriptRun) upload(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var batchID string
+	size, encrypt := 4096, false
+	err := starlark.UnpackArgs(b.Name(), args, kwargs, "batchID", &batchID, "size?", &size, "encrypt?", &encrypt)
+	if err != nil {
+		return nil, err
+	}
+	if size <= 0 {
+		return nil, fmt.Errorf("%s: size must be positive", b.Name())
+	}
+	exp := Experiment{Name: s.res.Experiment.Name, BatchID: batchID, Size: size, Encrypt: encrypt, Workload: workloadBytes}
+	if s.res.Experiment.BatchID == "" {
+		s.res.Experiment.BatchID = batchID
+	}
+	u := &bytesUploader{client: s.c, exp: exp}
+	data, err := u.Payload(size)
+	if err != nil {
+		return nil, err
+	}
+	tag, err := s.c.createTag()
+	if err != nil {
+		return nil, fmt.Errorf("create tag: %w", err)
+	}
+	started := clock.Now()
+	up, err := u.Upload(context.Background(), data, tag.UID, "")
+	if err != nil {
+		s.res.Failures++
+		return nil, fmt.Errorf("%s: %w", b.Name(), err)
+	}
+	s.res.Uploads++
+	s.bytes += size
+	s.chunks += u.Chunks(size)
+	log(s.f, "reference=", up.Reference, " batchID=", batchID, " size=", prettyByteSize(size), " encrypt=", encrypt, requestIDField(up.RequestID))
+	sample := Sample{Time: clock.Now(), Bytes: s.bytes, Chunks: s.chunks, Latency: since(started)}
+	if s.batch != nil {
+		sample.Utilization = s.batch.Utilization
+	}
+	s.res.Samples = downsample(append(s.res.Samples, sample))
+	err = s.series.write(sample)
+	if err != nil {
+		log(s.f, "write series: ", err)
+	}
+	board.update(s.res)
+	return starlark.String(up.Reference), nil
+}
+
+// getStamp(batchID) returns the batch as a dict.
+func (s *scriptRun) getStamp(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var batchID string
+	err := starlark.UnpackArgs(b.Name(), args, kwargs, "batchID", &batchID)
+	if err != nil {
+		return nil, err
+	}
+	batch, err := s.c.getStamp(batchID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", b.Name(), err)
+	}
+	s.batch = batch
+	s.res.Batch = batch
+	log(s.f, "batchID=", batch.BatchID, " utilization=", batch.Utilization, " depth=", batch.Depth, " usable=", batch.Usable)
+	d := starlark.NewDict(9)
+	for k, v := range map[string]starlark.Value{
+		"batchID":     starlark.String(batch.BatchID),
+		"utilization": starlark.MakeInt(batch.Utilization),
+		"capacity":    starlark.MakeInt(batch.capacity()),
+		"depth":       starlark.MakeInt(batch.Depth),
+		"bucketDepth": starlark.MakeInt(batch.BucketDepth),
+		"usable":      starlark.Bool(batch.Usable),
+		"expired":     starlark.Bool(batch.Expired),
+		"immutable":   starlark.Bool(batch.Immutable),
+		"ttl":         starlark.MakeInt64(batch.TTL),
+	} {
+		err = d.SetKey(starlark.String(k), v)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// sleep(seconds) pauses the script.
+func (s *scriptRun) sleep(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var seconds starlark.Value
+	err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 1, &seconds)
+	if err != nil {
+		return nil, err
+	}
+	v, ok := starlark.AsFloat(seconds)
+	if !ok || v < 0 {
+		return nil, fmt.Errorf("%s: want a non-negative number of seconds, got %s", b.Name(), seconds)
+	}
+	clock.Sleep(time.Duration(v * float64(time.Second)))
+	return starlark.None, nil
+}
+
+// log(*values) writes the values to the experiment log.
+func (s *scriptRun) log(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if len(kwargs) > 0 {
+		return nil, fmt.Errorf("%s: unexpected keyword arguments", b.Name())
+	}
+	parts := make([]string, len(args))
+	for i, a := range args {
+		if str, ok := starlark.AsString(a); ok {
+			parts[i] = str
+		} else {
+			parts[i] = a.String()
+		}
+	}
+	log(s.f, strings.Join(parts, " "))
+	return starlark.None, nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"runtime"
+	"time"
+)
+
+// SelfMetrics are the tool's own runtime statistics, to tell client side
+// resource problems during long runs apart from node problems.
+type SelfMetrics struct {
+	Goroutines int    `json:"goroutines"`
+	HeapInuse  uint64 `json:"heapInuse"`
+	NumGC      uint32 `json:"numGC"`
+	// GCPause is the total stop the world time of all collections and
+	// LastGCPause that of the most recent one.
+	GCPause     time.Duration `json:"gcPause"`
+	LastGCPause time.Duration `json:"lastGCPause"`
+}
+
+// selfLogInterval limits how often the self metrics are logged, they are
+// recorded with every sample.
+const selfLogInterval = time.Minute
+
+func readSelfMetrics() *SelfMetrics {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	s := &SelfMetrics{
+		Goroutines: runtime.NumGoroutine(),
+		HeapInuse:  m.HeapInuse,
+		NumGC:      m.NumGC,
+		GCPause:    time.Duration(m.PauseTotalNs),
+	}
+	if m.NumGC > 0 {
+		s.LastGCPause = time.Duration(m.PauseNs[(m.NumGC+255)%256])
+	}
+	return s
+}
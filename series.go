@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// maxSamples bounds the samples kept in memory and in the result file.
+const maxSamples = 10000
+
+// downsample halves the samples once there are more than maxSamples,
+// keeping the first and last sample and every utilization change so the
+// utilization curve and bytes to full stay exact.
+func downsample(samples []Sample) []Sample {
+	if len(samples) <= maxSamples {
+		return samples
+	}
+	out := samples[:1]
+	skip := false
+	for i := 1; i < len(samples)-1; i++ {
+		if samples[i].Utilization != samples[i-1].Utilization {
+			out = append(out, samples[i])
+			skip = true
+			continue
+		}
+		if !skip {
+			out = append(out, samples[i])
+		}
+		skip = !skip
+	}
+	return append(out, samples[len(samples)-1])
+}
+
+var seriesMagic = [8]byte{'b', 'u', 't', 's', 'v', '2', 0, 0}
+
+// seriesMagicV1 marks the files written before the records carried the
+// capacity.
+var seriesMagicV1 = [8]byte{'b', 'u', 't', 's', 'v', '1', 0, 0}
+
+// seriesRecordSize: time, bytes, chunks, latency, utilization and capacity.
+const seriesRecordSize = 8 + 8 + 8 + 8 + 4 + 4
+
+// seriesWriter appends samples to a compact binary time series file. The
+// older the run, the coarser the resolution: every sample during the first
+// hour, then one a minute for the first day and one every ten minutes after
+// that. Utilization changes are always written. Paths ending in .gz are
+// compressed.
+type seriesWriter struct {
+	w       *bufio.Writer
+	gz      *gzip.Writer
+	f       *os.File
+	start   time.Time
+	last    Sample
+	written bool
+	flushed time.Time
+}
+
+func createSeries(path string, start time.Time) (*seriesWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &seriesWriter{f: f, start: start}
+	var w io.Writer = f
+	if isGzip(path) {
+		s.gz = gzip.NewWriter(f)
+		w = s.gz
+	}
+	s.w = bufio.NewWriter(w)
+	_, err = s.w.Write(seriesMagic[:])
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func seriesInterval(age time.Duration) time.Duration {
+	switch {
+	case age < time.Hour:
+		return 0
+	case age < 24*time.Hour:
+		return time.Minute
+	default:
+		return 10 * time.Minute
+	}
+}
+
+func (s *seriesWriter) write(sample Sample) error {
+	if s.written && sample.Utilization == s.last.Utilization &&
+		sample.Time.Sub(s.last.Time) < seriesInterval(sample.Time.Sub(s.start)) {
+		return nil
+	}
+	var rec [seriesRecordSize]byte
+	binary.LittleEndian.PutUint64(rec[0:], uint64(sample.Time.UnixNano()))
+	binary.LittleEndian.PutUint64(rec[8:], uint64(sample.Bytes))
+	binary.LittleEndian.PutUint64(rec[16:], uint64(sample.Chunks))
+	binary.LittleEndian.PutUint64(rec[24:], uint64(sample.Latency))
+	binary.LittleEndian.PutUint32(rec[32:], uint32(sample.Utilization))
+	binary.LittleEndian.PutUint32(rec[36:], uint32(sample.Capacity))
+	_, err := s.w.Write(rec[:])
+	if err != nil {
+		return err
+	}
+	s.last, s.written = sample, true
+	// flush every record, a crashed soak run should keep its series.
+	// Compressed series flush like the logs, a deflate block per record
+	// would undo the compression.
+	if s.gz != nil && time.Since(s.flushed) < logFlushInterval {
+		return nil
+	}
+	s.flushed = time.Now()
+	return s.flush()
+}
+
+func (s *seriesWriter) flush() error {
+	err := s.w.Flush()
+	if err != nil || s.gz == nil {
+		return err
+	}
+	return s.gz.Flush()
+}
+
+func (s *seriesWriter) Close() error {
+	err := s.flush()
+	if err == nil && s.gz != nil {
+		err = s.gz.Close()
+	}
+	if cerr := s.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func readSeries(r io.Reader) ([]Sample, error) {
+	br := bufio.NewReader(r)
+	var magic [8]byte
+	_, err := io.ReadFull(br, magic[:])
+	if err != nil {
+		return nil, err
+	}
+	var rec [seriesRecordSize]byte
+	size := len(rec)
+	switch magic {
+	case seriesMagic:
+	case seriesMagicV1:
+		size -= 4
+	default:
+		return nil, fmt.Errorf("not a time series file")
+	}
+	var samples []Sample
+	for {
+		_, err = io.ReadFull(br, rec[:size])
+		if errors.Is(err, io.EOF) {
+			return samples, nil
+		}
+		if err != nil {
+			// a torn last record from an interrupted run
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				return samples, nil
+			}
+			return nil, err
+		}
+		samples = append(samples, Sample{
+			Time:        time.Unix(0, int64(binary.LittleEndian.Uint64(rec[0:]))),
+			Bytes:       int(binary.LittleEndian.Uint64(rec[8:])),
+			Chunks:      int(binary.LittleEndian.Uint64(rec[16:])),
+			Latency:     time.Duration(binary.LittleEndian.Uint64(rec[24:])),
+			Utilization: int(binary.LittleEndian.Uint32(rec[32:])),
+			Capacity:    int(binary.LittleEndian.Uint32(rec[36:])),
+		})
+	}
+}
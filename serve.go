@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+type experimentStatus struct {
+	Name          string    `json:"name"`
+	BatchID       string    `json:"batchID"`
+	Node          string    `json:"node,omitempty"`
+	Encrypt       bool      `json:"encrypt"`
+	Deferred      bool      `json:"deferred"`
+	Uploads       int       `json:"uploads"`
+	Failures      int       `json:"failures"`
+	TotalUploaded int       `json:"totalUploaded"`
+	TotalChunks   int       `json:"totalChunks"`
+	Utilization   int       `json:"utilization"`
+	StopReason    string    `json:"stopReason,omitempty"`
+	Error         string    `json:"error,omitempty"`
+	Updated       time.Time `json:"updated"`
+	// Capacity is the chunks a bucket of the batch holds, 0 until the
+	// batch is known.
+	Capacity int `json:"capacity,omitempty"`
+	// Self are the tool's runtime metrics with the latest sample.
+	Self *SelfMetrics `json:"self,omitempty"`
+}
+
+// statusBoard holds the latest state of every experiment run by the process,
+// for the status API.
+type statusBoard struct {
+	mu          sync.Mutex
+	experiments map[string]experimentStatus
+}
+
+var board = &statusBoard{experiments: map[string]experimentStatus{}}
+
+func (b *statusBoard) update(res *Result) {
+	s := experimentStatus{
+		Name:          res.Experiment.Name,
+		BatchID:       res.Experiment.BatchID,
+		Node:          res.API,
+		Encrypt:       res.Experiment.Encrypt,
+		Deferred:      res.Experiment.Deferred,
+		Uploads:       res.Uploads,
+		Failures:      res.Failures,
+		TotalUploaded: res.totalUploaded(),
+		StopReason:    res.StopReason,
+		Error:         res.Error,
+		Updated:       time.Now(),
+	}
+	if res.Batch != nil {
+		s.BatchID, s.Capacity = res.Batch.BatchID, res.Batch.capacity()
+	}
+	if len(res.Samples) > 0 {
+		s.Utilization = res.Samples[len(res.Samples)-1].Utilization
+		s.TotalChunks = res.Samples[len(res.Samples)-1].Chunks
+		s.Self = res.Samples[len(res.Samples)-1].Self
+	}
+	b.mu.Lock()
+	b.experiments[s.Name] = s
+	b.mu.Unlock()
+}
+
+func (b *statusBoard) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	list := make([]experimentStatus, 0, len(b.experiments))
+	for _, s := range b.experiments {
+		list = append(list, s)
+	}
+	b.mu.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(list)
+}
@@ -0,0 +1,366 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	backendBee = "bee"
+	backendSim = "sim"
+
+	// simURL is the address of the simulated node, requests to it never
+	// leave the process
+	simURL = "http://sim"
+
+	// bucket models of the simulation
+	simUniform = "uniform"
+	simEven    = "even"
+)
+
+// nodeTransport is what clients reach the node through, nil for the
+// network.
+var nodeTransport http.RoundTripper
+
+// simOptions configure the simulated node of -backend sim.
+type simOptions struct {
+	// depth and bucketDepth of batches the simulation didn't buy
+	depth       int
+	bucketDepth int
+	// buckets is the bucket model: uniform puts every chunk into a random
+	// bucket as content addressing does, even fills the buckets round robin,
+	// the best case
+	buckets string
+	ttl     time.Duration
+	latency time.Duration
+	seed    int64
+}
+
+func (o *simOptions) register(fs *flag.FlagSet) {
+	fs.IntVar(&o.depth, "sim-depth", 20, "depth of the batches the simulated node didn't buy")
+	fs.IntVar(&o.bucketDepth, "sim-bucket-depth", 16, "bucket depth of the simulated batches")
+	fs.StringVar(&o.buckets, "sim-buckets", simUniform, "bucket model of the simulated node: uniform or even")
+	fs.DurationVar(&o.ttl, "sim-ttl", 30*24*time.Hour, "time to live of the simulated batches, 0 to never expire")
+	fs.DurationVar(&o.latency, "sim-latency", 0, "time every simulated upload takes")
+	fs.Int64Var(&o.seed, "sim-seed", 1, "seed of the simulated bucket assignment")
+}
+
+func (o simOptions) validate() error {
+	if o.bucketDepth <= 0 || o.bucketDepth >= o.depth || o.depth > 40 {
+		return fmt.Errorf("-sim-bucket-depth %d and -sim-depth %d: need 0 < bucket depth < depth <= 40", o.bucketDepth, o.depth)
+	}
+	if o.buckets != simUniform && o.buckets != simEven {
+		return fmt.Errorf("-sim-buckets: unknown model %q", o.buckets)
+	}
+	if o.ttl < 0 || o.latency < 0 {
+		return fmt.Errorf("negative -sim-ttl or -sim-latency")
+	}
+	return nil
+}
+
+// simCheck rejects the experiments the simulated node can't serve, it has
+// no /chunks endpoint for locally stamped chunks and no pss, stream or
+// grantee endpoints.
+func simCheck(exps []Experiment) error {
+	var p problems
+	for i, e := range exps {
+		at := func(field string) string {
+			return fmt.Sprintf("experiments[%d].%s", i, field)
+		}
+		if e.OwnerKey != "" {
+			p.add(at("ownerKey"), "%s: the simulated node doesn't take locally stamped chunks", e.Name)
+		}
+		if e.Workload == workloadPss || e.Workload == workloadStream {
+			p.add(at("workload"), "%s: the simulated node doesn't serve the %s workload", e.Name, e.Workload)
+		}
+		if e.Act != nil && len(e.Act.Grantees) > 0 {
+			p.add(at("act.grantees"), "%s: the simulated node keeps no grantee lists", e.Name)
+		}
+	}
+	return withExitCode(exitConfig, p.err("-backend sim"))
+}
+
+type simBatch struct {
+	Batch
+	buckets []int
+	// next is the bucket of the even model's next chunk
+	next    int
+	expires time.Time
+}
+
+func (b *simBatch) state() Batch {
+	batch := b.Batch
+	if !b.expires.IsZero() {
+		ttl := until(b.expires)
+		batch.Expired = ttl <= 0
+		batch.Usable = !batch.Expired
+		if ttl < 0 {
+			ttl = 0
+		}
+		batch.TTL = int64(ttl / time.Second)
+	}
+	return batch
+}
+
+// simNode is an in-process Bee node. It keeps batches, tags and references
+// in memory and assigns the chunks of every upload to the batch's buckets
+// by the bucket model, so orchestration, ETAs and reports can be worked on
+// without a node.
+type simNode struct {
+	opts  simOptions
+	mux   *http.ServeMux
+	start time.Time
+
+	mu      sync.Mutex
+	rnd     *rand.Rand
+	batches map[string]*simBatch
+	tags    map[uint64]*Tag
+	lastTag uint64
+	refs    map[string]bool
+}
+
+func newSimNode(opts simOptions) *simNode {
+	s := &simNode{
+		opts:    opts,
+		mux:     http.NewServeMux(),
+		start:   clock.Now(),
+		rnd:     rand.New(rand.NewSource(opts.seed)),
+		batches: map[string]*simBatch{},
+		tags:    map[uint64]*Tag{},
+		refs:    map[string]bool{},
+	}
+	s.mux.HandleFunc("/health", s.health)
+	s.mux.HandleFunc("/chainstate", s.chainState)
+	s.mux.HandleFunc("/stamps", s.stamps)
+	s.mux.HandleFunc("/stamps/", s.stamp)
+	s.mux.HandleFunc("/bytes", s.upload)
+	s.mux.HandleFunc("/bzz", s.upload)
+	s.mux.HandleFunc("/bytes/", s.download)
+	s.mux.HandleFunc("/chunks/", s.download)
+	s.mux.HandleFunc("/tags", s.createTag)
+	s.mux.HandleFunc("/tags/", s.getTag)
+	return s
+}
+
+// RoundTrip serves the request in the process.
+func (s *simNode) RoundTrip(req *http.Request) (*http.Response, error) {
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, req)
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	res := rec.Result()
+	res.Request = req
+	return res, nil
+}
+
+func simJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func simError(w http.ResponseWriter, code int, message string) {
+	simJSON(w, code, map[string]interface{}{"code": code, "message": message})
+}
+
+func (s *simNode) health(w http.ResponseWriter, _ *http.Request) {
+	simJSON(w, http.StatusOK, Health{Status: "ok", Version: "2.2.0-sim", APIVersion: "7.2.0"})
+}
+
+func (s *simNode) chainState(w http.ResponseWriter, _ *http.Request) {
+	block := uint64(since(s.start) / blockTime)
+	simJSON(w, http.StatusOK, ChainState{Block: block, TotalAmount: "0", CurrentPrice: "24000"})
+}
+
+// batch returns the batch of id, made up on first use so configs with the
+// ids of real batches run unchanged. The caller holds mu.
+func (s *simNode) batch(id string) *simBatch {
+	b, ok := s.batches[id]
+	if !ok {
+		b = s.newBatch(id, s.opts.depth, true, "0")
+	}
+	return b
+}
+
+func (s *simNode) newBatch(id string, depth int, immutable bool, amount string) *simBatch {
+	b := &simBatch{
+		Batch: Batch{
+			BatchID:     id,
+			Usable:      true,
+			Depth:       depth,
+			BucketDepth: s.opts.bucketDepth,
+			Immutable:   immutable,
+			Amount:      amount,
+		},
+		buckets: make([]int, 1<<s.opts.bucketDepth),
+	}
+	if s.opts.ttl > 0 {
+		b.expires = clock.Now().Add(s.opts.ttl)
+	}
+	s.batches[id] = b
+	return b
+}
+
+func (s *simNode) stamps(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stamps := []Batch{}
+	for _, b := range s.batches {
+		stamps = append(stamps, b.state())
+	}
+	simJSON(w, http.StatusOK, map[string]interface{}{"stamps": stamps})
+}
+
+func (s *simNode) stamp(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/stamps/"), "/")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case r.Method == http.MethodPost && len(parts) == 2:
+		depth, err := strconv.Atoi(parts[1])
+		if err != nil || depth <= s.opts.bucketDepth || depth > 40 {
+			simError(w, http.StatusBadRequest, "invalid depth")
+			return
+		}
+		id := s.randomHex(32)
+		s.newBatch(id, depth, r.Header.Get("Immutable") != "false", parts[0])
+		simJSON(w, http.StatusCreated, map[string]string{"batchID": id})
+	case r.Method == http.MethodPatch && len(parts) == 3 && parts[0] == "topup":
+		b := s.batch(parts[1])
+		if !b.expires.IsZero() {
+			b.expires = b.expires.Add(s.opts.ttl)
+		}
+		simJSON(w, http.StatusAccepted, map[string]string{"batchID": b.BatchID})
+	case r.Method == http.MethodPatch && len(parts) == 3 && parts[0] == "dilute":
+		b := s.batch(parts[1])
+		depth, err := strconv.Atoi(parts[2])
+		if err != nil || depth <= b.Depth || depth > 40 {
+			simError(w, http.StatusBadRequest, "invalid depth")
+			return
+		}
+		b.Depth = depth
+		simJSON(w, http.StatusAccepted, map[string]string{"batchID": b.BatchID})
+	case r.Method == http.MethodGet && len(parts) == 2 && parts[1] == "buckets":
+		b := s.batch(parts[0])
+		buckets := Buckets{Depth: b.Depth, BucketDepth: b.BucketDepth}
+		buckets.Buckets = make([]struct {
+			BucketID   int `json:"bucketID"`
+			Collisions int `json:"collisions"`
+		}, len(b.buckets))
+		for i, n := range b.buckets {
+			buckets.Buckets[i].BucketID, buckets.Buckets[i].Collisions = i, n
+		}
+		simJSON(w, http.StatusOK, buckets)
+	case r.Method == http.MethodGet && len(parts) == 1:
+		simJSON(w, http.StatusOK, s.batch(parts[0]).state())
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// upload stamps the chunks of the upload into the batch's buckets. An
+// immutable batch rejects the upload once a bucket is full, a mutable one
+// overwrites the bucket's oldest chunks.
+func (s *simNode) upload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.NotFound(w, r)
+		return
+	}
+	n, err := io.Copy(io.Discard, r.Body)
+	if err != nil {
+		simError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	clock.Sleep(s.opts.latency)
+	chunks := estimateChunks(int(n), r.Header.Get("Swarm-Encrypt") == "true")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b := s.batch(r.Header.Get("Swarm-Postage-Batch-Id"))
+	if b.state().Expired {
+		simError(w, http.StatusBadRequest, "batch expired")
+		return
+	}
+	capacity := b.capacity()
+	for i := 0; i < chunks; i++ {
+		bucket := b.next
+		if s.opts.buckets == simUniform {
+			bucket = s.rnd.Intn(len(b.buckets))
+		}
+		b.next = (b.next + 1) % len(b.buckets)
+		if b.buckets[bucket] >= capacity {
+			if b.Immutable {
+				simError(w, http.StatusPaymentRequired, "batch is overissued")
+				return
+			}
+			continue
+		}
+		b.buckets[bucket]++
+		if b.buckets[bucket] > b.Utilization {
+			b.Utilization = b.buckets[bucket]
+		}
+	}
+	if uid, err := strconv.ParseUint(r.Header.Get("Swarm-Tag"), 10, 64); err == nil {
+		if t, ok := s.tags[uid]; ok {
+			t.Split += int64(chunks)
+			t.Seen, t.Stored, t.Sent, t.Synced = t.Split, t.Split, t.Split, t.Split
+		}
+	}
+	ref := s.randomHex(refSize)
+	if r.Header.Get("Swarm-Encrypt") == "true" {
+		ref += s.randomHex(refSize)
+	}
+	s.refs[ref] = true
+	simJSON(w, http.StatusCreated, uploadResponse{Reference: ref})
+}
+
+func (s *simNode) download(w http.ResponseWriter, r *http.Request) {
+	ref := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+	s.mu.Lock()
+	ok := s.refs[ref]
+	s.mu.Unlock()
+	if !ok {
+		simError(w, http.StatusNotFound, "not found")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *simNode) createTag(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastTag++
+	t := &Tag{UID: s.lastTag}
+	s.tags[t.UID] = t
+	simJSON(w, http.StatusCreated, t)
+}
+
+func (s *simNode) getTag(w http.ResponseWriter, r *http.Request) {
+	uid, err := strconv.ParseUint(strings.TrimPrefix(r.URL.Path, "/tags/"), 10, 64)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tags[uid]
+	if err != nil || !ok {
+		simError(w, http.StatusNotFound, "tag not found")
+		return
+	}
+	simJSON(w, http.StatusOK, t)
+}
+
+// randomHex returns n random bytes, hex encoded. The caller holds mu.
+func (s *simNode) randomHex(n int) string {
+	b := make([]byte, n)
+	s.rnd.Read(b)
+	return hex.EncodeToString(b)
+}
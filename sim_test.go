@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// simUpload posts a single chunk payload to the simulated node.
+func simUpload(t *testing.T, c *Client, batchID string) int {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, simURL+"/bytes", bytes.NewReader(make([]byte, chunkSize)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Swarm-Postage-Batch-Id", batchID)
+	res, err := c.http.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	return res.StatusCode
+}
+
+// simFill uploads n chunks to a new batch of depth 6 with 16 buckets of 4
+// chunks and returns the batch, its buckets and the status of the last
+// upload.
+func simFill(t *testing.T, model string, immutable bool, n int) (*Batch, *Buckets, int) {
+	t.Helper()
+	c, _ := newSimClient(t, simOptions{depth: 20, bucketDepth: 4, buckets: model, seed: 1})
+	id, err := c.buyStamp("1000", 6, immutable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := 0
+	for i := 0; i < n; i++ {
+		status = simUpload(t, c, id)
+	}
+	batch, err := c.getStamp(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buckets, err := c.getBuckets(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return batch, buckets, status
+}
+
+func TestSimBucketModels(t *testing.T) {
+	tests := []struct {
+		model   string
+		uploads int
+		// utilization is exact for the even model and a lower bound for
+		// the uniform one
+		utilization int
+	}{
+		{simEven, 1, 1},
+		{simEven, 16, 1},
+		{simEven, 17, 2},
+		{simEven, 64, 4},
+		{simUniform, 16, 2},
+	}
+	for _, tt := range tests {
+		batch, buckets, status := simFill(t, tt.model, true, tt.uploads)
+		if status != http.StatusCreated {
+			t.Errorf("%s %d: last upload status %d", tt.model, tt.uploads, status)
+		}
+		total, fullest := 0, 0
+		for _, b := range buckets.Buckets {
+			total += b.Collisions
+			if b.Collisions > fullest {
+				fullest = b.Collisions
+			}
+		}
+		if total != tt.uploads || fullest != batch.Utilization {
+			t.Errorf("%s %d: buckets hold %d chunks, fullest %d, utilization %d", tt.model, tt.uploads, total, fullest, batch.Utilization)
+		}
+		if tt.model == simEven && batch.Utilization != tt.utilization || batch.Utilization < tt.utilization {
+			t.Errorf("%s %d: utilization %d, want %d", tt.model, tt.uploads, batch.Utilization, tt.utilization)
+		}
+	}
+}
+
+func TestSimFullBatch(t *testing.T) {
+	tests := []struct {
+		immutable bool
+		status    int
+	}{
+		// an immutable batch is overissued by the chunk past capacity
+		{true, http.StatusPaymentRequired},
+		// a mutable one overwrites the bucket's oldest chunks
+		{false, http.StatusCreated},
+	}
+	for _, tt := range tests {
+		batch, _, status := simFill(t, simEven, tt.immutable, 65)
+		if status != tt.status {
+			t.Errorf("immutable=%v: upload past capacity got status %d, want %d", tt.immutable, status, tt.status)
+		}
+		if batch.Utilization != 4 || !batch.full() {
+			t.Errorf("immutable=%v: utilization %d, want a full batch of 4", tt.immutable, batch.Utilization)
+		}
+	}
+}
+
+func TestSimCheck(t *testing.T) {
+	tests := []struct {
+		exp  Experiment
+		want string
+	}{
+		{Experiment{Name: "bytes", Workload: workloadBytes}, ""},
+		{Experiment{Name: "act", Workload: workloadBytes, Act: &Act{}}, ""},
+		{Experiment{Name: "local", Workload: workloadBytes, OwnerKey: "aa"}, "experiments[0].ownerKey"},
+		{Experiment{Name: "pss", Workload: workloadPss}, "experiments[0].workload"},
+		{Experiment{Name: "stream", Workload: workloadStream}, "experiments[0].workload"},
+		{Experiment{Name: "grantees", Workload: workloadBytes, Act: &Act{Grantees: []string{"02aa"}}}, "experiments[0].act.grantees"},
+	}
+	for _, tt := range tests {
+		err := simCheck([]Experiment{tt.exp})
+		switch {
+		case tt.want == "" && err != nil:
+			t.Errorf("%s: %v", tt.exp.Name, err)
+		case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+			t.Errorf("%s: got %v, want a problem at %s", tt.exp.Name, err, tt.want)
+		case tt.want != "" && exitCode(err) != exitConfig:
+			t.Errorf("%s: exit code %d, want %d", tt.exp.Name, exitCode(err), exitConfig)
+		}
+	}
+}
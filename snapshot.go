@@ -0,0 +1,42 @@
+package main
+
+import (
+	"io"
+	"sort"
+)
+
+// snapshotStamps lists all batches of the node, logging instead of failing
+// since the snapshot is only context for the run.
+func snapshotStamps(f io.Writer, c *Client) []Batch {
+	stamps, err := c.getStamps()
+	if err != nil {
+		log(f, "stamp snapshot: ", err)
+		return nil
+	}
+	sort.Slice(stamps, func(i, j int) bool { return stamps[i].BatchID < stamps[j].BatchID })
+	return stamps
+}
+
+// logSnapshotChanges logs the batches that appeared, disappeared or changed
+// between the snapshots, other than the experiment's own.
+func logSnapshotChanges(f io.Writer, own string, start, end []Batch) {
+	before := make(map[string]Batch, len(start))
+	for _, b := range start {
+		before[b.BatchID] = b
+	}
+	for _, b := range end {
+		prev, ok := before[b.BatchID]
+		delete(before, b.BatchID)
+		switch {
+		case b.BatchID == own:
+		case !ok:
+			log(f, "snapshot new batchID=", b.BatchID, " utilization=", b.Utilization)
+		case prev.Utilization != b.Utilization || prev.Depth != b.Depth || prev.Expired != b.Expired:
+			log(f, "snapshot changed batchID=", b.BatchID, " utilization=", prev.Utilization, "->", b.Utilization,
+				" depth=", prev.Depth, "->", b.Depth, " expired=", prev.Expired, "->", b.Expired)
+		}
+	}
+	for id := range before {
+		log(f, "snapshot missing batchID=", id)
+	}
+}
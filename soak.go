@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// Generation is one batch of a soak run, which buys a new batch whenever
+// the current one fills up or expires.
+type Generation struct {
+	BatchID    string    `json:"batchID"`
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	Bytes      int       `json:"bytes"`
+	Chunks     int       `json:"chunks"`
+	StopReason string    `json:"stopReason"`
+}
+
+// waitUsable polls the batch until the node can stamp with it, or until
+// stop says to give up.
+func waitUsable(f io.Writer, c *Client, stop <-chan error, batchID string) (batch *Batch, stopped bool, err error) {
+	for {
+		batch, err = c.getStamp(batchID)
+		if err != nil {
+			return nil, false, fmt.Errorf("get stamp: %w", err)
+		}
+		if batch.Usable {
+			return batch, false, nil
+		}
+		log(f, "waiting for stamp to be usable")
+		systemd.alive()
+		select {
+		case v := <-stop:
+			log(f, "stopping", v)
+			return nil, true, nil
+		case <-clock.After(5 * time.Second):
+		}
+	}
+}
+
+// rotateBatch buys the next batch of a soak run, with the experiment's
+// batch spec.
+func rotateBatch(f io.Writer, c *Client, stop <-chan error, exp Experiment) (*Batch, bool, error) {
+	spec := defaultBatchSpec
+	if exp.Buy != nil {
+		spec = *exp.Buy
+	}
+	id, err := c.buyStamp(spec.Amount, spec.Depth, spec.Immutable)
+	if err != nil {
+		return nil, false, fmt.Errorf("buy stamp: %w", err)
+	}
+	log(f, "soak bought batch=", id, " depth=", spec.Depth, " amount=", spec.Amount)
+	return waitUsable(f, c, stop, id)
+}
+
+// generationSamples returns the trailing samples of generation gen.
+func generationSamples(samples []Sample, gen int) []Sample {
+	i := len(samples)
+	for i > 0 && samples[i-1].Generation == gen {
+		i--
+	}
+	return samples[i:]
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// Source feeds the uploads with existing data instead of generated
+// payloads, one upload per object. The run ends once the source is drained.
+type Source struct {
+	S3    *S3Source    `json:"s3"`
+	URLs  *URLSource   `json:"urls"`
+	Stdin *StdinSource `json:"stdin"`
+}
+
+// object is one piece of data read from a source.
+type object struct {
+	name string
+	data []byte
+}
+
+// objectSource yields the objects of a source, io.EOF once it is drained.
+type objectSource interface {
+	next(ctx context.Context) (object, error)
+}
+
+func openSource(f io.Writer, s *Source) (objectSource, error) {
+	switch {
+	case s.S3 != nil:
+		return newS3Objects(*s.S3)
+	case s.URLs != nil:
+		return newURLObjects(f, *s.URLs)
+	case s.Stdin != nil:
+		return newStdinObjects(*s.Stdin), nil
+	default:
+		return nil, fmt.Errorf("no source configured")
+	}
+}
+
+// validate checks the source settings without reading from it.
+func (s *Source) validate() error {
+	n := 0
+	if s.S3 != nil {
+		n++
+		err := s.S3.validate()
+		if err != nil {
+			return fmt.Errorf("s3: %w", err)
+		}
+	}
+	if s.URLs != nil {
+		n++
+		err := s.URLs.validate()
+		if err != nil {
+			return fmt.Errorf("urls: %w", err)
+		}
+	}
+	if s.Stdin != nil {
+		n++
+		err := s.Stdin.validate()
+		if err != nil {
+			return fmt.Errorf("stdin: %w", err)
+		}
+	}
+	if n != 1 {
+		return fmt.Errorf("need exactly one source")
+	}
+	return nil
+}
+
+// ingest queues the objects of the experiment's source.
+func (p *pipeline) ingest() {
+	defer p.wg.Done()
+	defer close(p.queue)
+	src, err := openSource(p.f, p.exp.Source)
+	if err != nil {
+		p.send(uploadResult{err: fmt.Errorf("open source: %w", err)})
+		return
+	}
+	objects := 0
+	for {
+		reading := clock.Now()
+		o, err := src.next(p.ctx)
+		if err == io.EOF {
+			log(p.f, "source drained objects=", objects)
+			return
+		}
+		if err != nil {
+			select {
+			case <-p.done:
+			default:
+				p.send(uploadResult{err: fmt.Errorf("read source: %w", err)})
+			}
+			return
+		}
+		if len(o.data) == 0 {
+			log(p.f, "source skipping empty object=", o.name)
+			continue
+		}
+		objects++
+		log(p.f, "source object=", o.name, " size=", prettyByteSize(len(o.data)))
+		select {
+		case p.queue <- payload{data: o.data, size: len(o.data), generate: since(reading)}:
+		case <-p.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"time"
+)
+
+// Stall is a dead-man timer: when no upload finished for Window while
+// uploads are in flight, they are canceled and the stall is logged.
+// OnStall "abort" (default) then ends the run, "retry" uploads the
+// canceled payloads again.
+type Stall struct {
+	Window  duration `json:"window"`
+	OnStall string   `json:"onStall"`
+}
+
+const (
+	stallAbort = "abort"
+	stallRetry = "retry"
+)
+
+// logStall records what the run looked like when it stalled.
+func logStall(f io.Writer, p *pipeline, res *Result, since time.Duration) {
+	var last time.Duration
+	if len(res.Samples) > 0 {
+		last = res.Samples[len(res.Samples)-1].Latency
+	}
+	log(f, "stall sinceLastUpload=", since.Round(time.Second), " inFlight=", p.inFlight(), " queue=", p.depth(),
+		" uploads=", res.Uploads, " failures=", res.Failures, " lastLatency=", last.Round(time.Millisecond), " goroutines=", runtime.NumGoroutine())
+}
+
+func validateStall(s *Stall) error {
+	if s.Window <= 0 {
+		return fmt.Errorf("stall needs a window")
+	}
+	switch s.OnStall {
+	case "", stallAbort, stallRetry:
+		return nil
+	default:
+		return fmt.Errorf("unknown stall policy %q", s.OnStall)
+	}
+}
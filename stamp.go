@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+	"golang.org/x/crypto/sha3"
+)
+
+const stampSize = 32 + 8 + 8 + 65
+
+var errBucketFull = errors.New("bucket full")
+
+// localStampUploader splits the payload into chunks itself and uploads each
+// one through /chunks with a stamp signed by the batch owner key, keeping its
+// own bucket counters instead of relying on the node's stamper.
+type localStampUploader struct {
+	client  *Client
+	exp     Experiment
+	key     *secp256k1.PrivateKey
+	batchID []byte
+
+	bucketDepth int
+	capacity    int
+	immutable   bool
+	buckets     []int
+}
+
+func newLocalStampUploader(c *Client, exp Experiment) (*localStampUploader, error) {
+	k, err := hex.DecodeString(exp.OwnerKey)
+	if err != nil || len(k) != 32 {
+		return nil, errors.New("invalid owner key")
+	}
+	id, err := hex.DecodeString(exp.BatchID)
+	if err != nil || len(id) != 32 {
+		return nil, errors.New("invalid batch id")
+	}
+	return &localStampUploader{
+		client:  c,
+		exp:     exp,
+		key:     secp256k1.PrivKeyFromBytes(k),
+		batchID: id,
+	}, nil
+}
+
+// init loads the batch parameters and continues the bucket counters from
+// the collisions the node already reports for the batch.
+func (u *localStampUploader) init() error {
+	batch, err := u.client.getStamp(u.exp.BatchID)
+	if err != nil {
+		return fmt.Errorf("get stamp: %w", err)
+	}
+	buckets, err := u.client.getBuckets(u.exp.BatchID)
+	if err != nil {
+		return fmt.Errorf("get buckets: %w", err)
+	}
+	u.bucketDepth = batch.BucketDepth
+	u.capacity = batch.capacity()
+	u.immutable = batch.Immutable
+	u.buckets = make([]int, 1<<batch.BucketDepth)
+	for _, b := range buckets.Buckets {
+		if b.BucketID < len(u.buckets) {
+			u.buckets[b.BucketID] = b.Collisions
+		}
+	}
+	return nil
+}
+
+func (u *localStampUploader) Payload(size int) ([]byte, error) {
+	return generateFile(size, u.exp.Random)
+}
+
+func (u *localStampUploader) Upload(ctx context.Context, payload []byte, tag uint64, _ string) (*uploadResponse, error) {
+	if u.buckets == nil {
+		err := u.init()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var root []byte
+	err := splitChunks(payload, func(addr, chunk []byte) error {
+		root = addr
+		return u.uploadChunk(ctx, addr, chunk, tag)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &uploadResponse{Reference: hex.EncodeToString(root)}, nil
+}
+
+func (u *localStampUploader) Chunks(size int) int {
+	return estimateChunks(size, false)
+}
+
+// utilization is the fullest bucket as counted by the local stamper.
+func (u *localStampUploader) utilization() int {
+	max := 0
+	for _, c := range u.buckets {
+		if c > max {
+			max = c
+		}
+	}
+	return max
+}
+
+func (u *localStampUploader) uploadChunk(ctx context.Context, addr, chunk []byte, tag uint64) error {
+	stamp, err := u.stamp(addr)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.client.apiURL+"/chunks", bytes.NewReader(chunk))
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Content-Type", "application/octet-stream")
+	req.Header.Add("Swarm-Postage-Stamp", hex.EncodeToString(stamp))
+	if tag != 0 {
+		req.Header.Add("Swarm-Tag", fmt.Sprint(tag))
+	}
+	for k, v := range u.exp.Headers {
+		req.Header.Set(k, v)
+	}
+
+	impair(req, u.exp.Impair)
+	res, err := u.client.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusCreated && res.StatusCode != http.StatusOK {
+		return fmt.Errorf("upload chunk %x: %w", addr, &statusError{code: res.StatusCode, body: string(body)})
+	}
+	var upload uploadResponse
+	err = json.Unmarshal(body, &upload)
+	if err != nil {
+		return err
+	}
+	if upload.Reference != hex.EncodeToString(addr) {
+		return fmt.Errorf("upload chunk %x: node returned address %s", addr, upload.Reference)
+	}
+	return nil
+}
+
+// stamp returns the marshalled stamp for the chunk address: batch id, index,
+// timestamp and the owner's signature over all of them.
+func (u *localStampUploader) stamp(addr []byte) ([]byte, error) {
+	bucket := int(binary.BigEndian.Uint32(addr) >> (32 - u.bucketDepth))
+	count := u.buckets[bucket]
+	if count >= u.capacity {
+		if u.immutable {
+			return nil, fmt.Errorf("%w: bucket %d", errBucketFull, bucket)
+		}
+		count %= u.capacity
+	}
+	u.buckets[bucket]++
+
+	index := make([]byte, 8)
+	binary.BigEndian.PutUint32(index, uint32(bucket))
+	binary.BigEndian.PutUint32(index[4:], uint32(count))
+	ts := make([]byte, 8)
+	binary.BigEndian.PutUint64(ts, uint64(time.Now().UnixNano()))
+
+	digest := keccak256(addr, u.batchID, index, ts)
+	prefixed := keccak256([]byte("\x19Ethereum Signed Message:\n32"), digest)
+	sig := ecdsa.SignCompact(u.key, prefixed, false)
+	// ethereum signatures carry the recovery id at the end
+	sig = append(sig[1:], sig[0])
+
+	stamp := make([]byte, 0, stampSize)
+	stamp = append(stamp, u.batchID...)
+	stamp = append(stamp, index...)
+	stamp = append(stamp, ts...)
+	return append(stamp, sig...), nil
+}
+
+// splitChunks splits data into content addressed chunks the way the node's
+// splitter does and calls fn with each chunk, span prefixed, root last.
+func splitChunks(data []byte, fn func(addr, chunk []byte) error) error {
+	type ref struct {
+		addr []byte
+		span uint64
+	}
+	var level []ref
+	for i := 0; i < len(data) || i == 0; i += chunkSize {
+		end := i + chunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		chunk := newChunk(uint64(end-i), data[i:end])
+		addr := chunkAddress(chunk)
+		err := fn(addr, chunk)
+		if err != nil {
+			return err
+		}
+		level = append(level, ref{addr, uint64(end - i)})
+	}
+
+	for len(level) > 1 {
+		var next []ref
+		for i := 0; i < len(level); i += branches {
+			end := i + branches
+			if end > len(level) {
+				end = len(level)
+			}
+			// a single trailing reference is carried up without wrapping
+			if end-i == 1 {
+				next = append(next, level[i])
+				continue
+			}
+			var payload []byte
+			var span uint64
+			for _, r := range level[i:end] {
+				payload = append(payload, r.addr...)
+				span += r.span
+			}
+			chunk := newChunk(span, payload)
+			addr := chunkAddress(chunk)
+			err := fn(addr, chunk)
+			if err != nil {
+				return err
+			}
+			next = append(next, ref{addr, span})
+		}
+		level = next
+	}
+	return nil
+}
+
+func newChunk(span uint64, payload []byte) []byte {
+	chunk := make([]byte, spanSize, spanSize+len(payload))
+	binary.LittleEndian.PutUint64(chunk, span)
+	return append(chunk, payload...)
+}
+
+// chunkAddress is the BMT hash of a span prefixed chunk.
+func chunkAddress(chunk []byte) []byte {
+	level := make([]byte, chunkSize)
+	copy(level, chunk[spanSize:])
+	for len(level) > refSize {
+		next := make([]byte, 0, len(level)/2)
+		for i := 0; i < len(level); i += 2 * refSize {
+			next = append(next, keccak256(level[i:i+2*refSize])...)
+		}
+		level = next
+	}
+	return keccak256(chunk[:spanSize], level)
+}
+
+func keccak256(data ...[]byte) []byte {
+	h := sha3.NewLegacyKeccak256()
+	for _, d := range data {
+		h.Write(d)
+	}
+	return h.Sum(nil)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+)
+
+func TestSplitChunks(t *testing.T) {
+	tests := []struct {
+		size int
+		// span is the span of the root chunk
+		span uint64
+	}{
+		{0, 0},
+		{100, 100},
+		{chunkSize, chunkSize},
+		{chunkSize + 1, chunkSize + 1},
+		{branches * chunkSize, branches * chunkSize},
+		{branches*chunkSize + 1, branches*chunkSize + 1},
+		{3*branches*chunkSize + 5, 3*branches*chunkSize + 5},
+	}
+	for _, tt := range tests {
+		data := make([]byte, tt.size)
+		for i := range data {
+			data[i] = byte(i * 7)
+		}
+		var addrs [][]byte
+		var root []byte
+		err := splitChunks(data, func(addr, chunk []byte) error {
+			if len(chunk) > spanSize+chunkSize {
+				t.Errorf("size %d: chunk of %d bytes", tt.size, len(chunk))
+			}
+			if !bytes.Equal(chunkAddress(chunk), addr) {
+				t.Errorf("size %d: address doesn't match the chunk", tt.size)
+			}
+			addrs = append(addrs, addr)
+			root = chunk
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := estimateChunks(tt.size, false); len(addrs) != want {
+			t.Errorf("size %d: %d chunks, estimated %d", tt.size, len(addrs), want)
+		}
+		if span := binary.LittleEndian.Uint64(root); span != tt.span {
+			t.Errorf("size %d: root span %d, want %d", tt.size, span, tt.span)
+		}
+	}
+
+	a, b := []byte("same payload"), []byte("same payload")
+	var first, second []byte
+	splitChunks(a, func(addr, _ []byte) error { first = addr; return nil })
+	splitChunks(b, func(addr, _ []byte) error { second = addr; return nil })
+	if !bytes.Equal(first, second) {
+		t.Error("equal payloads got different addresses")
+	}
+}
+
+func TestStampSigning(t *testing.T) {
+	key := secp256k1.PrivKeyFromBytes(bytes.Repeat([]byte{1}, 32))
+	batchID := bytes.Repeat([]byte{0xab}, 32)
+	// bucket 0x8001 of a bucket depth of 16
+	addr := append([]byte{0x80, 0x01}, bytes.Repeat([]byte{0xff}, 30)...)
+
+	tests := []struct {
+		immutable bool
+		count     int
+		// index is the slot the chunk is stamped into, -1 for a full bucket
+		index int
+	}{
+		{true, 0, 0},
+		{true, 3, 3},
+		{true, 4, -1},
+		{false, 4, 0},
+		{false, 6, 2},
+	}
+	for _, tt := range tests {
+		u := &localStampUploader{key: key, batchID: batchID, bucketDepth: 16, capacity: 4, immutable: tt.immutable, buckets: make([]int, 1<<16)}
+		u.buckets[0x8001] = tt.count
+		stamp, err := u.stamp(addr)
+		if tt.index < 0 {
+			if !errors.Is(err, errBucketFull) {
+				t.Errorf("immutable=%v count=%d: got %v, want a full bucket", tt.immutable, tt.count, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(stamp) != stampSize || !bytes.Equal(stamp[:32], batchID) {
+			t.Fatalf("immutable=%v count=%d: malformed stamp %x", tt.immutable, tt.count, stamp)
+		}
+		index := stamp[32:40]
+		if bucket, slot := binary.BigEndian.Uint32(index), binary.BigEndian.Uint32(index[4:]); bucket != 0x8001 || int(slot) != tt.index {
+			t.Errorf("immutable=%v count=%d: index %d/%d, want %d/%d", tt.immutable, tt.count, bucket, slot, 0x8001, tt.index)
+		}
+		if u.buckets[0x8001] != tt.count+1 {
+			t.Errorf("immutable=%v count=%d: bucket counter %d", tt.immutable, tt.count, u.buckets[0x8001])
+		}
+
+		sig := stamp[48:]
+		digest := keccak256(addr, batchID, index, stamp[40:48])
+		prefixed := keccak256([]byte("\x19Ethereum Signed Message:\n32"), digest)
+		pub, _, err := ecdsa.RecoverCompact(append([]byte{sig[64]}, sig[:64]...), prefixed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !pub.IsEqual(key.PubKey()) {
+			t.Errorf("immutable=%v count=%d: stamp isn't signed by the owner key", tt.immutable, tt.count)
+		}
+	}
+}
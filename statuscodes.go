@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// statusCounter counts the status codes of the node's responses to the
+// requests of one run, "error" for requests that got no response.
+type statusCounter struct {
+	next http.RoundTripper
+
+	mu    sync.Mutex
+	codes map[string]int
+}
+
+func (s *statusCounter) RoundTrip(req *http.Request) (*http.Response, error) {
+	next := s.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	res, err := next.RoundTrip(req)
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(res.StatusCode)
+	}
+	s.mu.Lock()
+	if s.codes == nil {
+		s.codes = map[string]int{}
+	}
+	s.codes[code]++
+	s.mu.Unlock()
+	return res, err
+}
+
+func (s *statusCounter) counts() map[string]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	codes := make(map[string]int, len(s.codes))
+	for k, v := range s.codes {
+		codes[k] = v
+	}
+	return codes
+}
+
+// counting returns a copy of c whose responses s counts.
+func (c *Client) counting(s *statusCounter) *Client {
+	cc := *c
+	s.next = c.http.Transport
+	cc.http = &http.Client{Transport: s, Timeout: c.http.Timeout}
+	return &cc
+}
+
+// formatStatusCodes lists the counts by code, e.g. "201=40 429=2".
+func formatStatusCodes(codes map[string]int) string {
+	keys := make([]string, 0, len(codes))
+	for k := range codes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(k + "=" + strconv.Itoa(codes[k]))
+	}
+	return b.String()
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+)
+
+const defaultStdinSize = 1 << 20
+
+// StdinSource cuts the stream on stdin into uploads of Size bytes, 1MiB by
+// default, so any producer can drive the run. The last upload takes what
+// is left when the stream ends.
+type StdinSource struct {
+	Size int `json:"size"`
+}
+
+func (s StdinSource) validate() error {
+	if s.Size < 0 {
+		return fmt.Errorf("negative size")
+	}
+	return nil
+}
+
+type stdinObjects struct {
+	r    *bufio.Reader
+	size int
+	read int64
+}
+
+func newStdinObjects(cfg StdinSource) *stdinObjects {
+	size := cfg.Size
+	if size <= 0 {
+		size = defaultStdinSize
+	}
+	return &stdinObjects{r: bufio.NewReaderSize(os.Stdin, size), size: size}
+}
+
+// next blocks until a full upload arrived or the stream ended. Reads can't
+// be canceled, a stopped run leaves the read pending.
+func (s *stdinObjects) next(context.Context) (object, error) {
+	b := make([]byte, s.size)
+	n, err := io.ReadFull(s.r, b)
+	if err == io.EOF {
+		return object{}, io.EOF
+	}
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return object{}, err
+	}
+	o := object{name: fmt.Sprintf("stdin@%d", s.read), data: b[:n]}
+	s.read += int64(n)
+	return o, nil
+}
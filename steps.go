@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+// UtilizationStep is what was uploaded between two utilization levels.
+// Uploads that raised the utilization by more than one level give a single
+// step spanning them.
+type UtilizationStep struct {
+	From   int `json:"from"`
+	To     int `json:"to"`
+	Bytes  int `json:"bytes"`
+	Chunks int `json:"chunks"`
+	// Generation is the batch of a soak run the step was in.
+	Generation int `json:"generation,omitempty"`
+}
+
+// perLevel is the bytes uploaded per utilization level of the step.
+func (s UtilizationStep) perLevel() int {
+	return s.Bytes / (s.To - s.From)
+}
+
+type stepTracker struct {
+	level         int
+	bytes, chunks int
+}
+
+func newStepTracker(batch *Batch) *stepTracker {
+	return &stepTracker{level: batch.Utilization}
+}
+
+// observe takes the utilization after an upload along with the bytes and
+// chunks uploaded to the batch so far, and returns the step it completed.
+func (t *stepTracker) observe(f io.Writer, utilization, bytes, chunks, generation int) (UtilizationStep, bool) {
+	if utilization <= t.level {
+		return UtilizationStep{}, false
+	}
+	s := UtilizationStep{From: t.level, To: utilization, Bytes: bytes - t.bytes, Chunks: chunks - t.chunks, Generation: generation}
+	t.level, t.bytes, t.chunks = utilization, bytes, chunks
+	log(f, "utilization step=", s.From, "->", s.To, " bytes=", prettyByteSize(s.Bytes), " chunks=", s.Chunks, " bytesPerLevel=", prettyByteSize(s.perLevel()))
+	return s, true
+}
+
+// reset starts over with the next batch of a soak run.
+func (t *stepTracker) reset(batch *Batch) {
+	*t = stepTracker{level: batch.Utilization}
+}
+
+func writeSteps(w io.Writer, name string, steps []UtilizationStep) error {
+	fmt.Fprintln(w, name, "utilization steps")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "GENERATION\tSTEP\tBYTES\tCHUNKS\tBYTES PER LEVEL")
+	for _, s := range steps {
+		fmt.Fprintf(tw, "%d\t%d->%d\t%s\t%d\t%s\n", s.Generation, s.From, s.To, prettyByteSize(s.Bytes), s.Chunks, prettyByteSize(s.perLevel()))
+	}
+	return tw.Flush()
+}
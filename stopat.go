@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// percent is a share of the batch capacity, written as 50 or "50%".
+type percent float64
+
+func parsePercent(s string) (percent, error) {
+	v, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(s), "%")), 64)
+	if err != nil || v <= 0 || v > 100 {
+		return 0, fmt.Errorf("invalid percentage %q, want one in (0, 100]", s)
+	}
+	return percent(v), nil
+}
+
+func (p *percent) UnmarshalJSON(b []byte) error {
+	var s string
+	if json.Unmarshal(b, &s) != nil {
+		s = string(b)
+	}
+	if s == "0" {
+		// unset, as results write it
+		*p = 0
+		return nil
+	}
+	v, err := parsePercent(s)
+	if err != nil {
+		return err
+	}
+	*p = v
+	return nil
+}
+
+func (p percent) String() string {
+	return strconv.FormatFloat(float64(p), 'f', -1, 64) + "%"
+}
+
+// Set implements flag.Value.
+func (p *percent) Set(s string) error {
+	v, err := parsePercent(s)
+	if err != nil {
+		return err
+	}
+	*p = v
+	return nil
+}
+
+// reached reports whether the fullest bucket of the batch holds p of its
+// capacity.
+func (p percent) reached(b *Batch) bool {
+	capacity := fullUtilization
+	if b.Depth > 0 {
+		capacity = b.capacity()
+	}
+	return b.Utilization >= p.target(capacity)
+}
+
+// target is the utilization p of capacity amounts to, at least 1.
+func (p percent) target(capacity int) int {
+	t := int(math.Ceil(float64(p) / 100 * float64(capacity)))
+	if t < 1 {
+		t = 1
+	}
+	return t
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// websocketGUID is appended to the handshake key for the accept header,
+// RFC 6455 section 1.3.
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// websocket opcodes
+const (
+	wsText   = 0x1
+	wsBinary = 0x2
+	wsClose  = 0x8
+	wsPing   = 0x9
+	wsPong   = 0xa
+)
+
+// streamUploader splits the payload into chunks itself and sends them over
+// the node's /chunks/stream WebSocket, one message per chunk, to compare
+// streamed chunk ingestion with the HTTP upload endpoints. The node stamps
+// every chunk with the batch given in the handshake.
+type streamUploader struct {
+	client *Client
+	exp    Experiment
+}
+
+func (u *streamUploader) Payload(size int) ([]byte, error) {
+	return generateFile(size, u.exp.Random)
+}
+
+func (u *streamUploader) Upload(ctx context.Context, payload []byte, tag uint64, _ string) (*uploadResponse, error) {
+	ws, res, err := u.dial(ctx, tag)
+	if err != nil {
+		return nil, err
+	}
+	defer ws.Close()
+	// a canceled upload unblocks the reads and writes on the connection
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			ws.Close()
+		case <-done:
+		}
+	}()
+
+	var root []byte
+	err = splitChunks(payload, func(addr, chunk []byte) error {
+		root = addr
+		err := writeFrame(ws, wsBinary, chunk)
+		if err != nil {
+			return fmt.Errorf("stream chunk %x: %w", addr, err)
+		}
+		err = readAck(ws)
+		if err != nil {
+			return fmt.Errorf("stream chunk %x: %w", addr, err)
+		}
+		return nil
+	})
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		return nil, err
+	}
+	_ = writeFrame(ws, wsClose, []byte{0x03, 0xe8})
+	return &uploadResponse{Reference: hex.EncodeToString(root), RequestID: nodeRequestID(res.Header)}, nil
+}
+
+func (u *streamUploader) Chunks(size int) int {
+	return estimateChunks(size, false)
+}
+
+// dial opens the chunk stream. The transport hands over the connection of
+// a 101 response as its body.
+func (u *streamUploader) dial(ctx context.Context, tag uint64) (io.ReadWriteCloser, *http.Response, error) {
+	key := make([]byte, 16)
+	_, err := rand.Read(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.client.apiURL+"/chunks/stream", nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", base64.StdEncoding.EncodeToString(key))
+	req.Header.Set("Swarm-Postage-Batch-Id", u.exp.BatchID)
+	if tag != 0 {
+		req.Header.Set("Swarm-Tag", strconv.FormatUint(tag, 10))
+	}
+	for k, v := range u.exp.Headers {
+		req.Header.Set(k, v)
+	}
+	injectTrace(req)
+
+	res, err := u.client.http.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		defer res.Body.Close()
+		body, _ := io.ReadAll(res.Body)
+		return nil, nil, fmt.Errorf("open chunk stream: %w", &statusError{code: res.StatusCode, body: string(body)})
+	}
+	ws, ok := res.Body.(io.ReadWriteCloser)
+	if !ok {
+		res.Body.Close()
+		return nil, nil, fmt.Errorf("open chunk stream: connection not writable")
+	}
+	sum := sha1.Sum([]byte(req.Header.Get("Sec-WebSocket-Key") + websocketGUID))
+	if res.Header.Get("Sec-WebSocket-Accept") != base64.StdEncoding.EncodeToString(sum[:]) {
+		ws.Close()
+		return nil, nil, fmt.Errorf("open chunk stream: bad handshake")
+	}
+	return ws, res, nil
+}
+
+// writeFrame writes a single, masked frame as clients must.
+func writeFrame(w io.Writer, opcode byte, payload []byte) error {
+	header := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n < 126:
+		header = append(header, 0x80|byte(n))
+	case n <= 0xffff:
+		header = append(header, 0x80|126, byte(n>>8), byte(n))
+	default:
+		var b [8]byte
+		binary.BigEndian.PutUint64(b[:], uint64(n))
+		header = append(append(header, 0x80|127), b[:]...)
+	}
+	mask := make([]byte, 4)
+	_, err := rand.Read(mask)
+	if err != nil {
+		return err
+	}
+	header = append(header, mask...)
+	frame := make([]byte, len(header)+len(payload))
+	copy(frame, header)
+	for i, b := range payload {
+		frame[len(header)+i] = b ^ mask[i%4]
+	}
+	_, err = w.Write(frame)
+	return err
+}
+
+// readFrame reads one frame from the node, which doesn't mask them.
+func readFrame(r io.Reader) (byte, []byte, error) {
+	var h [2]byte
+	_, err := io.ReadFull(r, h[:])
+	if err != nil {
+		return 0, nil, err
+	}
+	opcode := h[0] & 0x0f
+	n := uint64(h[1] & 0x7f)
+	switch n {
+	case 126:
+		var b [2]byte
+		_, err = io.ReadFull(r, b[:])
+		n = uint64(binary.BigEndian.Uint16(b[:]))
+	case 127:
+		var b [8]byte
+		_, err = io.ReadFull(r, b[:])
+		n = binary.BigEndian.Uint64(b[:])
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	if h[1]&0x80 != 0 || n > chunkSize+spanSize {
+		return 0, nil, fmt.Errorf("unexpected frame from the node")
+	}
+	payload := make([]byte, n)
+	_, err = io.ReadFull(r, payload)
+	return opcode, payload, err
+}
+
+// readAck waits for the node's empty binary message that acknowledges a
+// chunk, answering pings on the way. The node closes the stream with the
+// reason when it rejects a chunk.
+func readAck(ws io.ReadWriter) error {
+	for {
+		opcode, payload, err := readFrame(ws)
+		if err != nil {
+			return err
+		}
+		switch opcode {
+		case wsBinary:
+			if len(payload) > 0 {
+				return fmt.Errorf("unexpected answer %x", payload)
+			}
+			return nil
+		case wsText:
+			return fmt.Errorf("node: %s", strings.TrimSpace(string(payload)))
+		case wsPing:
+			err = writeFrame(ws, wsPong, payload)
+			if err != nil {
+				return err
+			}
+		case wsPong:
+		case wsClose:
+			if len(payload) < 2 {
+				return fmt.Errorf("node closed the stream")
+			}
+			return fmt.Errorf("node closed the stream: %d %s", binary.BigEndian.Uint16(payload), payload[2:])
+		default:
+			return fmt.Errorf("unexpected opcode %d", opcode)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// SweepClass is what the uploads of one payload size of a sweep consumed.
+type SweepClass struct {
+	Size    int `json:"size"`
+	Uploads int `json:"uploads"`
+	Bytes   int `json:"bytes"`
+	// DataChunks are the data chunks of the uploads, Chunks all chunks the
+	// node split them into, including the intermediate ones.
+	DataChunks int   `json:"dataChunks"`
+	Chunks     int64 `json:"chunks"`
+	// Utilization are the utilization steps observed after uploads of
+	// this size.
+	Utilization int `json:"utilization"`
+}
+
+// overhead is the ratio of all chunks to the data chunks.
+func (s SweepClass) overhead() string {
+	return ratio(s.Chunks, int64(s.DataChunks))
+}
+
+func validateSweep(sizes []int, workload string) error {
+	seen := map[int]bool{}
+	for _, s := range sizes {
+		if s <= 0 {
+			return fmt.Errorf("sweep sizes need to be positive")
+		}
+		if workload == workloadPss && s > pssMaxPayload {
+			return fmt.Errorf("sweep size %d exceeds the pss payload limit", s)
+		}
+		if seen[s] {
+			return fmt.Errorf("sweep size %d listed twice", s)
+		}
+		seen[s] = true
+	}
+	return nil
+}
+
+type sweep struct {
+	classes []SweepClass
+}
+
+func newSweep(sizes []int) *sweep {
+	s := &sweep{}
+	for _, size := range sizes {
+		s.classes = append(s.classes, SweepClass{Size: size})
+	}
+	return s
+}
+
+// observe attributes an upload and the utilization change seen right after
+// it to the upload's size class.
+func (s *sweep) observe(size int, split int64, delta int) {
+	for i := range s.classes {
+		c := &s.classes[i]
+		if c.Size != size {
+			continue
+		}
+		c.Uploads++
+		c.Bytes += size
+		c.DataChunks += (size + chunkSize - 1) / chunkSize
+		c.Chunks += split
+		if delta > 0 {
+			c.Utilization += delta
+		}
+		return
+	}
+}
+
+func (s *sweep) finish(f io.Writer) []SweepClass {
+	for _, c := range s.classes {
+		perStep := "-"
+		if c.Utilization > 0 {
+			perStep = prettyByteSize(c.Bytes / c.Utilization)
+		}
+		log(f, "sweep size=", prettyByteSize(c.Size), " uploads=", c.Uploads, " bytes=", prettyByteSize(c.Bytes), " dataChunks=", c.DataChunks,
+			" chunks=", c.Chunks, " overhead=", c.overhead(), " utilization=", c.Utilization, " bytesPerStep=", perStep)
+	}
+	return s.classes
+}
+
+func formatSweep(sizes []int) string {
+	s := ""
+	for i, size := range sizes {
+		if i > 0 {
+			s += ","
+		}
+		s += prettyByteSize(size)
+	}
+	return s
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// notifier sends sd_notify messages to the service manager when the tool
+// runs as a systemd service, so a Type=notify unit knows when the daemon is
+// up and a WatchdogSec unit restarts it when the run loop hangs. All
+// methods are no-ops outside systemd.
+type notifier struct {
+	socket string
+	// watchdog is the unit's watchdog timeout, 0 when disabled
+	watchdog time.Duration
+}
+
+var systemd = newNotifier()
+
+func newNotifier() *notifier {
+	n := &notifier{socket: os.Getenv("NOTIFY_SOCKET")}
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return n
+	}
+	// the watchdog may be meant for another process of the unit
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return n
+	}
+	n.watchdog = time.Duration(usec) * time.Microsecond
+	return n
+}
+
+func (n *notifier) notify(state string) {
+	if n.socket == "" {
+		return
+	}
+	addr := &net.UnixAddr{Name: n.socket, Net: "unixgram"}
+	if addr.Name[0] == '@' {
+		// abstract socket
+		addr.Name = "\x00" + addr.Name[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, addr)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	_, _ = conn.Write([]byte(state))
+}
+
+func (n *notifier) ready() {
+	n.notify("READY=1")
+}
+
+func (n *notifier) status(s string) {
+	n.notify("STATUS=" + s)
+}
+
+// alive resets the watchdog, called with every heartbeat and from the
+// loops that wait for the node.
+func (n *notifier) alive() {
+	if n.watchdog > 0 {
+		n.notify("WATCHDOG=1")
+	}
+}
+
+// heartbeat returns the heartbeat interval of an experiment, shortened to
+// half the watchdog timeout so the beats keep the watchdog from firing.
+func (n *notifier) heartbeat(d duration) time.Duration {
+	hb := time.Duration(d)
+	if n.watchdog > 0 && (hb == 0 || hb > n.watchdog/2) {
+		hb = n.watchdog / 2
+	}
+	return hb
+}
+
+// keepalive resets the watchdog for the rest of the process, once the
+// experiments are over and nothing can hang anymore.
+func (n *notifier) keepalive() {
+	if n.watchdog <= 0 {
+		return
+	}
+	t := time.NewTicker(n.watchdog / 2)
+	defer t.Stop()
+	for range t.C {
+		n.alive()
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+type Tag struct {
+	UID    uint64 `json:"uid"`
+	Split  int64  `json:"split"`
+	Seen   int64  `json:"seen"`
+	Stored int64  `json:"stored"`
+	Sent   int64  `json:"sent"`
+	Synced int64  `json:"synced"`
+}
+
+func (c *Client) createTag() (*Tag, error) {
+	return c.doTag(http.MethodPost, c.apiURL+"/tags")
+}
+
+func (c *Client) getTag(uid uint64) (*Tag, error) {
+	return c.doTag(http.MethodGet, c.apiURL+"/tags/"+strconv.FormatUint(uid, 10))
+}
+
+func (c *Client) doTag(method, url string) (*Tag, error) {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusCreated {
+		return nil, fmt.Errorf("unexpected status %d: %s", res.StatusCode, body)
+	}
+
+	var tag Tag
+	err = json.Unmarshal(body, &tag)
+	if err != nil {
+		return nil, err
+	}
+	return &tag, nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Timing breaks an upload down into where its time went, to tell whether
+// the tool or the node is the bottleneck.
+type Timing struct {
+	// Generate is the time it took to generate the payload.
+	Generate time.Duration `json:"generate"`
+	// Send is the time spent writing the upload requests, Wait the time the
+	// node took to answer them.
+	Send time.Duration `json:"send"`
+	Wait time.Duration `json:"wait"`
+	// Receive is the rest of the upload, reading and parsing the responses
+	// and client side work like local stamping.
+	Receive time.Duration `json:"receive"`
+	// Tag is the time spent creating and reading the upload's tag.
+	Tag time.Duration `json:"tag"`
+}
+
+func (t *Timing) add(o Timing) {
+	t.Generate += o.Generate
+	t.Send += o.Send
+	t.Wait += o.Wait
+	t.Receive += o.Receive
+	t.Tag += o.Tag
+}
+
+func (t Timing) div(n int) Timing {
+	d := time.Duration(n)
+	return Timing{Generate: t.Generate / d, Send: t.Send / d, Wait: t.Wait / d, Receive: t.Receive / d, Tag: t.Tag / d}
+}
+
+func logTiming(f io.Writer, prefix string, t Timing) {
+	log(f, prefix, " generate=", t.Generate.Round(time.Microsecond), " send=", t.Send.Round(time.Microsecond), " wait=", t.Wait.Round(time.Microsecond),
+		" receive=", t.Receive.Round(time.Microsecond), " tag=", t.Tag.Round(time.Microsecond))
+}
+
+// requestTimer sums the send and wait times of the requests of one upload,
+// uploaders that stamp locally send one request per chunk.
+type requestTimer struct {
+	mu    sync.Mutex
+	start time.Time
+	wrote time.Time
+	send  time.Duration
+	wait  time.Duration
+}
+
+func (r *requestTimer) trace(ctx context.Context) context.Context {
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GetConn: func(string) {
+			r.mu.Lock()
+			r.start, r.wrote = clock.Now(), time.Time{}
+			r.mu.Unlock()
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			r.mu.Lock()
+			r.wrote = clock.Now()
+			r.send += r.wrote.Sub(r.start)
+			r.mu.Unlock()
+		},
+		GotFirstResponseByte: func() {
+			r.mu.Lock()
+			if !r.wrote.IsZero() {
+				r.wait += since(r.wrote)
+			}
+			r.mu.Unlock()
+		},
+	})
+}
+
+// timing splits the total time of the upload call.
+func (r *requestTimer) timing(total time.Duration) Timing {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t := Timing{Send: r.send, Wait: r.wait, Receive: total - r.send - r.wait}
+	if t.Receive < 0 {
+		t.Receive = 0
+	}
+	return t
+}
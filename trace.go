@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Trace replays recorded traffic instead of uploading at full speed. The
+// file is CSV with one operation per line: timestamp, size in bytes and
+// operation. Timestamps are seconds since the start of the trace or
+// RFC3339 times. Only uploads are replayed.
+type Trace struct {
+	File string `json:"file"`
+	// Speed scales the timing, 2 replays twice as fast. 0 keeps the
+	// original timing.
+	Speed float64 `json:"speed"`
+}
+
+const traceUpload = "upload"
+
+type traceEntry struct {
+	at   time.Duration
+	size int
+}
+
+// loadTrace reads the uploads of a trace with their offsets from the first
+// operation, and how many other operations it skipped.
+func loadTrace(path string) (entries []traceEntry, skipped int, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = 3
+	r.Comment = '#'
+	r.TrimLeadingSpace = true
+	var start time.Time
+	for line := 1; ; line++ {
+		rec, err := r.Read()
+		if err == io.EOF {
+			return entries, skipped, nil
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		at, abs, err := parseTraceTime(rec[0])
+		if err != nil {
+			return nil, 0, fmt.Errorf("line %d: %w", line, err)
+		}
+		if !abs.IsZero() {
+			if start.IsZero() {
+				start = abs
+			}
+			at = abs.Sub(start)
+		}
+		size, err := strconv.Atoi(rec[1])
+		if err != nil || size <= 0 {
+			return nil, 0, fmt.Errorf("line %d: invalid size %q", line, rec[1])
+		}
+		if !strings.EqualFold(rec[2], traceUpload) {
+			skipped++
+			continue
+		}
+		if len(entries) > 0 && at < entries[len(entries)-1].at {
+			return nil, 0, fmt.Errorf("line %d: timestamps out of order", line)
+		}
+		entries = append(entries, traceEntry{at: at, size: size})
+	}
+}
+
+func parseTraceTime(s string) (time.Duration, time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return 0, t, nil
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v < 0 {
+		return 0, time.Time{}, fmt.Errorf("invalid timestamp %q", s)
+	}
+	return time.Duration(v * float64(time.Second)), time.Time{}, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptrace"
+	"sync/atomic"
+	"time"
+)
+
+// Transport limits the connections of the experiment's own HTTP client.
+// Every experiment gets one, so a saturated node can't hold the
+// connections other experiments need.
+type Transport struct {
+	// MaxConnsPerHost caps the connections to the node, no cap when 0.
+	MaxConnsPerHost int `json:"maxConnsPerHost"`
+	// MaxIdleConnsPerHost are kept open between requests, the uploads run
+	// at once plus one for the batch polls by default.
+	MaxIdleConnsPerHost int `json:"maxIdleConnsPerHost"`
+	// IdleConnTimeout closes idle connections, 90s by default.
+	IdleConnTimeout duration `json:"idleConnTimeout"`
+}
+
+// ConnStats counts the connections of an experiment's client, labeled
+// with the experiment and node they belong to.
+type ConnStats struct {
+	Experiment string `json:"experiment"`
+	Node       string `json:"node"`
+	Opened     uint32 `json:"opened"`
+	Reused     uint32 `json:"reused"`
+}
+
+// connTracker counts the connections the requests got from the pool.
+type connTracker struct {
+	next  http.RoundTripper
+	stats *ConnStats
+}
+
+func (t *connTracker) RoundTrip(req *http.Request) (*http.Response, error) {
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				atomic.AddUint32(&t.stats.Reused, 1)
+			} else {
+				atomic.AddUint32(&t.stats.Opened, 1)
+			}
+		},
+	}
+	return t.next.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+}
+
+// isolated returns a copy of c with a transport of its own for exp,
+// counting its connections into stats. The simulated node keeps its
+// in-process transport.
+func (c *Client) isolated(exp Experiment, stats *ConnStats) *Client {
+	cc := *c
+	*stats = ConnStats{Experiment: exp.Name, Node: c.apiURL}
+	if nodeTransport != nil {
+		return &cc
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	var limits Transport
+	if exp.Transport != nil {
+		limits = *exp.Transport
+	}
+	t.MaxConnsPerHost = limits.MaxConnsPerHost
+	t.MaxIdleConnsPerHost = limits.MaxIdleConnsPerHost
+	if t.MaxIdleConnsPerHost == 0 {
+		t.MaxIdleConnsPerHost = exp.uploadSlots() + 1
+	}
+	if limits.IdleConnTimeout > 0 {
+		t.IdleConnTimeout = time.Duration(limits.IdleConnTimeout)
+	}
+	cc.http = &http.Client{Transport: &connTracker{next: t, stats: stats}, Timeout: c.http.Timeout}
+	return &cc
+}
+
+// close drops the idle connections of an isolated client.
+func (c *Client) close() {
+	if t, ok := c.http.Transport.(*connTracker); ok {
+		t.next.(*http.Transport).CloseIdleConnections()
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// Uploader sends one iteration of an experiment's workload to the node.
+// Payload generates the data of an iteration, so generation can run ahead
+// of the uploads.
+type Uploader interface {
+	Payload(size int) ([]byte, error)
+	Upload(ctx context.Context, payload []byte, tag uint64, history string) (*uploadResponse, error)
+	// Chunks estimates the number of chunks one upload of size produces.
+	Chunks(size int) int
+}
+
+const (
+	workloadBytes   = "bytes"
+	workloadFile    = "file"
+	workloadWebsite = "website"
+	workloadPss     = "pss"
+	workloadStream  = "stream"
+)
+
+// newUploader returns the uploader for the experiment's workload. c may be
+// nil to only validate the experiment.
+func newUploader(c *Client, exp Experiment) (Uploader, error) {
+	if exp.OwnerKey != "" {
+		if exp.Workload != workloadBytes || exp.Encrypt || exp.RedundancyLevel > 0 || exp.Act != nil {
+			return nil, fmt.Errorf("local stamping only supports plain bytes uploads")
+		}
+		return newLocalStampUploader(c, exp)
+	}
+	switch exp.Workload {
+	case "", workloadBytes:
+		return &bytesUploader{client: c, exp: exp}, nil
+	case workloadFile:
+		return &fileUploader{client: c, exp: exp}, nil
+	case workloadWebsite:
+		return &websiteUploader{client: c, exp: exp}, nil
+	case workloadStream:
+		if exp.Encrypt || exp.RedundancyLevel > 0 || exp.Act != nil {
+			return nil, fmt.Errorf("the chunk stream only takes plain chunks")
+		}
+		return &streamUploader{client: c, exp: exp}, nil
+	case workloadPss:
+		if exp.Pss == nil || exp.Pss.Topic == "" || exp.Pss.Targets == "" {
+			return nil, fmt.Errorf("pss workload needs a topic and targets")
+		}
+		return &pssUploader{client: c, exp: exp}, nil
+	default:
+		return nil, fmt.Errorf("unknown workload %q", exp.Workload)
+	}
+}
+
+// validReference reports whether ref is a hex encoded chunk address, or an
+// address with its decryption key for encrypted uploads.
+func validReference(ref string) bool {
+	if len(ref) != 2*refSize && len(ref) != 4*refSize {
+		return false
+	}
+	_, err := hex.DecodeString(ref)
+	return err == nil
+}
+
+// statusError is an upload the node answered with an error status.
+type statusError struct {
+	code int
+	body string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("unexpected status %d: %s", e.code, e.body)
+}
+
+// statusCode is the HTTP status of a failed upload, 0 when the upload
+// didn't get a response.
+func statusCode(err error) int {
+	var e *statusError
+	if errors.As(err, &e) {
+		return e.code
+	}
+	return 0
+}
+
+type uploadResponse struct {
+	Reference string `json:"reference"`
+	// History is the ACT history address, only set for ACT uploads.
+	History string `json:"-"`
+	// RequestID is the node's id of the upload request, if it tells.
+	RequestID string `json:"-"`
+}
+
+// nodeRequestHeaders are the response headers a node or a proxy in front of
+// it identifies a request with, in order of preference.
+var nodeRequestHeaders = []string{"X-Request-Id", "Request-Id", "X-Trace-Id", "Traceresponse", "Uber-Trace-Id"}
+
+// requestIDField is the log field of a request id, empty without one.
+func requestIDField(id string) string {
+	if id == "" {
+		return ""
+	}
+	return " requestID=" + id
+}
+
+func nodeRequestID(h http.Header) string {
+	for _, k := range nodeRequestHeaders {
+		if v := h.Get(k); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+type bytesUploader struct {
+	client *Client
+	exp    Experiment
+}
+
+func (u *bytesUploader) Payload(size int) ([]byte, error) {
+	return generateFile(size, u.exp.Random)
+}
+
+func (u *bytesUploader) Upload(ctx context.Context, payload []byte, tag uint64, history string) (*uploadResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.client.apiURL+"/bytes", uploadBody(ctx, payload))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(payload))
+	req.Header.Add("Content-Type", "application/octet-stream")
+	return u.client.upload(req, u.exp, tag, history)
+}
+
+func (u *bytesUploader) Chunks(size int) int {
+	return estimateChunks(size, u.exp.Encrypt)
+}
+
+// upload adds the headers shared by all upload endpoints and sends req.
+func (c *Client) upload(req *http.Request, exp Experiment, tag uint64, history string) (*uploadResponse, error) {
+	req.Header.Add("Swarm-Postage-Batch-Id", exp.BatchID)
+	req.Header.Add("Swarm-Deferred-Upload", strconv.FormatBool(exp.Deferred))
+	req.Header.Add("Swarm-Encrypt", strconv.FormatBool(exp.Encrypt))
+	if exp.RedundancyLevel > 0 {
+		req.Header.Add("Swarm-Redundancy-Level", strconv.Itoa(exp.RedundancyLevel))
+	}
+	if tag != 0 {
+		req.Header.Add("Swarm-Tag", strconv.FormatUint(tag, 10))
+	}
+	if exp.Act != nil {
+		req.Header.Add("Swarm-Act", "true")
+		if history != "" {
+			req.Header.Add("Swarm-Act-History-Address", history)
+		}
+	}
+	for k, v := range exp.Headers {
+		req.Header.Set(k, v)
+	}
+
+	impair(req, exp.Impair)
+	injectTrace(req)
+	res, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	requestID := nodeRequestID(res.Header)
+	if requestID != "" {
+		spanOf(req.Context()).set("bee.request_id", requestID)
+	}
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusCreated && res.StatusCode != http.StatusOK {
+		err = &statusError{code: res.StatusCode, body: string(body)}
+		if requestID != "" {
+			err = fmt.Errorf("request %s: %w", requestID, err)
+		}
+		return nil, err
+	}
+
+	var upload uploadResponse
+	err = json.Unmarshal(body, &upload)
+	if err != nil {
+		return nil, err
+	}
+	if !validReference(upload.Reference) {
+		return nil, fmt.Errorf("invalid reference %q", upload.Reference)
+	}
+	upload.History = res.Header.Get("Swarm-Act-History-Address")
+	upload.RequestID = requestID
+	return &upload, nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const defaultDownloadTimeout = 5 * time.Minute
+
+// URLSource downloads every URL and uploads what it got, to mirror a
+// dataset to Swarm. URLs that fail to download are logged and skipped.
+type URLSource struct {
+	List []string `json:"list"`
+	// File holds more URLs, one per line, blank lines and # comments are
+	// skipped.
+	File string `json:"file"`
+	// Timeout bounds every download, 5m by default.
+	Timeout duration `json:"timeout"`
+}
+
+func (s URLSource) validate() error {
+	if s.Timeout < 0 {
+		return fmt.Errorf("negative timeout")
+	}
+	urls, err := s.urls()
+	if err != nil {
+		return err
+	}
+	if len(urls) == 0 {
+		return fmt.Errorf("no urls")
+	}
+	for _, u := range urls {
+		p, err := url.Parse(u)
+		if err != nil || (p.Scheme != "http" && p.Scheme != "https") || p.Host == "" {
+			return fmt.Errorf("invalid url %q", u)
+		}
+	}
+	return nil
+}
+
+// urls is the list followed by the URLs of the file.
+func (s URLSource) urls() ([]string, error) {
+	urls := append([]string(nil), s.List...)
+	if s.File == "" {
+		return urls, nil
+	}
+	f, err := os.Open(s.File)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		urls = append(urls, line)
+	}
+	return urls, sc.Err()
+}
+
+type urlObjects struct {
+	urls    []string
+	timeout time.Duration
+	http    *http.Client
+	// f is where skipped downloads are logged
+	f io.Writer
+}
+
+func newURLObjects(f io.Writer, cfg URLSource) (*urlObjects, error) {
+	urls, err := cfg.urls()
+	if err != nil {
+		return nil, fmt.Errorf("urls: %w", err)
+	}
+	timeout := time.Duration(cfg.Timeout)
+	if timeout <= 0 {
+		timeout = defaultDownloadTimeout
+	}
+	return &urlObjects{urls: urls, timeout: timeout, http: &http.Client{}, f: f}, nil
+}
+
+func (s *urlObjects) next(ctx context.Context) (object, error) {
+	for len(s.urls) > 0 {
+		u := s.urls[0]
+		s.urls = s.urls[1:]
+		data, err := s.download(ctx, u)
+		if err == nil {
+			return object{name: u, data: data}, nil
+		}
+		if ctx.Err() != nil {
+			return object{}, ctx.Err()
+		}
+		log(s.f, "source skipping url=", u, ": ", err)
+	}
+	return object{}, io.EOF
+}
+
+func (s *urlObjects) download(ctx context.Context, u string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", res.StatusCode)
+	}
+	return io.ReadAll(res.Body)
+}
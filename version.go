@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type Health struct {
+	Status          string `json:"status"`
+	Version         string `json:"version"`
+	APIVersion      string `json:"apiVersion"`
+	DebugAPIVersion string `json:"debugApiVersion"`
+}
+
+type version [3]int
+
+func (v version) less(o version) bool {
+	for i := range v {
+		if v[i] != o[i] {
+			return v[i] < o[i]
+		}
+	}
+	return false
+}
+
+func (v version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v[0], v[1], v[2])
+}
+
+var (
+	minVersion = version{1, 17, 0}
+	// Bee 2.0 dropped the debug API, its endpoints moved to the API.
+	mergedAPIVersion = version{2, 0, 0}
+	// minimum node versions for optional upload features
+	redundancyVersion = version{2, 0, 0}
+	actVersion        = version{2, 2, 0}
+)
+
+// parseVersion parses the leading major.minor.patch of a Bee version string
+// such as "2.2.0-7fafe8e2".
+func parseVersion(s string) (version, error) {
+	var v version
+	s = strings.TrimPrefix(s, "v")
+	if i := strings.IndexAny(s, "-+"); i >= 0 {
+		s = s[:i]
+	}
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 {
+		return v, fmt.Errorf("invalid version %q", s)
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return v, fmt.Errorf("invalid version %q", s)
+		}
+		v[i] = n
+	}
+	return v, nil
+}
+
+func (c *Client) getHealth(url string) (*Health, error) {
+	req, err := http.NewRequest(http.MethodGet, url+"/health", nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d: %s", res.StatusCode, body)
+	}
+
+	var health Health
+	err = json.Unmarshal(body, &health)
+	if err != nil {
+		return nil, err
+	}
+	return &health, nil
+}
+
+// detectVersion queries the node version and adapts the client to it. Older
+// nodes only serve /health on the debug API.
+func (c *Client) detectVersion() (*Health, error) {
+	health, err := c.getHealth(c.apiURL)
+	if err != nil {
+		health, err = c.getHealth(c.debugURL)
+		if err != nil {
+			return nil, fmt.Errorf("get health: %w", err)
+		}
+	}
+	v, err := parseVersion(health.Version)
+	if err != nil {
+		return nil, err
+	}
+	if v.less(minVersion) {
+		return nil, fmt.Errorf("bee %s is not supported, need at least %s", v, minVersion)
+	}
+	c.version = v
+	if !v.less(mergedAPIVersion) && !c.debugSet && c.debugURL != c.apiURL {
+		fmt.Fprintln(console(), c.apiURL, "bee", v, "serves the debug API on the API, using it instead of", c.debugURL)
+		c.debugURL = c.apiURL
+	}
+	return health, nil
+}
+
+// checkExperiment reports experiment options the node is too old for.
+func (c *Client) checkExperiment(exp Experiment) error {
+	if exp.RedundancyLevel > 0 && c.version.less(redundancyVersion) {
+		return fmt.Errorf("redundancy needs bee %s, node runs %s", redundancyVersion, c.version)
+	}
+	if exp.Act != nil && c.version.less(actVersion) {
+		return fmt.Errorf("act needs bee %s, node runs %s", actVersion, c.version)
+	}
+	return nil
+}
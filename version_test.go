@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDetectVersionDebugURL(t *testing.T) {
+	const debugURL = "http://debug.example"
+	tests := []struct {
+		version  string
+		debugSet bool
+		// merged is whether the debug calls go to the API
+		merged bool
+	}{
+		{"1.18.2-0a1b2c3d", false, false},
+		{"2.1.0-0a1b2c3d", false, true},
+		// a debug API given on the command line, say behind a proxy, stays
+		{"2.1.0-0a1b2c3d", true, false},
+	}
+	for _, tt := range tests {
+		node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"status":"ok","version":"` + tt.version + `","apiVersion":"7.1.0"}`))
+		}))
+		c := newClient(node.URL, debugURL)
+		c.debugSet = tt.debugSet
+		_, err := c.detectVersion()
+		node.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := map[bool]string{true: node.URL, false: debugURL}[tt.merged]; c.debugURL != want {
+			t.Errorf("bee %s, debug API given %v: debug URL %s, want %s", tt.version, tt.debugSet, c.debugURL, want)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// watchedBatch is one batch polled by watch, logging to its own file.
+type watchedBatch struct {
+	id   string
+	f    io.WriteCloser
+	last *Batch
+}
+
+func cmdWatch(args []string) error {
+	fs := newFlagSet("watch", "[flags] <batch id>...")
+	interval := fs.Duration("interval", 30*time.Second, "polling interval")
+	duration := fs.Duration("duration", 0, "stop watching after this long, 0 watches until every batch expired")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("need at least one batch id")
+	}
+
+	var batches []*watchedBatch
+	for _, id := range fs.Args() {
+		f, err := os.OpenFile(outPath("watch-"+id+".log"), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+		if err != nil {
+			return fmt.Errorf("error opening file: %v", err)
+		}
+		defer f.Close()
+		log(f, "watching batchID=", id, " interval=", *interval)
+		batches = append(batches, &watchedBatch{id: id, f: f})
+	}
+
+	c := global.client()
+	started := clock.Now()
+	for {
+		expired := 0
+		for _, w := range batches {
+			w.poll(c)
+			if w.last != nil && w.last.Expired {
+				expired++
+			}
+		}
+		if expired == len(batches) {
+			fmt.Println("all batches expired")
+			return nil
+		}
+		if *duration > 0 && since(started) >= *duration {
+			return nil
+		}
+		clock.Sleep(*interval)
+	}
+}
+
+// poll records the batch state and calls out changes since the previous
+// poll. Errors are logged and retried on the next poll, the node may just be
+// restarting.
+func (w *watchedBatch) poll(c *Client) {
+	batch, err := c.getStamp(w.id)
+	if err != nil {
+		log(w.f, "get stamp: ", err)
+		return
+	}
+	log(w.f, "utilization=", batch.Utilization, " capacity=", batch.capacity(), " ttl=", time.Duration(batch.TTL)*time.Second,
+		" depth=", batch.Depth, " usable=", batch.Usable, " expired=", batch.Expired)
+
+	prev := w.last
+	w.last = batch
+	if prev == nil {
+		return
+	}
+	if batch.Utilization != prev.Utilization {
+		log(w.f, "utilization changed from=", prev.Utilization, " to=", batch.Utilization)
+	}
+	if batch.Depth != prev.Depth {
+		log(w.f, "depth changed from=", prev.Depth, " to=", batch.Depth)
+	}
+	if batch.TTL > prev.TTL {
+		log(w.f, "ttl increased from=", time.Duration(prev.TTL)*time.Second, " to=", time.Duration(batch.TTL)*time.Second)
+	}
+	if batch.Expired && !prev.Expired {
+		log(w.f, "batch expired")
+	}
+	if batch.Usable != prev.Usable {
+		log(w.f, "usable changed to=", batch.Usable)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatchPollsOnTheClock(t *testing.T) {
+	fc := newFakeClock()
+	useClock(t, fc)
+	_, c := newFullBee(t, 20, 16)
+	old := global
+	t.Cleanup(func() { global = old })
+	global.api, global.debugAPI, global.out = c.apiURL, c.debugURL, t.TempDir()
+
+	done := make(chan error, 1)
+	go func() { done <- cmdWatch([]string{"-interval", "30s", "-duration", "1m", testBatchID}) }()
+	// polls at 0, 30s and 1m, when the duration is up
+	for i := 0; i < 2; i++ {
+		eventually(t, "the next poll", func() bool { return fc.waiting() == 1 })
+		fc.advance(30 * time.Second)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("watch still runs after its duration")
+	}
+	b, err := os.ReadFile(filepath.Join(global.out, "watch-"+testBatchID+".log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if polls := strings.Count(string(b), "utilization=0 capacity=16"); polls != 3 {
+		t.Errorf("%d polls logged, want 3:\n%s", polls, b)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+const websiteAssets = 8
+
+type websiteFile struct {
+	name string
+	data []byte
+}
+
+// websiteUploader uploads a generated site of an index page, a stylesheet and
+// a number of binary assets as a single collection through /bzz, so the
+// manifest and metadata chunks are stamped along with the content.
+type websiteUploader struct {
+	client *Client
+	exp    Experiment
+	// uploads counts the uploads for the index document rotation
+	uploads uint32
+}
+
+// Payload is the tar archive of a generated site.
+func (u *websiteUploader) Payload(size int) ([]byte, error) {
+	files, err := generateWebsite(size, u.exp.Random)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, f := range files {
+		err = tw.WriteHeader(&tar.Header{
+			Name: f.name,
+			Mode: 0644,
+			Size: int64(len(f.data)),
+		})
+		if err != nil {
+			return nil, err
+		}
+		_, err = tw.Write(f.data)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = tw.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (u *websiteUploader) Upload(ctx context.Context, payload []byte, tag uint64, history string) (*uploadResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.client.apiURL+"/bzz", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Content-Type", "application/x-tar")
+	req.Header.Add("Swarm-Collection", "true")
+	var index []string
+	if u.exp.Metadata != nil {
+		index = u.exp.Metadata.IndexDocuments
+	}
+	req.Header.Add("Swarm-Index-Document", rotate(index, atomic.AddUint32(&u.uploads, 1)-1, "index.html"))
+	return u.client.upload(req, u.exp, tag, history)
+}
+
+// Chunks only counts the file contents; the manifest chunks on top of that
+// are what the tag counters reveal.
+func (u *websiteUploader) Chunks(size int) int {
+	n := 0
+	for _, s := range websiteSizes(size) {
+		n += estimateChunks(s, u.exp.Encrypt)
+	}
+	return n
+}
+
+// websiteSizes splits size into the sizes of the index page, the stylesheet
+// and the assets, in that order.
+func websiteSizes(size int) []int {
+	const text = 2 * 1024
+	sizes := []int{text, text}
+	rest := size - 2*text
+	if rest < websiteAssets {
+		rest = websiteAssets
+	}
+	for i := 0; i < websiteAssets; i++ {
+		n := rest / websiteAssets
+		if i < rest%websiteAssets {
+			n++
+		}
+		sizes = append(sizes, n)
+	}
+	return sizes
+}
+
+func generateWebsite(size int, random string) ([]websiteFile, error) {
+	sizes := websiteSizes(size)
+
+	var assets []websiteFile
+	for i, s := range sizes[2:] {
+		b, err := generateFile(s, random)
+		if err != nil {
+			return nil, err
+		}
+		assets = append(assets, websiteFile{name: fmt.Sprintf("assets/img-%d.bin", i), data: b})
+	}
+
+	var index strings.Builder
+	index.WriteString("<!DOCTYPE html>\n<html><head><link rel=\"stylesheet\" href=\"assets/style.css\"></head><body>\n")
+	for _, a := range assets {
+		fmt.Fprintf(&index, "<img src=%q>\n", a.name)
+	}
+	index.WriteString("</body></html>\n")
+
+	files := []websiteFile{
+		{name: "index.html", data: pad(index.String(), sizes[0])},
+		{name: "assets/style.css", data: pad("body { margin: 0; }\n", sizes[1])},
+	}
+	return append(files, assets...), nil
+}
+
+// pad appends newlines to s up to n bytes so text files have a predictable
+// size.
+func pad(s string, n int) []byte {
+	b := []byte(s)
+	for len(b) < n {
+		b = append(b, "\n"...)
+	}
+	return b
+}